@@ -0,0 +1,58 @@
+/*
+Package diff
+
+Copyright © 2023 MrPMillz
+*/
+package diff
+
+import (
+	"github.com/mr-pmillz/goforit/diff"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+type Options struct {
+	diffOptions diff.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = diff.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	return opts.diffOptions.LoadFromCommand(cmd, args)
+}
+
+// Command represents the diff command
+var Command = &cobra.Command{
+	Use:   "diff <old-output-dir> <new-output-dir>",
+	Short: "Compare two scan output directories",
+	Long: `Compare the nmap results of two scan output directories or inventories written by goforit import.
+Reports new and disappeared hosts, newly opened and closed ports and service/version changes keyed by host, port and protocol.
+
+Example Commands:
+	goforit diff /tmp/acme-week-1 /tmp/acme-week-2
+	goforit diff /tmp/acme-week-1 /tmp/acme-week-2 --json-file /tmp/acme-changes.json --exit-code
+	goforit diff /tmp/acme-week-1 /tmp/acme-week-2 --format json | jq .opened_ports
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd, args); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		report, err := diff.Run(&opts.diffOptions)
+		if err != nil {
+			log.Fatalf("Error in diff.Run():\n%+v\n", err)
+		}
+		if opts.diffOptions.ExitCode && report.HasChanges() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
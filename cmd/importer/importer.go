@@ -0,0 +1,55 @@
+/*
+Package importer
+
+Copyright © 2023 MrPMillz
+*/
+package importer
+
+import (
+	"github.com/mr-pmillz/goforit/importer"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+type Options struct {
+	importOptions importer.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = importer.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	return opts.importOptions.LoadFromCommand(cmd, args)
+}
+
+// Command represents the import command
+var Command = &cobra.Command{
+	Use:     "import <nmap-xml-file|directory>...",
+	Aliases: []string{"parse"},
+	Short:   "Merge existing nmap XML results without rescanning",
+	Long: `Merge existing nmap XML files into one deduplicated host and service inventory and export it.
+Files and directories may come from any nmap run, directories are searched recursively for nmap XML files.
+results.json is always written, goforit report and goforit diff read the inventory from it.
+
+Example Commands:
+	goforit import /tmp/acme-week-1 --output /tmp/acme-inventory
+	goforit import bob/nmap/ alice-full-tcp.xml alice-udp.xml -o /tmp/acme-inventory --output-format json,xlsx
+	goforit parse /tmp/acme-week-1/nmap/*.xml -o /tmp/acme-inventory
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd, args); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		if _, err := importer.Run(&opts.importOptions); err != nil {
+			log.Fatalf("Error in importer.Run():\n%+v\n", err)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
@@ -0,0 +1,54 @@
+/*
+Package monitor
+
+Copyright © 2023 MrPMillz
+*/
+package monitor
+
+import (
+	"github.com/mr-pmillz/goforit/monitor"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+type Options struct {
+	monitorOptions monitor.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = monitor.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
+	return opts.monitorOptions.LoadFromCommand(cmd)
+}
+
+// Command represents the monitor command
+var Command = &cobra.Command{
+	Use:   "monitor",
+	Short: "Rescan scopes on a schedule and report what changed",
+	Long: `Rescan the MONITORS defined in config.yaml on their schedules until interrupted.
+Every run is written into its own timestamped directory below <output>/<monitor> and saved into the results database of the monitor.
+Every run is compared to the last successful run, new hosts, newly opened ports and version changes are printed and written to changes.json.
+The history of every run is kept in <output>/<monitor>/history.jsonl.
+
+Example Commands:
+	goforit monitor --config config.yaml
+	goforit monitor --config config.yaml --monitors dmz,vpn
+	goforit monitor --config config.yaml --monitors dmz --once
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		if err := monitor.Run(cmd.Context(), &opts.monitorOptions); err != nil {
+			log.Fatalf("Error in monitor.Run():\n%+v\n", err)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
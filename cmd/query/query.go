@@ -0,0 +1,57 @@
+/*
+Package query
+
+Copyright © 2023 MrPMillz
+*/
+package query
+
+import (
+	"github.com/mr-pmillz/goforit/query"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+type Options struct {
+	queryOptions query.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = query.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	return opts.queryOptions.LoadFromCommand(cmd, args)
+}
+
+// Command represents the query command
+var Command = &cobra.Command{
+	Use:   "query <output-dir|results.db>",
+	Short: "Query the results database of a scan output directory",
+	Long: `Query the SQLite results database every scan saves into its output directory as results.db.
+Every scan into the same output directory is saved as a new run, questions are answered for the latest run unless --run selects another one.
+Nothing is rescanned and no XML is parsed again, --sql runs any read only query against the tables runs, hosts, hostnames, os_matches, services and scripts.
+
+Example Commands:
+	goforit query /tmp/engagement
+	goforit query /tmp/engagement --open-port 445
+	goforit query /tmp/engagement --open-port 161/udp --run 2 --format csv
+	goforit query /tmp/engagement --product http
+	goforit query /tmp/engagement --run 1 --not-in 2
+	goforit query /tmp/engagement/results.db --sql "SELECT address, os FROM hosts WHERE os LIKE '%Windows%'" --format json
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd, args); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		if _, err := query.Run(cmd.Context(), &opts.queryOptions); err != nil {
+			log.Fatalf("Error in query.Run():\n%+v\n", err)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
@@ -0,0 +1,55 @@
+/*
+Package report
+
+Copyright © 2023 MrPMillz
+*/
+package report
+
+import (
+	"github.com/mr-pmillz/goforit/report"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+type Options struct {
+	reportOptions report.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = report.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	return opts.reportOptions.LoadFromCommand(cmd, args)
+}
+
+// Command represents the report command
+var Command = &cobra.Command{
+	Use:   "report <output-dir>",
+	Short: "Render an offline HTML or Markdown report from a scan output directory",
+	Long: `Render a report from the nmap XML files of a scan output directory or the inventory written by goforit import.
+The HTML report is a single self-contained file, all CSS and JavaScript is embedded so it works on air-gapped networks.
+The Markdown report has per-host sections, open port tables and script evidence blocks for pentest write-ups.
+Both are rendered from Go templates, use --template to render with your own.
+
+Example Commands:
+	goforit report /tmp/scanme.nmap.org
+	goforit report /tmp/engagement --title "ACME External" -f /tmp/acme-external.html
+	goforit report /tmp/engagement --format markdown --template ~/templates/findings.md.tmpl
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd, args); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		if err := report.Run(&opts.reportOptions); err != nil {
+			log.Fatalf("Error in report.Run():\n%+v\n", err)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
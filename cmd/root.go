@@ -7,7 +7,13 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/mr-pmillz/goforit/cmd/diff"
+	"github.com/mr-pmillz/goforit/cmd/importer"
+	"github.com/mr-pmillz/goforit/cmd/monitor"
+	"github.com/mr-pmillz/goforit/cmd/query"
+	"github.com/mr-pmillz/goforit/cmd/report"
 	"github.com/mr-pmillz/goforit/cmd/scan"
+	"github.com/mr-pmillz/goforit/cmd/serve"
 	"github.com/mr-pmillz/goforit/utils"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -44,6 +50,12 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file default location for viper to look is ~/.config/goforit/config.yaml")
 	RootCmd.PersistentFlags().BoolVarP(&configFileSet, "configfileset", "", false, "Used internally by goforit to check if required args are set with and without configuration file, Do not use this flag...")
 	RootCmd.AddCommand(scan.Command)
+	RootCmd.AddCommand(report.Command)
+	RootCmd.AddCommand(diff.Command)
+	RootCmd.AddCommand(importer.Command)
+	RootCmd.AddCommand(query.Command)
+	RootCmd.AddCommand(monitor.Command)
+	RootCmd.AddCommand(serve.Command)
 }
 
 // initConfig reads in config file and ENV variables if set.
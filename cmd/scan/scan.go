@@ -35,6 +35,19 @@ var Command = &cobra.Command{
 Example Commands:
 	goforit scan --config config.yaml
 	goforit scan -t scanme.nmap.org --output /tmp/scanme.nmap.org -v
+	goforit scan -t scanme.nmap.org --output /tmp/scanme.nmap.org --profile web
+	goforit scan -t scanme.nmap.org --output /tmp/scanme.nmap.org --engines nmap-stream
+	goforit scan -t 10.0.0.0/24 --output /tmp/10.0.0.0_24 --engines connect,nmap --connect-rate 500
+	goforit scan -t 10.0.0.0/24 --output /tmp/10.0.0.0_24 --engines connect --ports top:100
+	goforit scan -t scanme.nmap.org --output /tmp/scanme.nmap.org --ports 22,80,443,8000-8100,U:53,161
+	goforit scan -t scanme.nmap.org --output /tmp/scanme.nmap.org --ports top:100
+	goforit scan -t 10.0.0.0/24 --output /tmp/10.0.0.0_24 --udp --udp-top-ports 200
+	goforit scan -t targets.txt --exclude-file out-of-scope.txt --exclude 10.0.0.1,10.0.0.254 --output /tmp/engagement
+	goforit scan -t 10.0.0.0/24 --masscan --masscan-rate 5000 --output /tmp/10.0.0.0_24
+	goforit scan -t 10.0.0.0/16 --threads 20 --nmap-threads 16 --output /tmp/10.0.0.0_16
+	goforit scan -t 10.0.0.0/16 --output /tmp/10.0.0.0_16 --resume
+	goforit scan -t 10.0.0.0/16 --output /tmp/10.0.0.0_16 --webhook https://hooks.slack.com/services/T000/B000/XXXX
+	goforit scan -t targets.txt --output /tmp/engagement --host-timeout 30m --scan-timeout 48h --max-attempts 3 --retry-on empty-xml,timeout
 `,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		// are we using a config file?
@@ -69,7 +82,8 @@ Example Commands:
 		if err != nil {
 			log.Fatalf("Could not create new target object %+v\n", err)
 		}
-		if err = target.Scanner(&opts.scanOptions); err != nil {
+		log.Println(target.Counts)
+		if err = target.Scanner(cmd.Context(), &opts.scanOptions); err != nil {
 			log.Fatalf("Error in runner.Scanner():\n%+v\n", err)
 		}
 	},
@@ -0,0 +1,62 @@
+/*
+Package serve
+
+Copyright © 2023 MrPMillz
+*/
+package serve
+
+import (
+	"github.com/mr-pmillz/goforit/server"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+type Options struct {
+	serverOptions server.Options
+}
+
+func configureCommand(cmd *cobra.Command) {
+	_ = server.ConfigureCommand(cmd)
+}
+
+// LoadFromCommand ... receiver method on *Options
+func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
+	return opts.serverOptions.LoadFromCommand(cmd)
+}
+
+// Command represents the serve command
+var Command = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API to submit and track scans",
+	Long: `Serve a local REST API that runs scans submitted as JSON, reports their status and progress,
+streams their events as server-sent events and returns their results as JSON.
+Every request needs the API token as bearer token. The scan flags and config.yaml are the defaults of every submitted scan,
+scans are written below --output.
+
+Endpoints:
+	POST   /api/v1/scans              submit a scan, e.g. {"targets": ["10.0.0.0/24"], "profile": "quick"}
+	GET    /api/v1/scans              list every scan
+	GET    /api/v1/scans/{id}         status and progress of a scan
+	DELETE /api/v1/scans/{id}         cancel a scan
+	GET    /api/v1/scans/{id}/events  stream the events of a scan
+	GET    /api/v1/scans/{id}/results results of a scan that ended
+
+Example Commands:
+	goforit serve --config config.yaml
+	GOFORIT_API_TOKEN=changeme goforit serve --output /tmp/api-scans --listen 127.0.0.1:8642 --max-jobs 2
+	curl -H "Authorization: Bearer changeme" -d '{"targets": ["scanme.nmap.org"], "profile": "quick"}' http://127.0.0.1:8642/api/v1/scans
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{}
+		if err := opts.LoadFromCommand(cmd); err != nil {
+			log.Fatalf("Could not LoadFromCommand %+v\n", err)
+		}
+		if err := server.Run(cmd.Context(), &opts.serverOptions); err != nil {
+			log.Fatalf("Error in server.Run():\n%+v\n", err)
+		}
+	},
+}
+
+func init() {
+	configureCommand(Command)
+}
@@ -0,0 +1,186 @@
+/*
+Package diff
+
+Copyright © 2023 MrPMillz
+*/
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report is every difference between two scans
+type Report struct {
+	Old         string    `json:"old"`
+	New         string    `json:"new"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// NewHosts are hosts that are up in the new scan but were not in the old scan
+	NewHosts []string `json:"new_hosts"`
+	// RemovedHosts are hosts that were up in the old scan but are not in the new scan
+	RemovedHosts []string `json:"removed_hosts"`
+	// OpenedPorts are services that are open in the new scan but were not open in the old scan
+	OpenedPorts []export.Service `json:"opened_ports"`
+	// ClosedPorts are services that were open in the old scan but are not open in the new scan
+	ClosedPorts []export.Service `json:"closed_ports"`
+	// ServiceChanges are open services whose service name, product or version changed
+	ServiceChanges []ServiceChange `json:"service_changes"`
+}
+
+// ServiceChange is a service that is open in both scans but changed
+type ServiceChange struct {
+	// Key is host:port/protocol
+	Key string         `json:"key"`
+	Old export.Service `json:"old"`
+	New export.Service `json:"new"`
+}
+
+// Compare returns the differences between the old and new scan, keyed by host, port and protocol
+func Compare(oldName string, oldDoc *export.Document, newName string, newDoc *export.Document) *Report {
+	report := &Report{
+		Old:            oldName,
+		New:            newName,
+		GeneratedAt:    time.Now().UTC(),
+		NewHosts:       []string{},
+		RemovedHosts:   []string{},
+		OpenedPorts:    []export.Service{},
+		ClosedPorts:    []export.Service{},
+		ServiceChanges: []ServiceChange{},
+	}
+
+	oldHosts, newHosts := hostSet(oldDoc), hostSet(newDoc)
+	for _, host := range newDoc.Hosts {
+		if _, ok := oldHosts[host.Address]; !ok {
+			report.NewHosts = append(report.NewHosts, host.Address)
+		}
+	}
+	for _, host := range oldDoc.Hosts {
+		if _, ok := newHosts[host.Address]; !ok {
+			report.RemovedHosts = append(report.RemovedHosts, host.Address)
+		}
+	}
+
+	oldServices, newServices := openServices(oldDoc), openServices(newDoc)
+	for _, service := range newDoc.OpenServices() {
+		old, ok := oldServices[service.Key()]
+		switch {
+		case !ok:
+			report.OpenedPorts = append(report.OpenedPorts, service)
+		case changed(old, service):
+			report.ServiceChanges = append(report.ServiceChanges, ServiceChange{Key: service.Key(), Old: old, New: service})
+		}
+	}
+	for _, service := range oldDoc.OpenServices() {
+		if _, ok := newServices[service.Key()]; !ok {
+			report.ClosedPorts = append(report.ClosedPorts, service)
+		}
+	}
+	return report
+}
+
+// HasChanges reports whether anything changed between the two scans
+func (r *Report) HasChanges() bool {
+	return len(r.NewHosts)+len(r.RemovedHosts)+len(r.OpenedPorts)+len(r.ClosedPorts)+len(r.ServiceChanges) > 0
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as human-readable text
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", r.Old, r.New)
+	if !r.HasChanges() {
+		b.WriteString("\nNo changes\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	var lines []string
+	for _, host := range r.NewHosts {
+		lines = append(lines, "+ "+host)
+	}
+	writeSection(&b, "New hosts", lines)
+
+	lines = nil
+	for _, host := range r.RemovedHosts {
+		lines = append(lines, "- "+host)
+	}
+	writeSection(&b, "Removed hosts", lines)
+
+	lines = nil
+	for _, s := range r.OpenedPorts {
+		lines = append(lines, fmt.Sprintf("+ %-28s %s", s.Key(), describe(s)))
+	}
+	writeSection(&b, "Newly opened ports", lines)
+
+	lines = nil
+	for _, s := range r.ClosedPorts {
+		lines = append(lines, fmt.Sprintf("- %-28s %s", s.Key(), describe(s)))
+	}
+	writeSection(&b, "Closed ports", lines)
+
+	lines = nil
+	for _, c := range r.ServiceChanges {
+		lines = append(lines, fmt.Sprintf("~ %-28s %s -> %s", c.Key, describe(c.Old), describe(c.New)))
+	}
+	writeSection(&b, "Service changes", lines)
+
+	fmt.Fprintf(&b, "\n%d new hosts, %d removed hosts, %d opened ports, %d closed ports, %d service changes\n",
+		len(r.NewHosts), len(r.RemovedHosts), len(r.OpenedPorts), len(r.ClosedPorts), len(r.ServiceChanges))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSection writes a titled list of lines, nothing is written for an empty list
+func writeSection(b *strings.Builder, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s (%d):\n", title, len(lines))
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+}
+
+// describe returns the service name, product and version of a service
+func describe(s export.Service) string {
+	description := strings.TrimSpace(fmt.Sprintf("%s %s", s.Service, s.ProductVersion()))
+	if description == "" {
+		return "unknown"
+	}
+	return description
+}
+
+// changed reports whether the service name, product, version, extra info or tunnel of an open service changed
+func changed(old, service export.Service) bool {
+	return old.Service != service.Service ||
+		old.Product != service.Product ||
+		old.Version != service.Version ||
+		old.ExtraInfo != service.ExtraInfo ||
+		old.Tunnel != service.Tunnel
+}
+
+func hostSet(doc *export.Document) map[string]struct{} {
+	hosts := make(map[string]struct{}, len(doc.Hosts))
+	for _, host := range doc.Hosts {
+		hosts[host.Address] = struct{}{}
+	}
+	return hosts
+}
+
+func openServices(doc *export.Document) map[string]export.Service {
+	services := make(map[string]export.Service)
+	for _, service := range doc.OpenServices() {
+		services[service.Key()] = service
+	}
+	return services
+}
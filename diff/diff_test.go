@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"bytes"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/importer"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newDocument(hosts map[string][]export.Service) *export.Document {
+	doc := &export.Document{}
+	for address, services := range hosts {
+		for i := range services {
+			services[i].Host = address
+			if services[i].State == "" {
+				services[i].State = "open"
+			}
+		}
+		doc.Hosts = append(doc.Hosts, export.Host{Address: address, Services: services})
+	}
+	sort.Slice(doc.Hosts, func(i, j int) bool { return doc.Hosts[i].Address < doc.Hosts[j].Address })
+	return doc
+}
+
+func TestCompare(t *testing.T) {
+	oldDoc := newDocument(map[string][]export.Service{
+		"10.0.0.1": {
+			{Port: 22, Protocol: "tcp", Service: "ssh", Product: "OpenSSH", Version: "8.9p1"},
+			{Port: 80, Protocol: "tcp", Service: "http"},
+			{Port: 161, Protocol: "udp", Service: "snmp"},
+		},
+		"10.0.0.2": {{Port: 445, Protocol: "tcp", Service: "microsoft-ds"}},
+	})
+	newDoc := newDocument(map[string][]export.Service{
+		"10.0.0.1": {
+			{Port: 22, Protocol: "tcp", Service: "ssh", Product: "OpenSSH", Version: "9.3p1"},
+			{Port: 80, Protocol: "tcp", Service: "http", State: "filtered"},
+			{Port: 161, Protocol: "udp", Service: "snmp"},
+			{Port: 161, Protocol: "tcp", Service: "snmp"},
+		},
+		"10.0.0.3": {{Port: 3389, Protocol: "tcp", Service: "ms-wbt-server"}},
+	})
+
+	report := Compare("old", oldDoc, "new", newDoc)
+	keys := func(services []export.Service) []string {
+		var keys []string
+		for _, service := range services {
+			keys = append(keys, service.Key())
+		}
+		return keys
+	}
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"New Hosts", report.NewHosts, []string{"10.0.0.3"}},
+		{"Removed Hosts", report.RemovedHosts, []string{"10.0.0.2"}},
+		{"Opened Ports", keys(report.OpenedPorts), []string{"10.0.0.1:161/tcp", "10.0.0.3:3389/tcp"}},
+		{"Closed Ports", keys(report.ClosedPorts), []string{"10.0.0.1:80/tcp", "10.0.0.2:445/tcp"}},
+		{"Service Changes", len(report.ServiceChanges), 1},
+		{"Service Change Key", report.ServiceChanges[0].Key, "10.0.0.1:22/tcp"},
+		{"Has Changes", report.HasChanges(), true},
+		{"No Changes", Compare("old", oldDoc, "new", oldDoc).HasChanges(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "~ 10.0.0.1:22/tcp              ssh OpenSSH 8.9p1 -> ssh OpenSSH 9.3p1") {
+		t.Errorf("WriteText() got = %s", buf.String())
+	}
+}
+
+func TestRunImportedInventory(t *testing.T) {
+	data, err := os.ReadFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not read test data: %v", err)
+	}
+	scanDir, inventoryDir := t.TempDir(), t.TempDir()
+	if err = os.MkdirAll(filepath.Join(scanDir, "nmap"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(scanDir, "nmap", "multihost.xml"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = importer.Run(&importer.Options{Paths: []string{"../nmapxml/testdata/multihost.xml"}, Output: inventoryDir, OutputFormat: []string{"csv"}}); err != nil {
+		t.Fatalf("importer.Run() error = %v", err)
+	}
+
+	report, err := Run(&Options{Old: scanDir, New: inventoryDir, Format: "json"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.HasChanges() {
+		t.Errorf("Run() got changes %+v, want none between a scan and the import of its XML", report)
+	}
+	if report, err = Run(&Options{Old: inventoryDir, New: t.TempDir(), Format: "json"}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.RemovedHosts) != 2 {
+		t.Errorf("Run() removed hosts got = %v, want both hosts of the inventory", report.RemovedHosts)
+	}
+}
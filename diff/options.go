@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// Options are the options of the diff command
+type Options struct {
+	Old      string
+	New      string
+	Format   string
+	JSONFile string
+	ExitCode bool
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	cmd.PersistentFlags().StringP("format", "", "text", "format to print the differences in, text or json")
+	cmd.PersistentFlags().StringP("json-file", "", "", "also write the differences as JSON to this file")
+	cmd.PersistentFlags().BoolP("exit-code", "", false, "exit with status 1 when there are differences")
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	oldDir, err := utils.ResolveAbsPath(args[0])
+	if err != nil {
+		return err
+	}
+	opts.Old = oldDir
+
+	newDir, err := utils.ResolveAbsPath(args[1])
+	if err != nil {
+		return err
+	}
+	opts.New = newDir
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	opts.Format = strings.ToLower(format)
+	if opts.Format != "text" && opts.Format != "json" {
+		return fmt.Errorf("unsupported diff format %q, use text or json", format)
+	}
+
+	jsonFile, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "json-file",
+		IsFilePath: true,
+		Opts:       opts.JSONFile,
+	})
+	if err != nil {
+		return err
+	}
+	opts.JSONFile = jsonFile.(string)
+
+	exitCode, err := cmd.Flags().GetBool("exit-code")
+	if err != nil {
+		return err
+	}
+	opts.ExitCode = exitCode
+
+	return nil
+}
+
+// Run loads both output directories and prints their differences
+func Run(opts *Options) (*Report, error) {
+	oldDoc, err := loadDocument(opts.Old)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", opts.Old, err)
+	}
+	newDoc, err := loadDocument(opts.New)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", opts.New, err)
+	}
+	report := Compare(opts.Old, oldDoc, opts.New, newDoc)
+
+	switch opts.Format {
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	default:
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.JSONFile != "" {
+		f, err := os.OpenFile(opts.JSONFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err = report.WriteJSON(f); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if err = f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// loadDocument parses the nmap XML files of an output directory
+func loadDocument(dir string) (*export.Document, error) {
+	results, err := runner.LoadResults(dir)
+	if err != nil {
+		return nil, err
+	}
+	return results.Document, nil
+}
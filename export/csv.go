@@ -0,0 +1,93 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxScriptSummary is the maximum length of the script summary column
+const maxScriptSummary = 250
+
+// inventoryHeader is the header row of the CSV and XLSX service inventory
+var inventoryHeader = []string{"Host", "Hostnames", "Port", "Protocol", "State", "Service", "Product", "Version", "Extra Info", "OS", "Scripts"}
+
+// WriteCSV writes a flattened service inventory with one row per host and port
+func WriteCSV(w io.Writer, doc *Document) error {
+	writer := csv.NewWriter(w)
+	for _, row := range inventoryRows(doc) {
+		if err := writer.Write(sanitizeRow(row)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// inventoryRows returns the header and one row per host and port of the service inventory
+func inventoryRows(doc *Document) [][]string {
+	rows := [][]string{inventoryHeader}
+	for i := range doc.Hosts {
+		host := &doc.Hosts[i]
+		for j := range host.Services {
+			service := &host.Services[j]
+			rows = append(rows, []string{
+				host.Address,
+				strings.Join(host.Hostnames, ", "),
+				strconv.Itoa(service.Port),
+				service.Protocol,
+				service.State,
+				service.Service,
+				service.Product,
+				service.Version,
+				service.ExtraInfo,
+				osGuess(host),
+				scriptSummary(service.Scripts),
+			})
+		}
+	}
+	return rows
+}
+
+// osGuess returns the OS match of the host with its accuracy
+func osGuess(host *Host) string {
+	if host.OS == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%d%%)", host.OS, host.OSAccuracy)
+}
+
+// scriptSummary returns the first line of every script output, truncated to maxScriptSummary
+func scriptSummary(scripts []Script) string {
+	summaries := make([]string, 0, len(scripts))
+	for _, script := range scripts {
+		output := strings.TrimSpace(script.Output)
+		if firstLine, _, found := strings.Cut(output, "\n"); found {
+			output = strings.TrimSpace(firstLine) + " ..."
+		}
+		summaries = append(summaries, fmt.Sprintf("%s: %s", script.ID, output))
+	}
+	return truncate(strings.Join(summaries, "; "), maxScriptSummary)
+}
+
+// truncate shortens s to at most max runes
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// sanitizeRow stops spreadsheet programs from evaluating CSV cells as formulas.
+// Script output such as http-title is controlled by the scanned host and ends up in client deliverables.
+func sanitizeRow(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
@@ -0,0 +1,410 @@
+/*
+Package export
+
+Copyright © 2023 MrPMillz
+*/
+package export
+
+import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is bumped whenever a field of Document is renamed or removed.
+// New fields may be added without bumping it.
+const SchemaVersion = "1.0"
+
+// Document is the stable JSON document goforit writes for every scan
+type Document struct {
+	// SchemaVersion of this document, see SchemaVersion
+	SchemaVersion string `json:"schema_version"`
+	// GeneratedAt is when goforit wrote the document
+	GeneratedAt time.Time `json:"generated_at"`
+	// Scans are the nmap runs the hosts were parsed from
+	Scans []Scan `json:"scans"`
+	// Hosts are every host that was up, sorted by address
+	Hosts []Host `json:"hosts"`
+	// Incomplete are the targets whose scan was interrupted before it finished
+	Incomplete []string `json:"incomplete,omitempty"`
+	// TimedOut are the targets whose scan ran into the host timeout
+	TimedOut []string `json:"timed_out,omitempty"`
+}
+
+// Scan describes a single nmap run
+type Scan struct {
+	Args    string    `json:"args"`
+	Version string    `json:"version"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Hosts   int       `json:"hosts"`
+}
+
+// Host is a single host and all of its services
+type Host struct {
+	// Address is the IPv4 or IPv6 address of the host
+	Address string `json:"address"`
+	// AddressType is ipv4 or ipv6
+	AddressType string `json:"address_type"`
+	// MAC is the MAC address when the host was on the local network
+	MAC string `json:"mac,omitempty"`
+	// Vendor is the vendor of the MAC address
+	Vendor string `json:"vendor,omitempty"`
+	// Hostnames are the user supplied and PTR hostnames of the host
+	Hostnames []string `json:"hostnames"`
+	// Status is up or down
+	Status string `json:"status"`
+	// OS is the most accurate OS match, empty when OS detection did not run or found nothing
+	OS string `json:"os,omitempty"`
+	// OSAccuracy is the accuracy of the OS match in percent
+	OSAccuracy int `json:"os_accuracy,omitempty"`
+	// OSMatches are every OS match nmap reported for the host, most accurate first
+	OSMatches []OSMatch `json:"os_matches,omitempty"`
+	// Services are every port nmap reported for the host, sorted by protocol and port
+	Services []Service `json:"services"`
+	// Scripts are the host script results such as smb2-security-mode
+	Scripts []Script `json:"scripts,omitempty"`
+}
+
+// Service is a single port of a host. Every Service is one line of the JSONL export.
+type Service struct {
+	// Host is the address of the host the service runs on
+	Host string `json:"host"`
+	// Hostnames are the hostnames of the host the service runs on
+	Hostnames []string `json:"hostnames"`
+	// Port is the port number
+	Port int `json:"port"`
+	// Protocol is tcp, udp or sctp
+	Protocol string `json:"protocol"`
+	// State is open, closed, filtered, open|filtered or unfiltered
+	State string `json:"state"`
+	// Reason is why nmap decided on the state, e.g. syn-ack
+	Reason string `json:"reason,omitempty"`
+	// Service is the service name, e.g. http
+	Service string `json:"service"`
+	// Product is the detected product, e.g. nginx
+	Product string `json:"product,omitempty"`
+	// Version is the detected product version
+	Version string `json:"version,omitempty"`
+	// ExtraInfo is any extra version detection info
+	ExtraInfo string `json:"extra_info,omitempty"`
+	// Tunnel is ssl when the service is wrapped in TLS
+	Tunnel string `json:"tunnel,omitempty"`
+	// CPEs are the CPEs of the detected product
+	CPEs []string `json:"cpes"`
+	// Scripts are the NSE script results for the port
+	Scripts []Script `json:"scripts"`
+}
+
+// OSMatch is a single OS guess of nmap
+type OSMatch struct {
+	// Name is the OS name, e.g. Linux 4.15 - 5.8
+	Name string `json:"name"`
+	// Accuracy is the accuracy of the match in percent
+	Accuracy int `json:"accuracy"`
+}
+
+// Script is the output of an NSE script
+type Script struct {
+	// ID is the script name, e.g. http-title
+	ID string `json:"id"`
+	// Output is the human readable script output
+	Output string `json:"output"`
+	// Data is the structured script output flattened into dotted keys
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// NewDocument builds a Document from parsed nmap runs.
+// Hosts found in more than one run are merged by address, later runs win for ports found in both.
+func NewDocument(runs []nmapxml.Run) *Document {
+	b := NewBuilder()
+	for i := range runs {
+		b.AddRun(&runs[i])
+	}
+	return b.Document()
+}
+
+// Builder builds a Document from nmap hosts added one at a time, so that the parsed nmap runs never
+// have to be held in memory at once. Hosts are merged by address, hosts added later win for ports found in both.
+type Builder struct {
+	scans []Scan
+	hosts map[string]*Host
+}
+
+// NewBuilder returns an empty Builder
+func NewBuilder() *Builder {
+	return &Builder{
+		scans: []Scan{},
+		hosts: make(map[string]*Host),
+	}
+}
+
+// AddRun adds a parsed nmap run and every one of its hosts
+func (b *Builder) AddRun(run *nmapxml.Run) {
+	for i := range run.Hosts {
+		b.AddHost(&run.Hosts[i])
+	}
+	b.AddScan(run, len(run.Hosts))
+}
+
+// AddScan records an nmap run that hosts were added from, run.Hosts is ignored in favour of hosts
+func (b *Builder) AddScan(run *nmapxml.Run, hosts int) {
+	b.scans = append(b.scans, Scan{
+		Args:    run.Args,
+		Version: run.Version,
+		Start:   run.Start.Time(),
+		End:     run.RunStats.Finished.Time.Time(),
+		Hosts:   hosts,
+	})
+}
+
+// AddHost merges a single nmap host into the document, hosts that are down are ignored
+func (b *Builder) AddHost(h *nmapxml.Host) {
+	addHost(b.hosts, h)
+}
+
+// Document returns the Document of everything added so far
+func (b *Builder) Document() *Document {
+	doc := &Document{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Scans:         b.scans,
+		Hosts:         []Host{},
+	}
+	for _, host := range b.hosts {
+		sortServices(host.Services)
+		doc.Hosts = append(doc.Hosts, *host)
+	}
+	sortHosts(doc.Hosts)
+	return doc
+}
+
+// Services returns every service of every host in host order
+func (d *Document) Services() []Service {
+	var services []Service
+	for i := range d.Hosts {
+		services = append(services, d.Hosts[i].Services...)
+	}
+	return services
+}
+
+// OpenServices returns every open service of every host in host order
+func (d *Document) OpenServices() []Service {
+	var services []Service
+	for i := range d.Hosts {
+		services = append(services, d.Hosts[i].OpenServices()...)
+	}
+	return services
+}
+
+// OpenServices returns the open services of the host
+func (h *Host) OpenServices() []Service {
+	var services []Service
+	for _, service := range h.Services {
+		if service.Open() {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// Open reports whether the service port is open
+func (s *Service) Open() bool {
+	return s.State == "open"
+}
+
+// Key uniquely identifies a service by host, port and protocol, e.g. 10.0.0.1:443/tcp
+func (s *Service) Key() string {
+	return fmt.Sprintf("%s:%d/%s", s.Host, s.Port, s.Protocol)
+}
+
+// ProductVersion returns the product and version of the service, e.g. "OpenSSH 8.9p1"
+func (s *Service) ProductVersion() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", s.Product, s.Version))
+}
+
+// addHost merges an nmap host into hosts by address
+func addHost(hosts map[string]*Host, h *nmapxml.Host) {
+	address := h.Address()
+	if address == "" || !h.Up() {
+		return
+	}
+	host, ok := hosts[address]
+	if !ok {
+		host = &Host{
+			Address:   address,
+			Hostnames: []string{},
+			Services:  []Service{},
+		}
+		hosts[address] = host
+	}
+	host.Status = h.Status.State
+	for _, addr := range h.Addresses {
+		switch addr.AddrType {
+		case "mac":
+			host.MAC, host.Vendor = addr.Addr, addr.Vendor
+		case "ipv4", "ipv6":
+			if addr.Addr == address {
+				host.AddressType = addr.AddrType
+			}
+		}
+	}
+	for _, hostname := range h.Hostnames {
+		host.Hostnames = appendUnique(host.Hostnames, hostname.Name)
+	}
+	if match := h.OS.BestMatch(); match != nil && match.Accuracy >= host.OSAccuracy {
+		host.OS, host.OSAccuracy = match.Name, match.Accuracy
+	}
+	for _, match := range h.OS.OSMatches {
+		host.OSMatches = mergeOSMatch(host.OSMatches, OSMatch{Name: match.Name, Accuracy: match.Accuracy})
+	}
+	for i := range h.HostScripts {
+		host.Scripts = mergeScript(host.Scripts, newScript(&h.HostScripts[i]))
+	}
+	for i := range h.Ports {
+		mergeService(host, newService(host, &h.Ports[i]))
+	}
+	// keep the hostnames of every service in sync with the host
+	for i := range host.Services {
+		host.Services[i].Hostnames = host.Hostnames
+	}
+}
+
+// newService converts an nmap port into a Service
+func newService(host *Host, p *nmapxml.Port) Service {
+	service := Service{
+		Host:      host.Address,
+		Hostnames: host.Hostnames,
+		Port:      p.PortID,
+		Protocol:  p.Protocol,
+		State:     p.State.State,
+		Reason:    p.State.Reason,
+		Service:   p.Service.Name,
+		Product:   p.Service.Product,
+		Version:   p.Service.Version,
+		ExtraInfo: p.Service.ExtraInfo,
+		Tunnel:    p.Service.Tunnel,
+		CPEs:      append([]string{}, p.Service.CPEs...),
+		Scripts:   []Script{},
+	}
+	for i := range p.Scripts {
+		service.Scripts = append(service.Scripts, newScript(&p.Scripts[i]))
+	}
+	return service
+}
+
+// newScript converts an nmap script into a Script
+func newScript(s *nmapxml.Script) Script {
+	script := Script{ID: s.ID, Output: strings.TrimSpace(s.Output)}
+	if data := s.Flatten(); len(data) > 0 {
+		script.Data = data
+	}
+	return script
+}
+
+// mergeService adds service to host, replacing a service with the same port and protocol.
+// Script results of the replaced service are kept unless the new service has its own result for that script.
+func mergeService(host *Host, service Service) {
+	for i := range host.Services {
+		existing := &host.Services[i]
+		if existing.Port != service.Port || existing.Protocol != service.Protocol {
+			continue
+		}
+		for _, script := range existing.Scripts {
+			service.Scripts = mergeScriptIfMissing(service.Scripts, script)
+		}
+		if service.Product == "" && service.State == existing.State {
+			service.Product, service.Version, service.ExtraInfo, service.CPEs = existing.Product, existing.Version, existing.ExtraInfo, existing.CPEs
+		}
+		*existing = service
+		return
+	}
+	host.Services = append(host.Services, service)
+}
+
+// mergeScript adds script to scripts, replacing a script with the same ID
+func mergeScript(scripts []Script, script Script) []Script {
+	for i := range scripts {
+		if scripts[i].ID == script.ID {
+			scripts[i] = script
+			return scripts
+		}
+	}
+	return append(scripts, script)
+}
+
+// mergeScriptIfMissing adds script to scripts unless a script with the same ID exists
+func mergeScriptIfMissing(scripts []Script, script Script) []Script {
+	for i := range scripts {
+		if scripts[i].ID == script.ID {
+			return scripts
+		}
+	}
+	return append(scripts, script)
+}
+
+// mergeOSMatch adds match to matches keeping the highest accuracy of every OS, most accurate first
+func mergeOSMatch(matches []OSMatch, match OSMatch) []OSMatch {
+	found := false
+	for i := range matches {
+		if matches[i].Name == match.Name {
+			if match.Accuracy > matches[i].Accuracy {
+				matches[i].Accuracy = match.Accuracy
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Accuracy > matches[j].Accuracy })
+	return matches
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// sortHosts sorts hosts by IP address, anything that isn't an IP sorts last by name
+func sortHosts(hosts []Host) {
+	sort.Slice(hosts, func(i, j int) bool {
+		return lessAddress(hosts[i].Address, hosts[j].Address)
+	})
+}
+
+// sortServices sorts services by protocol then port
+func sortServices(services []Service) {
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Protocol != services[j].Protocol {
+			return services[i].Protocol < services[j].Protocol
+		}
+		return services[i].Port < services[j].Port
+	})
+}
+
+// lessAddress compares two addresses numerically, falling back to a string compare
+func lessAddress(a, b string) bool {
+	addrA, errA := netip.ParseAddr(a)
+	addrB, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return addrA.Less(addrB)
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func loadRuns(t *testing.T) []nmapxml.Run {
+	t.Helper()
+	run, err := nmapxml.ParseFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not parse test data: %v", err)
+	}
+	return []nmapxml.Run{*run}
+}
+
+func TestNewDocument(t *testing.T) {
+	runs := loadRuns(t)
+	// the same host scanned twice should only show up once
+	doc := NewDocument(append(runs, runs...))
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"Scans", len(doc.Scans), 2},
+		{"Hosts", len(doc.Hosts), 2},
+		{"Host Order", []string{doc.Hosts[0].Address, doc.Hosts[1].Address}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"Hostnames", doc.Hosts[0].Hostnames, []string{"gw.corp.local"}},
+		{"MAC", doc.Hosts[0].MAC, "00:11:22:33:44:55"},
+		{"OS", doc.Hosts[0].OS, "Linux 4.15 - 5.8"},
+		{"OS Matches", doc.Hosts[0].OSMatches, []OSMatch{{Name: "Linux 4.15 - 5.8", Accuracy: 100}, {Name: "Linux 2.6.32", Accuracy: 95}}},
+		{"Services", len(doc.Services()), 4},
+		{"Open Services", len(doc.OpenServices()), 3},
+		{"Service Key", doc.Hosts[0].Services[0].Key(), "10.0.0.1:22/tcp"},
+		{"Product Version", doc.Hosts[0].Services[0].ProductVersion(), "OpenSSH 8.9p1 Ubuntu 3ubuntu0.1"},
+		{"Script Data", doc.Hosts[0].Services[1].Scripts[0].Data, map[string]string{"title": "Welcome to nginx!"}},
+		{"Host Scripts", len(doc.Hosts[1].Scripts), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	doc := NewDocument(loadRuns(t))
+	var buf bytes.Buffer
+	if err := WriteJSONL(&buf, doc); err != nil {
+		t.Fatalf("WriteJSONL() error = %v", err)
+	}
+	var lines int
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		service := Service{}
+		if err := json.Unmarshal(scanner.Bytes(), &service); err != nil {
+			t.Fatalf("WriteJSONL() line %d is not a Service: %v", lines+1, err)
+		}
+		if service.Host == "" || service.Protocol == "" {
+			t.Errorf("WriteJSONL() line %d is missing host or protocol: %s", lines+1, scanner.Text())
+		}
+		lines++
+	}
+	if lines != len(doc.Services()) {
+		t.Errorf("WriteJSONL() wrote %d lines, want %d", lines, len(doc.Services()))
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	if err := ValidateFormats([]string{"json", " JSONL"}); err != nil {
+		t.Errorf("ValidateFormats() error = %v", err)
+	}
+	if err := ValidateFormats([]string{"json", "yaml"}); err == nil {
+		t.Errorf("ValidateFormats() expected an error for yaml")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	doc := NewDocument(loadRuns(t))
+	doc.Hosts[0].Services[1].Product = "=HYPERLINK(\"http://evil\")"
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, doc); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("WriteCSV() wrote invalid CSV: %v", err)
+	}
+	if len(rows) != len(doc.Services())+1 {
+		t.Errorf("WriteCSV() wrote %d rows, want %d", len(rows), len(doc.Services())+1)
+	}
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"Header", rows[0][0], "Host"},
+		{"OS Guess", rows[1][9], "Linux 4.15 - 5.8 (100%)"},
+		{"Script Summary", rows[2][10], "http-title: Welcome to nginx!; http-server-header: nginx/1.18.0 (Ubuntu)"},
+		{"Formula Injection", rows[2][6], "'=HYPERLINK(\"http://evil\")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	doc := NewDocument(loadRuns(t))
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, doc); err != nil {
+		t.Fatalf("WriteXLSX() error = %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("WriteXLSX() wrote an invalid zip: %v", err)
+	}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("could not open %s: %v", f.Name, err)
+		}
+		decoder := xml.NewDecoder(rc)
+		for {
+			if _, err = decoder.Token(); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("WriteXLSX() wrote invalid XML in %s: %v", f.Name, err)
+		}
+		_ = rc.Close()
+	}
+}
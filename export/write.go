@@ -0,0 +1,130 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// format is an output format and the file it is written to
+type format struct {
+	fileName string
+	write    func(w io.Writer, doc *Document) error
+}
+
+// formats are every output format that can be selected with --output-format
+var formats = map[string]format{
+	"json":  {fileName: "results.json", write: WriteJSON},
+	"jsonl": {fileName: "services.jsonl", write: WriteJSONL},
+	"csv":   {fileName: "services.csv", write: WriteCSV},
+	"xlsx":  {fileName: "services.xlsx", write: WriteXLSX},
+}
+
+// Formats returns the names of every supported output format
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateFormats returns an error for the first output format that is not supported
+func ValidateFormats(names []string) error {
+	for _, name := range names {
+		if _, ok := formats[strings.ToLower(strings.TrimSpace(name))]; !ok {
+			return fmt.Errorf("unsupported output format %q, supported formats are %s", name, strings.Join(Formats(), ", "))
+		}
+	}
+	return nil
+}
+
+// Write writes doc into outputDir in every one of the formats and returns the files written
+func Write(outputDir string, doc *Document, names []string) ([]string, error) {
+	if err := ValidateFormats(names); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, 0750); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range names {
+		f := formats[strings.ToLower(strings.TrimSpace(name))]
+		path := filepath.Join(outputDir, f.fileName)
+		if err := writeFile(path, doc, f.write); err != nil {
+			return files, fmt.Errorf("could not write %s: %w", path, err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// writeFile writes doc to path with the write func of a format
+func writeFile(path string, doc *Document, write func(w io.Writer, doc *Document) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err = write(w, doc); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteJSON writes doc as a single indented JSON document
+func WriteJSON(w io.Writer, doc *Document) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// ReadJSON reads a document written by WriteJSON, documents of another major schema version are refused
+func ReadJSON(r io.Reader) (*Document, error) {
+	doc := &Document{}
+	if err := json.NewDecoder(r).Decode(doc); err != nil {
+		return nil, err
+	}
+	major, _, _ := strings.Cut(SchemaVersion, ".")
+	if docMajor, _, _ := strings.Cut(doc.SchemaVersion, "."); docMajor != major {
+		return nil, fmt.Errorf("unsupported schema version %q, goforit reads version %s", doc.SchemaVersion, SchemaVersion)
+	}
+	return doc, nil
+}
+
+// ReadResults reads the results.json document exported into outputDir
+func ReadResults(outputDir string) (*Document, error) {
+	path := filepath.Join(outputDir, formats["json"].fileName)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := ReadJSON(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// WriteJSONL writes one JSON Service per line
+func WriteJSONL(w io.Writer, doc *Document) error {
+	encoder := json.NewEncoder(w)
+	for _, service := range doc.Services() {
+		if err := encoder.Encode(service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
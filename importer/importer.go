@@ -0,0 +1,107 @@
+/*
+Package importer
+
+Copyright © 2023 MrPMillz
+*/
+package importer
+
+import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+// Options are the options of the import command
+type Options struct {
+	Paths        []string
+	Output       string
+	OutputFormat []string
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	cmd.PersistentFlags().StringP("output", "o", "", "directory to write the merged inventory to")
+	cmd.PersistentFlags().StringP("output-format", "", "", fmt.Sprintf("comma separated list of formats to export the merged inventory as, defaults to json,jsonl,csv. Supported formats: %s", strings.Join(export.Formats(), ", ")))
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	for _, arg := range args {
+		path, err := utils.ResolveAbsPath(arg)
+		if err != nil {
+			return err
+		}
+		opts.Paths = append(opts.Paths, path)
+	}
+
+	output, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "output",
+		IsFilePath: true,
+		Opts:       opts.Output,
+	})
+	if err != nil {
+		return err
+	}
+	opts.Output = output.(string)
+	if opts.Output == "" {
+		return fmt.Errorf("an output directory is required, set it with --output")
+	}
+
+	outputFormat, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "output-format",
+		DefaultFlagVal:       "json,jsonl,csv",
+		Opts:                 opts.OutputFormat,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch outputFormat := outputFormat.(type) {
+	case []string:
+		opts.OutputFormat = outputFormat
+	case string:
+		opts.OutputFormat = strings.Split(outputFormat, ",")
+	}
+	return export.ValidateFormats(opts.OutputFormat)
+}
+
+// Run merges the nmap XML files of opts.Paths into one inventory and exports it to opts.Output
+func Run(opts *Options) (*export.Document, error) {
+	results, err := runner.ImportResults(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	doc := results.Document
+	fmt.Printf("Imported %d nmap runs: %d hosts and %d open ports\n", results.Runs, len(doc.Hosts), len(doc.OpenServices()))
+	if len(results.Partial) > 0 || len(results.Corrupt) > 0 {
+		fmt.Printf("%d truncated file(s) were imported up to the cut, %d corrupt file(s) were skipped\n", len(results.Partial), len(results.Corrupt))
+	}
+
+	// report and diff read the inventory from its results.json
+	formats := opts.OutputFormat
+	if !hasFormat(formats, "json") {
+		formats = append([]string{"json"}, formats...)
+	}
+	files, err := export.Write(opts.Output, doc, formats)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		fmt.Printf("Wrote %s\n", f)
+	}
+	return doc, nil
+}
+
+// hasFormat reports whether formats contains the output format name
+func hasFormat(formats []string, name string) bool {
+	for _, format := range formats {
+		if strings.EqualFold(strings.TrimSpace(format), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,12 +6,24 @@ Copyright © 2023 MrPMillz
 package main
 
 import (
+	"context"
 	"github.com/mr-pmillz/goforit/cmd"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	if err := cmd.RootCmd.Execute(); err != nil {
+	// the root context is cancelled on SIGINT/SIGTERM and passed down to every scan phase
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// restore the default signal handling so that a second Ctrl-C exits immediately
+		<-ctx.Done()
+		stop()
+	}()
+	if err := cmd.RootCmd.ExecuteContext(ctx); err != nil {
 		log.Fatalf("error running root command:\n%+v\n", err)
 	}
 }
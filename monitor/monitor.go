@@ -0,0 +1,309 @@
+/*
+Package monitor
+
+Copyright © 2023 MrPMillz
+*/
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/diff"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/store"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// historyFile records every run of a monitor, one JSON record per line
+	historyFile = "history.jsonl"
+	// changesFile is the comparison of a run to the run before, written into the run directory
+	changesFile = "changes.json"
+	// runDirFormat names the output directory of every run after its start time
+	runDirFormat = "20060102T150405Z"
+)
+
+// Monitor is a scope that is scanned again on a schedule, defined under MONITORS in config.yaml.
+// Settings a monitor does not set are taken from the scan flags and config.yaml.
+type Monitor struct {
+	Name string `mapstructure:"-"`
+	// Schedule is a cron expression, a macro such as @daily or an interval such as "@every 6h", see ParseSchedule
+	Schedule string `mapstructure:"schedule"`
+	// Interval runs the monitor every fixed duration instead of Schedule
+	Interval time.Duration `mapstructure:"interval"`
+	// Target are the targets to scan, a single target can be a file of targets
+	Target []string `mapstructure:"target"`
+	// Exclude are out of scope IPs, CIDRs, ranges or hostnames
+	Exclude     []string `mapstructure:"exclude"`
+	ExcludeFile string   `mapstructure:"exclude_file"`
+	Profile     string   `mapstructure:"profile"`
+	// Ports is a port specification or a file of them, see ports.Parse
+	Ports   string   `mapstructure:"ports"`
+	Engines []string `mapstructure:"engines"`
+	UDP     bool     `mapstructure:"udp"`
+
+	schedule Schedule
+	scan     *runner.Options
+}
+
+// Record is a single run of a monitor in its history
+type Record struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Output is the scan output directory of the run
+	Output    string `json:"output"`
+	Hosts     int    `json:"hosts"`
+	OpenPorts int    `json:"open_ports"`
+	// Baseline is the output directory of the run this run was compared to, empty for the first run
+	Baseline string   `json:"baseline,omitempty"`
+	Changes  *Changes `json:"changes,omitempty"`
+	// Error is why the run failed, failed runs are never the baseline of a later run
+	Error string `json:"error,omitempty"`
+}
+
+// Changes counts the differences of a run to its baseline, changes.json in the run directory has the details
+type Changes struct {
+	NewHosts       int `json:"new_hosts"`
+	RemovedHosts   int `json:"removed_hosts"`
+	OpenedPorts    int `json:"opened_ports"`
+	ClosedPorts    int `json:"closed_ports"`
+	ServiceChanges int `json:"service_changes"`
+}
+
+// LoadMonitors returns the MONITORS of config.yaml sorted by name. Every monitor is validated and its scan options are
+// derived from base, the options loaded from the scan flags and config.yaml.
+func LoadMonitors(base *runner.Options) ([]*Monitor, error) {
+	configured := make(map[string]*Monitor)
+	if err := viper.UnmarshalKey("MONITORS", &configured); err != nil {
+		return nil, fmt.Errorf("could not read MONITORS from config.yaml: %w", err)
+	}
+	monitors := make([]*Monitor, 0, len(configured))
+	for name, m := range configured {
+		if m == nil {
+			m = &Monitor{}
+		}
+		m.Name = strings.ToLower(name)
+		if err := m.load(base); err != nil {
+			return nil, fmt.Errorf("invalid monitor %s: %w", m.Name, err)
+		}
+		monitors = append(monitors, m)
+	}
+	sort.Slice(monitors, func(i, j int) bool { return monitors[i].Name < monitors[j].Name })
+	return monitors, nil
+}
+
+// load parses the schedule of the monitor and derives its scan options from base
+func (m *Monitor) load(base *runner.Options) error {
+	var err error
+	switch {
+	case m.Schedule != "" && m.Interval != 0:
+		return errors.New("set either schedule or interval, not both")
+	case m.Schedule != "":
+		m.schedule, err = ParseSchedule(m.Schedule)
+	case m.Interval != 0:
+		m.schedule, err = NewInterval(m.Interval)
+	default:
+		return errors.New("schedule or interval is required")
+	}
+	if err != nil {
+		return err
+	}
+	if len(m.Target) == 0 {
+		return errors.New("target is required")
+	}
+
+	opts := *base
+	// a single target is passed on as a string so that it can be a file of targets
+	opts.Target = m.Target
+	if len(m.Target) == 1 {
+		opts.Target = m.Target[0]
+	}
+	if len(m.Exclude) > 0 {
+		opts.Exclude = m.Exclude
+	}
+	if m.ExcludeFile != "" {
+		opts.ExcludeFile = m.ExcludeFile
+	}
+	if m.Profile != "" {
+		if opts.Profile, err = runner.LoadProfile(m.Profile); err != nil {
+			return err
+		}
+	}
+	if m.Ports != "" {
+		if opts.Ports, err = runner.ParsePorts(m.Ports); err != nil {
+			return err
+		}
+	}
+	if len(m.Engines) > 0 {
+		opts.Engines = m.Engines
+		if err = runner.ValidateEngines(opts.Engines); err != nil {
+			return err
+		}
+	}
+	if m.UDP && !opts.UDP {
+		opts.UDP = true
+		if opts.UDPProfile, err = runner.LoadUDPProfile(runner.DefaultUDPProfile, 0); err != nil {
+			return err
+		}
+	}
+	// every run starts from scratch in its own output directory, the runs of a monitor share one results database
+	opts.Resume = false
+	opts.Output = m.dir(base.Output)
+	opts.Database = store.Path(opts.Output)
+	m.scan = &opts
+	return nil
+}
+
+// dir returns the directory of the monitor below the monitor output directory
+func (m *Monitor) dir(output string) string {
+	return filepath.Join(output, m.Name)
+}
+
+// Next returns when the monitor runs next after after
+func (m *Monitor) Next(after time.Time) time.Time {
+	return m.schedule.Next(after)
+}
+
+// RunOnce scans the monitor into a new run directory, compares the results to the last successful run and records
+// the run in the history of the monitor. The returned report is nil for the first run of a monitor.
+func (m *Monitor) RunOnce(ctx context.Context) (*Record, *diff.Report, error) {
+	started := time.Now().UTC()
+	record := &Record{StartedAt: started, Output: filepath.Join(m.scan.Output, started.Format(runDirFormat))}
+	report, err := m.scanAndCompare(ctx, record)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.FinishedAt = time.Now().UTC()
+	if err := appendRecord(m.scan.Output, record); err != nil {
+		return record, report, err
+	}
+	return record, report, err
+}
+
+func (m *Monitor) scanAndCompare(ctx context.Context, record *Record) (*diff.Report, error) {
+	baseline, err := lastSuccessfulRun(m.scan.Output)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(record.Output, 0750); err != nil {
+		return nil, err
+	}
+	opts := *m.scan
+	opts.Output = record.Output
+	hosts, err := runner.NewTargets(&opts)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Monitor %s: %s\n", m.Name, hosts.Counts)
+	scanErr := hosts.Scanner(ctx, &opts)
+
+	results, err := runner.LoadResults(record.Output)
+	if err != nil {
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		return nil, err
+	}
+	record.Hosts, record.OpenPorts = len(results.Document.Hosts), len(results.Document.OpenServices())
+	if baseline == nil {
+		return nil, scanErr
+	}
+
+	previous, err := runner.LoadResults(baseline.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the baseline %s: %w", baseline.Output, err)
+	}
+	report := diff.Compare(baseline.Output, previous.Document, record.Output, results.Document)
+	record.Baseline = baseline.Output
+	record.Changes = &Changes{
+		NewHosts:       len(report.NewHosts),
+		RemovedHosts:   len(report.RemovedHosts),
+		OpenedPorts:    len(report.OpenedPorts),
+		ClosedPorts:    len(report.ClosedPorts),
+		ServiceChanges: len(report.ServiceChanges),
+	}
+	f, err := os.OpenFile(filepath.Join(record.Output, changesFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+	if err = report.WriteJSON(f); err != nil {
+		return report, err
+	}
+	return report, scanErr
+}
+
+// History returns every recorded run of the monitor, oldest first
+func (m *Monitor) History() ([]*Record, error) {
+	return readHistory(m.scan.Output)
+}
+
+// readHistory reads the history of the monitor directory dir, a missing history is empty
+func readHistory(dir string) ([]*Record, error) {
+	f, err := os.Open(filepath.Join(dir, historyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		record := &Record{}
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filepath.Join(dir, historyFile), line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// lastSuccessfulRun returns the last run of the monitor directory dir that did not fail, nil when there is none
+func lastSuccessfulRun(dir string) (*Record, error) {
+	records, err := readHistory(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Error == "" {
+			return records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// appendRecord appends record to the history of the monitor directory dir
+func appendRecord(dir string, record *Record) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, historyFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
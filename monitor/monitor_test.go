@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"context"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoadMonitors(t *testing.T) {
+	tests := []struct {
+		name     string
+		monitors map[string]interface{}
+		wantErr  bool
+	}{
+		{"Valid", map[string]interface{}{
+			"DMZ": map[string]interface{}{"schedule": "0 2 * * *", "target": []string{"10.0.0.1", "10.0.0.2"}, "profile": "quick"},
+			"vpn": map[string]interface{}{"interval": "6h", "target": "targets.txt", "engines": []string{"connect"}, "ports": "top:100"},
+		}, false},
+		{"No Schedule", map[string]interface{}{"dmz": map[string]interface{}{"target": "10.0.0.1"}}, true},
+		{"Schedule And Interval", map[string]interface{}{"dmz": map[string]interface{}{"schedule": "@daily", "interval": "1h", "target": "10.0.0.1"}}, true},
+		{"No Target", map[string]interface{}{"dmz": map[string]interface{}{"schedule": "@daily"}}, true},
+		{"Bad Schedule", map[string]interface{}{"dmz": map[string]interface{}{"schedule": "daily", "target": "10.0.0.1"}}, true},
+		{"Unknown Profile", map[string]interface{}{"dmz": map[string]interface{}{"schedule": "@daily", "target": "10.0.0.1", "profile": "nope"}}, true},
+		{"Unknown Engine", map[string]interface{}{"dmz": map[string]interface{}{"schedule": "@daily", "target": "10.0.0.1", "engines": "nope"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("MONITORS", tt.monitors)
+			defer viper.Set("MONITORS", nil)
+
+			base := &runner.Options{Output: "/tmp/monitors", Engines: []string{"nmap"}}
+			monitors, err := LoadMonitors(base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMonitors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(monitors) != 2 || monitors[0].Name != "dmz" || monitors[1].Name != "vpn" {
+				t.Fatalf("LoadMonitors() got %d monitors, want dmz and vpn", len(monitors))
+			}
+			dmz, vpn := monitors[0], monitors[1]
+			if dmz.scan.Profile.Name != "quick" || dmz.scan.Output != "/tmp/monitors/dmz" || dmz.scan.Database != "/tmp/monitors/dmz/results.db" {
+				t.Errorf("dmz scan options got profile %s, output %s, database %s", dmz.scan.Profile.Name, dmz.scan.Output, dmz.scan.Database)
+			}
+			if targets, ok := dmz.scan.Target.([]string); !ok || len(targets) != 2 {
+				t.Errorf("dmz target got = %v, want both targets", dmz.scan.Target)
+			}
+			if target, ok := vpn.scan.Target.(string); !ok || target != "targets.txt" {
+				t.Errorf("vpn target got = %v, want targets.txt", vpn.scan.Target)
+			}
+			if vpn.Interval != 6*time.Hour || vpn.scan.Engines[0] != "connect" || vpn.scan.Ports == nil {
+				t.Errorf("vpn got interval %s, engines %v, ports %v", vpn.Interval, vpn.scan.Engines, vpn.scan.Ports)
+			}
+			if base.Output != "/tmp/monitors" || base.Engines[0] != "nmap" {
+				t.Errorf("LoadMonitors() changed the base options")
+			}
+		})
+	}
+}
+
+func TestLastSuccessfulRun(t *testing.T) {
+	dir := t.TempDir()
+	if record, err := lastSuccessfulRun(dir); err != nil || record != nil {
+		t.Fatalf("lastSuccessfulRun() of an empty history got = %v, %v", record, err)
+	}
+	for _, record := range []*Record{{Output: "first"}, {Output: "second"}, {Output: "third", Error: "scan failed"}} {
+		if err := appendRecord(dir, record); err != nil {
+			t.Fatalf("appendRecord() error = %v", err)
+		}
+	}
+	record, err := lastSuccessfulRun(dir)
+	if err != nil {
+		t.Fatalf("lastSuccessfulRun() error = %v", err)
+	}
+	if record == nil || record.Output != "second" {
+		t.Errorf("lastSuccessfulRun() got = %v, want second", record)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstPort, secondPort := first.Addr().(*net.TCPAddr).Port, second.Addr().(*net.TCPAddr).Port
+	// the second port is closed during the first run
+	if err = second.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := runner.LoadProfile(runner.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, err := runner.ParsePorts(strconv.Itoa(firstPort) + "," + strconv.Itoa(secondPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Monitor{Name: "local", Interval: time.Hour, Target: []string{"127.0.0.1"}}
+	base := &runner.Options{
+		Output:             t.TempDir(),
+		OutputFormat:       []string{"json"},
+		Threads:            2,
+		MaxParallelHosts:   2,
+		MaxAttempts:        1,
+		Profile:            profile,
+		Ports:              ports,
+		Engines:            []string{"connect"},
+		ConnectConcurrency: 4,
+		ConnectTimeout:     time.Second,
+	}
+	if err = m.load(base); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	record, report, err := m.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if report != nil || record.OpenPorts != 1 {
+		t.Fatalf("first RunOnce() got %d open ports and report %v, want 1 open port and no report", record.OpenPorts, report)
+	}
+
+	// run directories are named by the second the run started
+	time.Sleep(time.Second)
+	second, err = net.Listen("tcp", second.Addr().String())
+	if err != nil {
+		t.Skipf("could not listen on port %d again: %v", secondPort, err)
+	}
+	defer second.Close()
+
+	record, report, err = m.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if report == nil || len(report.OpenedPorts) != 1 || report.OpenedPorts[0].Port != secondPort {
+		t.Fatalf("second RunOnce() report got = %+v, want port %d opened", report, secondPort)
+	}
+	if record.Changes == nil || record.Changes.OpenedPorts != 1 || record.Baseline == "" {
+		t.Errorf("second RunOnce() record got = %+v", record)
+	}
+	if _, err = os.Stat(filepath.Join(record.Output, changesFile)); err != nil {
+		t.Errorf("second RunOnce() did not write %s: %v", changesFile, err)
+	}
+	history, err := m.History()
+	if err != nil || len(history) != 2 {
+		t.Errorf("History() got %d records, error %v, want 2", len(history), err)
+	}
+}
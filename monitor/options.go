@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options are the options of the monitor command
+type Options struct {
+	// Scan are the scan options every monitor starts from, Output is the directory of every monitor
+	Scan runner.Options
+	// Monitors are the names of the monitors to run, empty runs every monitor in config.yaml
+	Monitors []string
+	// Once runs every monitor a single time and returns instead of following the schedules
+	Once bool
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	if err := runner.ConfigureCommand(cmd); err != nil {
+		return err
+	}
+	cmd.PersistentFlags().StringP("monitors", "", "", "comma separated list of the MONITORS in config.yaml to run, defaults to every monitor")
+	cmd.PersistentFlags().BoolP("once", "", false, "run every monitor once right away and exit instead of following the schedules")
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
+	if err := opts.Scan.LoadFromCommand(cmd); err != nil {
+		return err
+	}
+	if opts.Scan.Output == "" {
+		return errors.New("OUTPUT config.yaml value cannot be empty")
+	}
+
+	monitors, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "monitors",
+		Opts:                 opts.Monitors,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch monitors := monitors.(type) {
+	case []string:
+		opts.Monitors = monitors
+	case string:
+		if monitors != "" {
+			opts.Monitors = strings.Split(monitors, ",")
+		}
+	}
+	for i, name := range opts.Monitors {
+		opts.Monitors[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+
+	if opts.Once, err = cmd.Flags().GetBool("once"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Run loads the monitors selected by opts and runs them on their schedules until ctx is cancelled
+func Run(ctx context.Context, opts *Options) error {
+	monitors, err := selectMonitors(&opts.Scan, opts.Monitors)
+	if err != nil {
+		return err
+	}
+	if opts.Once {
+		for _, m := range monitors {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			runMonitor(ctx, m)
+		}
+		return nil
+	}
+
+	next := make(map[*Monitor]time.Time, len(monitors))
+	for _, m := range monitors {
+		next[m] = m.Next(time.Now())
+		log.Printf("Monitor %s runs next at %s\n", m.Name, next[m].Format(time.RFC1123))
+	}
+	for {
+		due, at := nextDue(monitors, next)
+		if at.IsZero() {
+			return errors.New("no monitor is scheduled to run again")
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		// monitors run one after another so that they never scan at the same time
+		for _, m := range due {
+			if ctx.Err() != nil {
+				return nil
+			}
+			runMonitor(ctx, m)
+			next[m] = m.Next(time.Now())
+			log.Printf("Monitor %s runs next at %s\n", m.Name, next[m].Format(time.RFC1123))
+		}
+	}
+}
+
+// selectMonitors loads the monitors of config.yaml and returns the ones named in names, every monitor when names is empty
+func selectMonitors(base *runner.Options, names []string) ([]*Monitor, error) {
+	monitors, err := LoadMonitors(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(monitors) == 0 {
+		return nil, errors.New("no MONITORS are defined in config.yaml")
+	}
+	if len(names) == 0 {
+		return monitors, nil
+	}
+	byName := make(map[string]*Monitor, len(monitors))
+	for _, m := range monitors {
+		byName[m.Name] = m
+	}
+	selected := make([]*Monitor, 0, len(names))
+	for _, name := range names {
+		m, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown monitor %q", name)
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// nextDue returns the monitors that run at the earliest next run time and that time, the zero time when none runs again
+func nextDue(monitors []*Monitor, next map[*Monitor]time.Time) ([]*Monitor, time.Time) {
+	var due []*Monitor
+	var at time.Time
+	for _, m := range monitors {
+		t := next[m]
+		switch {
+		case t.IsZero():
+		case at.IsZero() || t.Before(at):
+			due, at = []*Monitor{m}, t
+		case t.Equal(at):
+			due = append(due, m)
+		}
+	}
+	return due, at
+}
+
+// runMonitor runs m once and prints the changes to the run before. A failed run is logged, the monitor keeps running.
+func runMonitor(ctx context.Context, m *Monitor) {
+	log.Printf("Running monitor %s\n", m.Name)
+	record, report, err := m.RunOnce(ctx)
+	if err != nil {
+		log.Printf("Monitor %s failed: %+v\n", m.Name, err)
+		return
+	}
+	log.Printf("Monitor %s found %d host(s) with %d open port(s) in %s\n", m.Name, record.Hosts, record.OpenPorts, record.Output)
+	if report == nil {
+		log.Printf("Monitor %s has no earlier run to compare to\n", m.Name)
+		return
+	}
+	if err = report.WriteText(os.Stdout); err != nil {
+		log.Printf("Could not print the changes of monitor %s: %+v\n", m.Name, err)
+	}
+}
@@ -0,0 +1,192 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a monitor runs
+type Schedule interface {
+	// Next returns the first time after after that the monitor runs
+	Next(after time.Time) time.Time
+}
+
+// macros are the cron expressions of the @ shortcuts
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronFields are the fields of a cron expression in order with their ranges and names
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday as well
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// ParseSchedule parses a standard five field cron expression such as "0 3 * * 1-5", a macro such as @daily
+// or a fixed interval such as "@every 6h". Cron expressions are evaluated in the local time zone.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		return NewInterval(interval)
+	}
+	if expression, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expression
+	}
+	return parseCron(spec)
+}
+
+// interval runs a monitor every fixed duration
+type interval time.Duration
+
+// NewInterval returns a Schedule that runs a monitor every d, d has to be at least a minute
+func NewInterval(d time.Duration) (Schedule, error) {
+	if d < time.Minute {
+		return nil, fmt.Errorf("interval %s is shorter than a minute", d)
+	}
+	return interval(d), nil
+}
+
+// Next ...
+func (i interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+// cron is a parsed cron expression, every field is a bit set of the values it matches
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set for day fields starting with *, see matchesDay
+	domAny, dowAny bool
+}
+
+func parseCron(spec string) (*cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: a cron expression has 5 fields, minute hour day-of-month month day-of-week", spec)
+	}
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseField(strings.ToLower(field), i)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	c := &cron{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4], domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*")}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps such as 1,15 or 9-17 or */5 of the ith field
+func parseField(field string, i int) (uint64, error) {
+	spec := cronFields[i]
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepValue, spec.name)
+			}
+		}
+		low, high := spec.min, spec.max
+		switch {
+		case valueRange == "*":
+		case strings.Contains(valueRange, "-"):
+			lowValue, highValue, _ := strings.Cut(valueRange, "-")
+			var err error
+			if low, err = parseValue(lowValue, i); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(highValue, i); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in %s field", valueRange, spec.name)
+			}
+		default:
+			value, err := parseValue(valueRange, i)
+			if err != nil {
+				return 0, err
+			}
+			low = value
+			// a single value with a step such as 5/15 runs from the value to the end of the range
+			if !hasStep {
+				high = value
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// parseValue parses a number or a month or weekday name of the ith field
+func parseValue(value string, i int) (int, error) {
+	spec := cronFields[i]
+	for n, name := range spec.names {
+		if value == name {
+			return n + spec.min, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, use %d-%d", value, spec.name, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+// Next returns the first minute after after that matches every field, the zero time when none does within five years
+func (c *cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether t matches the day fields. Like cron a day matches either field when both are restricted.
+func (c *cron) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// Wednesday
+	after := time.Date(2023, time.March, 15, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"Every", "@every 6h", after.Add(6 * time.Hour), false},
+		{"Daily", "@daily", time.Date(2023, time.March, 16, 0, 0, 0, 0, time.Local), false},
+		{"Hourly", "@hourly", time.Date(2023, time.March, 15, 11, 0, 0, 0, time.Local), false},
+		{"Monthly", "@monthly", time.Date(2023, time.April, 1, 0, 0, 0, 0, time.Local), false},
+		{"Every Minute", "* * * * *", time.Date(2023, time.March, 15, 10, 31, 0, 0, time.Local), false},
+		{"Step", "*/20 * * * *", time.Date(2023, time.March, 15, 10, 40, 0, 0, time.Local), false},
+		{"Later Today", "45 10 * * *", time.Date(2023, time.March, 15, 10, 45, 0, 0, time.Local), false},
+		{"Tomorrow", "0 3 * * *", time.Date(2023, time.March, 16, 3, 0, 0, 0, time.Local), false},
+		{"Weekdays", "0 9 * * mon-fri", time.Date(2023, time.March, 16, 9, 0, 0, 0, time.Local), false},
+		{"Sunday As 7", "0 9 * * 7", time.Date(2023, time.March, 19, 9, 0, 0, 0, time.Local), false},
+		{"List", "0 8,20 * * *", time.Date(2023, time.March, 15, 20, 0, 0, 0, time.Local), false},
+		{"Month Name", "0 0 1 jun *", time.Date(2023, time.June, 1, 0, 0, 0, 0, time.Local), false},
+		{"Day Of Month Or Week", "0 0 20 * fri", time.Date(2023, time.March, 17, 0, 0, 0, 0, time.Local), false},
+		{"Leap Day", "0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.Local), false},
+		{"Too Few Fields", "0 3 * *", time.Time{}, true},
+		{"Out Of Range", "60 * * * *", time.Time{}, true},
+		{"Bad Range", "0 17-9 * * *", time.Time{}, true},
+		{"Bad Step", "*/0 * * * *", time.Time{}, true},
+		{"Bad Name", "0 0 * * funday", time.Time{}, true},
+		{"Short Interval", "@every 30s", time.Time{}, true},
+		{"Bad Interval", "@every often", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNever(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule() error = %v", err)
+	}
+	if got := schedule.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next() got = %s, want the zero time", got)
+	}
+}
@@ -0,0 +1,408 @@
+/*
+Package nmapxml
+
+Copyright © 2023 MrPMillz
+*/
+package nmapxml
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run is the root <nmaprun> element of an nmap XML output file
+type Run struct {
+	XMLName          xml.Name   `xml:"nmaprun" json:"-"`
+	Scanner          string     `xml:"scanner,attr" json:"scanner"`
+	Args             string     `xml:"args,attr" json:"args"`
+	Start            Timestamp  `xml:"start,attr" json:"start"`
+	StartStr         string     `xml:"startstr,attr" json:"start_str"`
+	Version          string     `xml:"version,attr" json:"version"`
+	XMLOutputVersion string     `xml:"xmloutputversion,attr" json:"xml_output_version"`
+	ScanInfo         []ScanInfo `xml:"scaninfo" json:"scan_info"`
+	Verbose          Level      `xml:"verbose" json:"verbose"`
+	Debugging        Level      `xml:"debugging" json:"debugging"`
+	PreScripts       []Script   `xml:"prescript>script" json:"pre_scripts,omitempty"`
+	Hosts            []Host     `xml:"host" json:"hosts"`
+	PostScripts      []Script   `xml:"postscript>script" json:"post_scripts,omitempty"`
+	RunStats         RunStats   `xml:"runstats" json:"run_stats"`
+}
+
+// ScanInfo describes the scan type and ports scanned for a protocol
+type ScanInfo struct {
+	Type        string `xml:"type,attr" json:"type"`
+	Protocol    string `xml:"protocol,attr" json:"protocol"`
+	NumServices int    `xml:"numservices,attr" json:"num_services"`
+	Services    string `xml:"services,attr" json:"services"`
+	ScanFlags   string `xml:"scanflags,attr" json:"scan_flags,omitempty"`
+}
+
+// Level is the verbosity or debugging level nmap ran with
+type Level struct {
+	Level int `xml:"level,attr" json:"level"`
+}
+
+// Host is a single scanned host
+type Host struct {
+	StartTime     Timestamp    `xml:"starttime,attr" json:"start_time"`
+	EndTime       Timestamp    `xml:"endtime,attr" json:"end_time"`
+	Comment       string       `xml:"comment,attr" json:"comment,omitempty"`
+	Status        Status       `xml:"status" json:"status"`
+	Addresses     []Address    `xml:"address" json:"addresses"`
+	Hostnames     []Hostname   `xml:"hostnames>hostname" json:"hostnames,omitempty"`
+	ExtraPorts    []ExtraPorts `xml:"ports>extraports" json:"extra_ports,omitempty"`
+	Ports         []Port       `xml:"ports>port" json:"ports,omitempty"`
+	OS            OS           `xml:"os" json:"os"`
+	Uptime        Uptime       `xml:"uptime" json:"uptime"`
+	Distance      Distance     `xml:"distance" json:"distance"`
+	TCPSequence   TCPSequence  `xml:"tcpsequence" json:"tcp_sequence"`
+	IPIDSequence  Sequence     `xml:"ipidsequence" json:"ip_id_sequence"`
+	TCPTSSequence Sequence     `xml:"tcptssequence" json:"tcp_ts_sequence"`
+	HostScripts   []Script     `xml:"hostscript>script" json:"host_scripts,omitempty"`
+	Trace         Trace        `xml:"trace" json:"trace"`
+	Times         Times        `xml:"times" json:"times"`
+}
+
+// Status is the up/down state of a host
+type Status struct {
+	State     string `xml:"state,attr" json:"state"`
+	Reason    string `xml:"reason,attr" json:"reason"`
+	ReasonTTL int    `xml:"reason_ttl,attr" json:"reason_ttl"`
+}
+
+// Address is an ipv4, ipv6 or mac address of a host
+type Address struct {
+	Addr     string `xml:"addr,attr" json:"addr"`
+	AddrType string `xml:"addrtype,attr" json:"addr_type"`
+	Vendor   string `xml:"vendor,attr" json:"vendor,omitempty"`
+}
+
+// Hostname is a user supplied or PTR hostname of a host
+type Hostname struct {
+	Name string `xml:"name,attr" json:"name"`
+	Type string `xml:"type,attr" json:"type"`
+}
+
+// ExtraPorts summarizes ports that were not listed individually
+type ExtraPorts struct {
+	State   string   `xml:"state,attr" json:"state"`
+	Count   int      `xml:"count,attr" json:"count"`
+	Reasons []Reason `xml:"extrareasons" json:"reasons,omitempty"`
+}
+
+// Reason is the reason and count of extra ports in a state
+type Reason struct {
+	Reason string `xml:"reason,attr" json:"reason"`
+	Count  int    `xml:"count,attr" json:"count"`
+	Proto  string `xml:"proto,attr" json:"proto,omitempty"`
+	Ports  string `xml:"ports,attr" json:"ports,omitempty"`
+}
+
+// Port is a single scanned port of a host
+type Port struct {
+	Protocol string   `xml:"protocol,attr" json:"protocol"`
+	PortID   int      `xml:"portid,attr" json:"port_id"`
+	State    State    `xml:"state" json:"state"`
+	Owner    Owner    `xml:"owner" json:"owner"`
+	Service  Service  `xml:"service" json:"service"`
+	Scripts  []Script `xml:"script" json:"scripts,omitempty"`
+}
+
+// State is the state of a port and why nmap thinks so
+type State struct {
+	State     string `xml:"state,attr" json:"state"`
+	Reason    string `xml:"reason,attr" json:"reason"`
+	ReasonTTL int    `xml:"reason_ttl,attr" json:"reason_ttl"`
+	ReasonIP  string `xml:"reason_ip,attr" json:"reason_ip,omitempty"`
+}
+
+// Owner is the user running a service, as reported by ident
+type Owner struct {
+	Name string `xml:"name,attr" json:"name,omitempty"`
+}
+
+// Service is the service nmap detected on a port
+type Service struct {
+	Name       string   `xml:"name,attr" json:"name"`
+	Product    string   `xml:"product,attr" json:"product,omitempty"`
+	Version    string   `xml:"version,attr" json:"version,omitempty"`
+	ExtraInfo  string   `xml:"extrainfo,attr" json:"extra_info,omitempty"`
+	Hostname   string   `xml:"hostname,attr" json:"hostname,omitempty"`
+	OSType     string   `xml:"ostype,attr" json:"os_type,omitempty"`
+	DeviceType string   `xml:"devicetype,attr" json:"device_type,omitempty"`
+	Tunnel     string   `xml:"tunnel,attr" json:"tunnel,omitempty"`
+	Proto      string   `xml:"proto,attr" json:"proto,omitempty"`
+	Method     string   `xml:"method,attr" json:"method"`
+	Conf       int      `xml:"conf,attr" json:"conf"`
+	ServiceFP  string   `xml:"servicefp,attr" json:"service_fp,omitempty"`
+	CPEs       []string `xml:"cpe" json:"cpes,omitempty"`
+}
+
+// Script is the output of an NSE script. Structured output is kept in Elements and nested Tables.
+type Script struct {
+	ID       string    `xml:"id,attr" json:"id"`
+	Output   string    `xml:"output,attr" json:"output"`
+	Elements []Element `xml:"elem" json:"elements,omitempty"`
+	Tables   []Table   `xml:"table" json:"tables,omitempty"`
+}
+
+// Table is a <table> of NSE structured output. Tables can be nested.
+type Table struct {
+	Key      string    `xml:"key,attr" json:"key,omitempty"`
+	Elements []Element `xml:"elem" json:"elements,omitempty"`
+	Tables   []Table   `xml:"table" json:"tables,omitempty"`
+}
+
+// Element is a single <elem> key value pair of NSE structured output
+type Element struct {
+	Key   string `xml:"key,attr" json:"key,omitempty"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// OS holds the OS detection results of a host
+type OS struct {
+	PortsUsed      []PortUsed      `xml:"portused" json:"ports_used,omitempty"`
+	OSMatches      []OSMatch       `xml:"osmatch" json:"os_matches,omitempty"`
+	OSFingerprints []OSFingerprint `xml:"osfingerprint" json:"os_fingerprints,omitempty"`
+}
+
+// PortUsed is a port nmap used for OS detection
+type PortUsed struct {
+	State  string `xml:"state,attr" json:"state"`
+	Proto  string `xml:"proto,attr" json:"proto"`
+	PortID int    `xml:"portid,attr" json:"port_id"`
+}
+
+// OSMatch is a single OS guess with its classes
+type OSMatch struct {
+	Name      string    `xml:"name,attr" json:"name"`
+	Accuracy  int       `xml:"accuracy,attr" json:"accuracy"`
+	Line      int       `xml:"line,attr" json:"line"`
+	OSClasses []OSClass `xml:"osclass" json:"os_classes,omitempty"`
+}
+
+// OSClass is the vendor, family and generation of an OS match
+type OSClass struct {
+	Type     string   `xml:"type,attr" json:"type"`
+	Vendor   string   `xml:"vendor,attr" json:"vendor"`
+	OSFamily string   `xml:"osfamily,attr" json:"os_family"`
+	OSGen    string   `xml:"osgen,attr" json:"os_gen,omitempty"`
+	Accuracy int      `xml:"accuracy,attr" json:"accuracy"`
+	CPEs     []string `xml:"cpe" json:"cpes,omitempty"`
+}
+
+// OSFingerprint is the raw OS fingerprint submitted to nmap
+type OSFingerprint struct {
+	Fingerprint string `xml:"fingerprint,attr" json:"fingerprint"`
+}
+
+// Uptime is the uptime guess of a host
+type Uptime struct {
+	Seconds  int    `xml:"seconds,attr" json:"seconds"`
+	LastBoot string `xml:"lastboot,attr" json:"last_boot,omitempty"`
+}
+
+// Distance is the number of network hops to a host
+type Distance struct {
+	Value int `xml:"value,attr" json:"value"`
+}
+
+// TCPSequence is the TCP sequence prediction of a host
+type TCPSequence struct {
+	Index      int    `xml:"index,attr" json:"index"`
+	Difficulty string `xml:"difficulty,attr" json:"difficulty"`
+	Values     string `xml:"values,attr" json:"values"`
+}
+
+// Sequence is an IP ID or TCP timestamp sequence class
+type Sequence struct {
+	Class  string `xml:"class,attr" json:"class"`
+	Values string `xml:"values,attr" json:"values"`
+}
+
+// Trace is the traceroute to a host
+type Trace struct {
+	Port  int    `xml:"port,attr" json:"port"`
+	Proto string `xml:"proto,attr" json:"proto"`
+	Hops  []Hop  `xml:"hop" json:"hops,omitempty"`
+}
+
+// Hop is a single traceroute hop
+type Hop struct {
+	TTL    int     `xml:"ttl,attr" json:"ttl"`
+	IPAddr string  `xml:"ipaddr,attr" json:"ip_addr"`
+	RTT    float64 `xml:"rtt,attr" json:"rtt"`
+	Host   string  `xml:"host,attr" json:"host,omitempty"`
+}
+
+// Times are the round trip timing values of a host in microseconds
+type Times struct {
+	SRTT   int `xml:"srtt,attr" json:"srtt"`
+	RTTVar int `xml:"rttvar,attr" json:"rttvar"`
+	To     int `xml:"to,attr" json:"to"`
+}
+
+// RunStats are the statistics written when nmap finishes
+type RunStats struct {
+	Finished Finished  `xml:"finished" json:"finished"`
+	Hosts    HostStats `xml:"hosts" json:"hosts"`
+}
+
+// Finished describes how and when the scan finished
+type Finished struct {
+	Time     Timestamp `xml:"time,attr" json:"time"`
+	TimeStr  string    `xml:"timestr,attr" json:"time_str"`
+	Elapsed  float64   `xml:"elapsed,attr" json:"elapsed"`
+	Summary  string    `xml:"summary,attr" json:"summary"`
+	Exit     string    `xml:"exit,attr" json:"exit"`
+	ErrorMsg string    `xml:"errormsg,attr" json:"error_msg,omitempty"`
+}
+
+// HostStats are the number of hosts up, down and scanned in total
+type HostStats struct {
+	Up    int `xml:"up,attr" json:"up"`
+	Down  int `xml:"down,attr" json:"down"`
+	Total int `xml:"total,attr" json:"total"`
+}
+
+// Timestamp is a unix epoch nmap attribute parsed into a time.Time
+type Timestamp time.Time
+
+// UnmarshalXMLAttr parses a unix epoch attribute
+func (t *Timestamp) UnmarshalXMLAttr(attr xml.Attr) error {
+	if attr.Value == "" {
+		*t = Timestamp(time.Time{})
+		return nil
+	}
+	seconds, err := strconv.ParseInt(attr.Value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*t = Timestamp(time.Unix(seconds, 0).UTC())
+	return nil
+}
+
+// MarshalXMLAttr writes the timestamp back as a unix epoch attribute
+func (t Timestamp) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if t.Time().IsZero() {
+		return xml.Attr{}, nil
+	}
+	return xml.Attr{Name: name, Value: strconv.FormatInt(t.Time().Unix(), 10)}, nil
+}
+
+// MarshalJSON writes the timestamp as RFC3339
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return t.Time().MarshalJSON()
+}
+
+// UnmarshalJSON reads an RFC3339 timestamp
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var ts time.Time
+	if err := ts.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*t = Timestamp(ts)
+	return nil
+}
+
+// Time returns the timestamp as a time.Time
+func (t Timestamp) Time() time.Time {
+	return time.Time(t)
+}
+
+// String returns the timestamp formatted as RFC3339
+func (t Timestamp) String() string {
+	return t.Time().Format(time.RFC3339)
+}
+
+// Address returns the ipv4 or ipv6 address of the host, falling back to the first address
+func (h *Host) Address() string {
+	for _, addr := range h.Addresses {
+		if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+			return addr.Addr
+		}
+	}
+	if len(h.Addresses) > 0 {
+		return h.Addresses[0].Addr
+	}
+	return ""
+}
+
+// Hostname returns the user supplied hostname of the host, falling back to the first PTR record
+func (h *Host) Hostname() string {
+	for _, hostname := range h.Hostnames {
+		if hostname.Type == "user" {
+			return hostname.Name
+		}
+	}
+	if len(h.Hostnames) > 0 {
+		return h.Hostnames[0].Name
+	}
+	return ""
+}
+
+// Up reports whether nmap considered the host up
+func (h *Host) Up() bool {
+	return h.Status.State == "up"
+}
+
+// OpenPorts returns the ports of the host that are open
+func (h *Host) OpenPorts() []Port {
+	var ports []Port
+	for i := range h.Ports {
+		if h.Ports[i].Open() {
+			ports = append(ports, h.Ports[i])
+		}
+	}
+	return ports
+}
+
+// Open reports whether the port is open. open|filtered UDP ports are not considered open.
+func (p *Port) Open() bool {
+	return p.State.State == "open"
+}
+
+// BestMatch returns the most accurate OS match, or nil when OS detection did not find one
+func (o *OS) BestMatch() *OSMatch {
+	var best *OSMatch
+	for i := range o.OSMatches {
+		if best == nil || o.OSMatches[i].Accuracy > best.Accuracy {
+			best = &o.OSMatches[i]
+		}
+	}
+	return best
+}
+
+// Flatten returns the structured output of the script as dotted key value pairs,
+// e.g. ssh-hostkey output becomes 1.type=ssh-rsa, 1.bits=2048
+func (s *Script) Flatten() map[string]string {
+	values := make(map[string]string)
+	flattenElements(values, "", s.Elements, s.Tables)
+	return values
+}
+
+func flattenElements(values map[string]string, prefix string, elements []Element, tables []Table) {
+	for i, elem := range elements {
+		key := elem.Key
+		if key == "" {
+			key = strconv.Itoa(i + 1)
+		}
+		values[joinKey(prefix, key)] = strings.TrimSpace(elem.Value)
+	}
+	for i, table := range tables {
+		key := table.Key
+		if key == "" {
+			key = strconv.Itoa(i + 1)
+		}
+		flattenElements(values, joinKey(prefix, key), table.Elements, table.Tables)
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,130 @@
+package nmapxml
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFile(t *testing.T) {
+	run, err := ParseFile("testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"Hosts", len(run.Hosts), 2},
+		{"Start", run.Start.Time(), time.Unix(1688415732, 0).UTC()},
+		{"Elapsed", run.RunStats.Finished.Elapsed, 68.12},
+		{"Hosts Up", run.RunStats.Hosts.Up, 2},
+		{"Pre Scripts", run.PreScripts[0].ID, "broadcast-dhcp-discover"},
+		{"Post Scripts", run.PostScripts[0].ID, "ssh-hostkey"},
+		{"Address", run.Hosts[0].Address(), "10.0.0.1"},
+		{"Hostname", run.Hosts[0].Hostname(), "gw.corp.local"},
+		{"Port ID", run.Hosts[0].Ports[0].PortID, 22},
+		{"Port Scripts", len(run.Hosts[0].Ports[1].Scripts), 2},
+		{"Service CPEs", run.Hosts[0].Ports[0].Service.CPEs, []string{"cpe:/a:openbsd:openssh:8.9p1", "cpe:/o:linux:linux_kernel"}},
+		{"Service Conf", run.Hosts[0].Ports[0].Service.Conf, 10},
+		{"OS Matches", len(run.Hosts[0].OS.OSMatches), 2},
+		{"OS Classes", len(run.Hosts[0].OS.OSMatches[0].OSClasses), 2},
+		{"OS Best Match", run.Hosts[0].OS.BestMatch().Name, "Linux 4.15 - 5.8"},
+		{"Extra Ports", run.Hosts[0].ExtraPorts[0].Count, 1},
+		{"Hop RTT", run.Hosts[0].Trace.Hops[0].RTT, 0.42},
+		{"Second Host Address", run.Hosts[1].Address(), "10.0.0.2"},
+		{"Open Ports", len(run.Hosts[1].OpenPorts()), 1},
+		{"Host Scripts", len(run.Hosts[1].HostScripts), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptFlatten(t *testing.T) {
+	run, err := ParseFile("testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		script Script
+		want   map[string]string
+	}{
+		{"Nested Tables", run.Hosts[0].Ports[0].Scripts[0], map[string]string{
+			"1.type": "ecdsa-sha2-nistp256",
+			"1.bits": "256",
+			"2.type": "ssh-ed25519",
+			"2.bits": "256",
+		}},
+		{"Keyed Table", run.Hosts[1].HostScripts[0], map[string]string{
+			"3:1:1.1": "Message signing enabled but not required",
+		}},
+		{"Elements", run.Hosts[1].HostScripts[1], map[string]string{
+			"date":       "2023-07-03T20:23:10",
+			"start_date": "N/A",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.script.Flatten(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	data, err := os.ReadFile("testdata/multihost.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstHost := bytes.Index(data, []byte("</host>")) + len("</host>")
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantHosts int
+		wantRun   bool
+		wantErr   error
+	}{
+		{"Complete", data, 2, true, nil},
+		{"Truncated After Host", data[:firstHost], 1, true, ErrTruncated},
+		{"Truncated Inside Host", data[:firstHost+40], 1, true, ErrTruncated},
+		{"Not Nmap", []byte(`<?xml version="1.0"?><issues></issues>`), 0, false, nil},
+		{"Empty", nil, 0, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := 0
+			run, err := Stream(bytes.NewReader(tt.data), func(host *Host) error {
+				hosts++
+				return nil
+			})
+			if (run != nil) != tt.wantRun {
+				t.Fatalf("Stream() run = %v, want run %v, error = %v", run, tt.wantRun, err)
+			}
+			switch {
+			case !tt.wantRun && err == nil:
+				t.Errorf("Stream() error = nil, want an error")
+			case tt.wantRun && !errors.Is(err, tt.wantErr):
+				t.Errorf("Stream() error = %v, want %v", err, tt.wantErr)
+			}
+			if hosts != tt.wantHosts {
+				t.Errorf("Stream() got %d hosts, want %d", hosts, tt.wantHosts)
+			}
+			if run != nil && len(run.Hosts) != 0 {
+				t.Errorf("Stream() kept %d hosts in the run", len(run.Hosts))
+			}
+		})
+	}
+}
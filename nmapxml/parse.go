@@ -0,0 +1,37 @@
+package nmapxml
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Parse parses nmap XML output
+func Parse(data []byte) (*Run, error) {
+	return Decode(bytes.NewReader(data))
+}
+
+// Decode parses nmap XML output from a reader, every host is kept in memory. Use Stream for large output.
+func Decode(r io.Reader) (*Run, error) {
+	var hosts []Host
+	run, err := Stream(r, func(host *Host) error {
+		hosts = append(hosts, *host)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.Hosts = hosts
+	return run, nil
+}
+
+// ParseFile parses an nmap XML output file
+func ParseFile(nmapFile string) (*Run, error) {
+	f, err := os.Open(nmapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
@@ -0,0 +1,136 @@
+package nmapxml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrTruncated is returned for nmap XML output that ends before </nmaprun>, e.g. the output of a killed scan
+var ErrTruncated = errors.New("nmap XML output is truncated")
+
+// Stream decodes nmap XML output one host at a time. fn is called for every host as soon as it is decoded,
+// the host is not kept afterwards so memory use does not grow with the number of hosts.
+// The run is returned without its hosts once the <nmaprun> element was read, also when a later error stops the decoding.
+// Hosts decoded before such an error have already been passed to fn.
+func Stream(r io.Reader, fn func(host *Host) error) (*Run, error) {
+	decoder := xml.NewDecoder(r)
+	var run *Run
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return run, streamError(run, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			if end, ok := token.(xml.EndElement); ok && run != nil && end.Name.Local == "nmaprun" {
+				return run, nil
+			}
+			continue
+		}
+		if run == nil {
+			if start.Name.Local != "nmaprun" {
+				return nil, fmt.Errorf("root element is %s, not nmaprun", start.Name.Local)
+			}
+			if run, err = newRun(start); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = decodeChild(decoder, &start, run, fn); err != nil {
+			return run, streamError(run, err)
+		}
+	}
+}
+
+// StreamFile streams an nmap XML output file, see Stream
+func StreamFile(nmapFile string, fn func(host *Host) error) (*Run, error) {
+	f, err := os.Open(nmapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Stream(f, fn)
+}
+
+// newRun reads the attributes of the <nmaprun> element
+func newRun(start xml.StartElement) (*Run, error) {
+	run := &Run{XMLName: start.Name}
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "scanner":
+			run.Scanner = attr.Value
+		case "args":
+			run.Args = attr.Value
+		case "start":
+			if err := run.Start.UnmarshalXMLAttr(attr); err != nil {
+				return nil, err
+			}
+		case "startstr":
+			run.StartStr = attr.Value
+		case "version":
+			run.Version = attr.Value
+		case "xmloutputversion":
+			run.XMLOutputVersion = attr.Value
+		}
+	}
+	return run, nil
+}
+
+// decodeChild decodes a single child element of <nmaprun> into run, hosts are passed to fn instead
+func decodeChild(decoder *xml.Decoder, start *xml.StartElement, run *Run, fn func(host *Host) error) error {
+	switch start.Name.Local {
+	case "host":
+		host := &Host{}
+		if err := decoder.DecodeElement(host, start); err != nil {
+			return err
+		}
+		return fn(host)
+	case "scaninfo":
+		var info ScanInfo
+		if err := decoder.DecodeElement(&info, start); err != nil {
+			return err
+		}
+		run.ScanInfo = append(run.ScanInfo, info)
+		return nil
+	case "verbose":
+		return decoder.DecodeElement(&run.Verbose, start)
+	case "debugging":
+		return decoder.DecodeElement(&run.Debugging, start)
+	case "prescript", "postscript":
+		var scripts struct {
+			Scripts []Script `xml:"script"`
+		}
+		if err := decoder.DecodeElement(&scripts, start); err != nil {
+			return err
+		}
+		if start.Name.Local == "prescript" {
+			run.PreScripts = append(run.PreScripts, scripts.Scripts...)
+		} else {
+			run.PostScripts = append(run.PostScripts, scripts.Scripts...)
+		}
+		return nil
+	case "runstats":
+		return decoder.DecodeElement(&run.RunStats, start)
+	}
+	return decoder.Skip()
+}
+
+// streamError reports output that ends early as ErrTruncated
+func streamError(run *Run, err error) error {
+	var syntaxErr *xml.SyntaxError
+	switch {
+	case run == nil && errors.Is(err, io.EOF):
+		return fmt.Errorf("no nmaprun element found: %w", err)
+	case run == nil:
+		return err
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrTruncated
+	case errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF":
+		return fmt.Errorf("%w at line %d", ErrTruncated, syntaxErr.Line)
+	}
+	return err
+}
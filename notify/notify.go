@@ -0,0 +1,287 @@
+/*
+Package notify
+
+Copyright © 2023 MrPMillz
+*/
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is what a notification is about, webhooks can subscribe to a subset of them
+type Event string
+
+// Events of the scan lifecycle
+const (
+	// EventScanStart is sent once the targets are known and the scan starts
+	EventScanStart Event = "scan_start"
+	// EventHostDone is sent whenever the scan of a host finished or failed
+	EventHostDone Event = "host_done"
+	// EventService is sent for every interesting service that was not open in the previous run
+	EventService Event = "service"
+	// EventSummary is sent after the results were exported, also when the scan was interrupted
+	EventSummary Event = "summary"
+)
+
+// Events returns every event in the order they are sent
+func Events() []Event {
+	return []Event{EventScanStart, EventHostDone, EventService, EventSummary}
+}
+
+// queueSize is the number of notifications waiting for delivery before Send drops new ones
+const queueSize = 1024
+
+// maxRetryAfter caps how long a Retry-After header can delay the next attempt
+const maxRetryAfter = time.Minute
+
+// Message is a single notification, the fields that do not belong to its Event are empty
+type Message struct {
+	Event Event     `json:"event"`
+	Time  time.Time `json:"time"`
+	// Output is the scan output directory
+	Output string `json:"output"`
+	// Targets is the number of targets of the scan
+	Targets int      `json:"targets,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	Engines []string `json:"engines,omitempty"`
+	// Host is the target of a host_done message
+	Host string `json:"host,omitempty"`
+	// Phase is the scan phase the host finished, e.g. nmap or udp
+	Phase string `json:"phase,omitempty"`
+	// OpenPorts are the open ports the scan of Host found, UDP ports are prefixed with U:
+	OpenPorts []string `json:"open_ports,omitempty"`
+	// Done and Total are the progress of the phase
+	Done  int `json:"done,omitempty"`
+	Total int `json:"total,omitempty"`
+	// Error is why the scan of Host failed, or why the scan did not finish for a summary
+	Error   string          `json:"error,omitempty"`
+	Service *export.Service `json:"service,omitempty"`
+	Summary *Summary        `json:"summary,omitempty"`
+}
+
+// Summary sums up a finished scan
+type Summary struct {
+	// RunID is the ID of the run in the results database
+	RunID     int64     `json:"run_id"`
+	StartedAt time.Time `json:"started_at"`
+	// Duration is how long the scan took, e.g. 1h2m3s
+	Duration string `json:"duration"`
+	// Hosts is the number of up hosts
+	Hosts     int `json:"hosts"`
+	OpenPorts int `json:"open_ports"`
+	// NewServices are the interesting services that were not open in the previous run
+	NewServices []export.Service `json:"new_services"`
+	Incomplete  []string         `json:"incomplete"`
+	TimedOut    []string         `json:"timed_out"`
+	Failed      []string         `json:"failed"`
+}
+
+// NewSummary sums up the exported results doc of a scan
+func NewSummary(doc *export.Document, started time.Time, config *Config, isNew func(s *export.Service) bool) *Summary {
+	summary := &Summary{
+		StartedAt:   started,
+		Duration:    time.Since(started).Round(time.Second).String(),
+		Hosts:       len(doc.Hosts),
+		NewServices: []export.Service{},
+		Incomplete:  nonNil(doc.Incomplete),
+		TimedOut:    nonNil(doc.TimedOut),
+		Failed:      []string{},
+	}
+	for _, s := range doc.OpenServices() {
+		summary.OpenPorts++
+		if config.Interesting(&s) && isNew(&s) {
+			summary.NewServices = append(summary.NewServices, s)
+		}
+	}
+	return summary
+}
+
+// Notifier delivers messages to the webhooks of a Config in the background, one message after another
+type Notifier struct {
+	config *Config
+	client *http.Client
+	queue  chan *Message
+	done   chan struct{}
+	// ctx stops deliveries that are still retrying when Close gives up waiting
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	// dropped counts the messages Send dropped because the queue was full
+	dropped atomic.Int64
+}
+
+// New starts a Notifier for config, a nil config or a config without webhooks sends nothing
+func New(config *Config) *Notifier {
+	if config == nil {
+		config = &Config{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan *Message, queueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go n.deliver()
+	return n
+}
+
+// Config returns the configuration the notifier was started with
+func (n *Notifier) Config() *Config {
+	return n.config
+}
+
+// Send queues msg for every webhook subscribed to its event. Notifications are sent in the background and
+// never fail or slow down the scan, delivery errors are logged and msg is dropped when the queue is full.
+func (n *Notifier) Send(msg *Message) {
+	if len(n.config.Webhooks) == 0 {
+		return
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now().UTC()
+	}
+	select {
+	case n.queue <- msg:
+	default:
+		if n.dropped.Add(1) == 1 {
+			log.Printf("%d notifications are waiting for the webhooks, dropping new notifications while the queue is full\n", queueSize)
+		}
+	}
+}
+
+// Dropped returns the number of messages Send dropped because the webhooks could not keep up
+func (n *Notifier) Dropped() int64 {
+	return n.dropped.Load()
+}
+
+// Close delivers the queued messages and stops the notifier. Deliveries still running after timeout are abandoned.
+func (n *Notifier) Close(timeout time.Duration) {
+	n.once.Do(func() {
+		close(n.queue)
+		if dropped := n.Dropped(); dropped > 0 {
+			log.Printf("dropped %d notification(s) while the queue was full\n", dropped)
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-n.done:
+		case <-timer.C:
+			log.Printf("giving up on %d undelivered notification(s) after %s\n", len(n.queue), timeout)
+			n.cancel()
+			<-n.done
+		}
+		n.cancel()
+	})
+}
+
+func (n *Notifier) deliver() {
+	defer close(n.done)
+	for msg := range n.queue {
+		for _, webhook := range n.config.Webhooks {
+			if !webhook.subscribed(msg.Event) || n.ctx.Err() != nil {
+				continue
+			}
+			if err := n.post(webhook, msg); err != nil {
+				log.Printf("could not send the %s notification to webhook %s: %v\n", msg.Event, webhook.Name, err)
+			}
+		}
+	}
+}
+
+// post sends msg to webhook, retrying failed deliveries with an exponential backoff
+func (n *Notifier) post(webhook *Webhook, msg *Message) error {
+	body, err := webhook.payload(msg)
+	if err != nil {
+		return err
+	}
+	backoff := n.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		wait, err := n.attempt(webhook, body)
+		if err == nil {
+			return nil
+		}
+		if wait < 0 || attempt >= n.config.Retries {
+			return err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-n.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt posts body to webhook once. On failure wait is how long to wait before the next attempt,
+// 0 for the regular backoff and negative when the failure is permanent.
+func (n *Notifier) attempt(webhook *Webhook, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goforit")
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("rate limited with status %s", resp.Status)
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("server error %s", resp.Status)
+	default:
+		// any other client error will not go away by sending the same payload again
+		return -1, fmt.Errorf("rejected with status %s", resp.Status)
+	}
+}
+
+// retryAfter parses a Retry-After header in seconds, 0 when it is missing or not in seconds
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	wait := time.Duration(seconds) * time.Second
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
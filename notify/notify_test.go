@@ -0,0 +1,235 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a webhook endpoint that answers with the next of statuses and records every body
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []map[string]interface{}
+	headers  []http.Header
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, _ := io.ReadAll(req.Body)
+	body := make(map[string]interface{})
+	_ = json.Unmarshal(data, &body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestConfig(t *testing.T, webhooks ...*Webhook) *Config {
+	t.Helper()
+	config := &Config{Webhooks: webhooks, Retries: 2, RetryBackoff: 10 * time.Millisecond, Timeout: time.Second}
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	return config
+}
+
+func TestPayloadFormats(t *testing.T) {
+	msg := &Message{Event: EventService, Output: "/tmp/acme", Host: "10.0.0.5", Phase: "nmap",
+		Service: &export.Service{Host: "10.0.0.5", Port: 3389, Protocol: "tcp", State: "open", Service: "ms-wbt-server", Product: "Microsoft Terminal Services"}}
+	tests := []struct {
+		name   string
+		format string
+		check  func(t *testing.T, body map[string]interface{})
+	}{
+		{"Generic", FormatGeneric, func(t *testing.T, body map[string]interface{}) {
+			if body["event"] != "service" || body["host"] != "10.0.0.5" || body["service"] == nil {
+				t.Errorf("generic payload got = %v, want the message fields", body)
+			}
+		}},
+		{"Slack", FormatSlack, func(t *testing.T, body map[string]interface{}) {
+			if len(body) != 1 {
+				t.Errorf("slack payload got = %v, want only text", body)
+			}
+		}},
+		{"Teams", FormatTeams, func(t *testing.T, body map[string]interface{}) {
+			if body["@type"] != "MessageCard" || body["title"] != "goforit: New interesting service" {
+				t.Errorf("teams payload got = %v, want a message card", body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(t, &Webhook{URL: "https://example.com/hook", Format: tt.format})
+			data, err := config.Webhooks[0].payload(msg)
+			if err != nil {
+				t.Fatalf("payload() error = %v", err)
+			}
+			body := make(map[string]interface{})
+			if err = json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("payload() is not JSON: %v", err)
+			}
+			want := "New ms-wbt-server service on 10.0.0.5:3389/tcp (Microsoft Terminal Services)"
+			if body["text"] != want {
+				t.Errorf("payload() text got = %q, want %q", body["text"], want)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+	rejecting := &recorder{statuses: []int{http.StatusBadRequest}}
+	rejectingServer := httptest.NewServer(rejecting)
+	defer rejectingServer.Close()
+
+	config := newTestConfig(t,
+		&Webhook{Name: "all", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"},
+			Templates: map[string]string{"scan_start": "started {{.Targets}}"}},
+		&Webhook{Name: "summary only", URL: rejectingServer.URL, Events: []string{"summary"}},
+	)
+	n := New(config)
+	n.Send(&Message{Event: EventScanStart, Output: "/tmp/acme", Targets: 3, Profile: "default", Engines: []string{"nmap"}})
+	n.Send(&Message{Event: EventHostDone, Output: "/tmp/acme", Host: "10.0.0.1", Phase: "nmap", OpenPorts: []string{"22", "80"}, Done: 1, Total: 3})
+	n.Close(5 * time.Second)
+
+	rec.mu.Lock()
+	// the scan start is delivered on the third attempt after a server error and a rate limit
+	if len(rec.bodies) != 4 {
+		rec.mu.Unlock()
+		t.Fatalf("webhook got %d requests, want 4", len(rec.bodies))
+	}
+	if rec.bodies[2]["text"] != "started 3" {
+		t.Errorf("scan start text got = %q, want the overridden template", rec.bodies[2]["text"])
+	}
+	if want := "Finished the nmap scan of 10.0.0.1, 2 open port(s): 22,80 (1/3)"; rec.bodies[3]["text"] != want {
+		t.Errorf("host done text got = %q, want %q", rec.bodies[3]["text"], want)
+	}
+	if rec.headers[0].Get("Authorization") != "Bearer secret" {
+		t.Errorf("webhook headers got = %v, want the Authorization header", rec.headers[0])
+	}
+	rec.mu.Unlock()
+	// the summary only webhook is not subscribed to either event
+	if len(rejecting.bodies) != 0 {
+		t.Errorf("summary only webhook got %d requests, want 0", len(rejecting.bodies))
+	}
+
+	n = New(config)
+	n.Send(&Message{Event: EventSummary, Output: "/tmp/acme", Summary: &Summary{NewServices: []export.Service{}}})
+	n.Close(5 * time.Second)
+	// client errors are not retried
+	if len(rejecting.bodies) != 1 {
+		t.Errorf("rejecting webhook got %d requests, want 1", len(rejecting.bodies))
+	}
+}
+
+func TestNotifierQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	delivered := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		delivered++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	n := New(newTestConfig(t, &Webhook{Name: "slow", URL: server.URL}))
+	// the first message may be taken from the queue by the delivery that waits for release
+	sent := queueSize + 10
+	for i := 0; i < sent; i++ {
+		n.Send(&Message{Event: EventHostDone, Host: "10.0.0.1", Phase: "nmap"})
+	}
+	if dropped := n.Dropped(); dropped < 9 || dropped > 10 {
+		t.Errorf("Dropped() got = %d, want 9 or 10", dropped)
+	}
+	close(release)
+	n.Close(10 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if got := int64(delivered) + n.Dropped(); got != int64(sent) {
+		t.Errorf("delivered and dropped got = %d, want %d", got, sent)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		notify     map[string]interface{}
+		urls       []string
+		wantFormat []string
+		wantErr    bool
+	}{
+		{"Flag URLs", nil, []string{"https://hooks.slack.com/services/T0/B0/XYZ", " https://acme.webhook.office.com/webhookb2/abc", "https://example.com/hook"},
+			[]string{FormatSlack, FormatTeams, FormatGeneric}, false},
+		{"Config", map[string]interface{}{
+			"retries": 5,
+			"webhooks": []interface{}{
+				map[string]interface{}{"name": "siem", "url": "https://siem.example.com/in", "events": []string{"summary", "service"}},
+			},
+		}, nil, []string{FormatGeneric}, false},
+		{"Bad URL", nil, []string{"hooks.slack.com/services"}, nil, true},
+		{"Bad Format", map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"url": "https://example.com", "format": "irc"}}}, nil, nil, true},
+		{"Bad Event", map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"url": "https://example.com", "events": []string{"done"}}}}, nil, nil, true},
+		{"Bad Template", map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"url": "https://example.com", "templates": map[string]string{"summary": "{{.Nope"}}}}, nil, nil, true},
+		{"Negative Retries", map[string]interface{}{"retries": -1}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("NOTIFY", tt.notify)
+			defer viper.Set("NOTIFY", nil)
+
+			config, err := LoadConfig(tt.urls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var formats []string
+			for _, webhook := range config.Webhooks {
+				formats = append(formats, webhook.Format)
+			}
+			if strings.Join(formats, ",") != strings.Join(tt.wantFormat, ",") {
+				t.Errorf("LoadConfig() formats got = %v, want %v", formats, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestInteresting(t *testing.T) {
+	config := &Config{Services: []string{"ms-wbt-server", "8443", "161/udp"}}
+	tests := []struct {
+		name    string
+		service export.Service
+		want    bool
+	}{
+		{"Service Name", export.Service{Port: 3390, Protocol: "tcp", Service: "ms-wbt-server"}, true},
+		{"Port", export.Service{Port: 8443, Protocol: "tcp", Service: "https-alt"}, true},
+		{"Port Other Protocol", export.Service{Port: 8443, Protocol: "udp"}, false},
+		{"UDP Port", export.Service{Port: 161, Protocol: "udp", Service: "snmp"}, true},
+		{"Boring", export.Service{Port: 443, Protocol: "tcp", Service: "https"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.Interesting(&tt.service); got != tt.want {
+				t.Errorf("Interesting() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/spf13/viper"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Payload formats of a webhook
+const (
+	// FormatGeneric posts the Message as JSON with the rendered template as text
+	FormatGeneric = "generic"
+	// FormatSlack posts a Slack incoming webhook message, Mattermost and Rocket.Chat accept it as well
+	FormatSlack = "slack"
+	// FormatTeams posts a Microsoft Teams message card
+	FormatTeams = "teams"
+)
+
+// defaultInterestingServices are the services worth a notification when no services are configured:
+// remote access, file shares, databases and management interfaces that should rarely be reachable
+var defaultInterestingServices = []string{
+	"ftp", "telnet", "microsoft-ds", "netbios-ssn", "ms-wbt-server", "vnc", "x11", "rsync", "nfs", "snmp", "ldap",
+	"ms-sql-s", "mysql", "postgresql", "oracle-tns", "mongodb", "redis", "elasticsearch", "memcached", "docker",
+	"kubernetes", "wsman", "asf-rmcp", "ipmi",
+}
+
+// defaultTemplates render the text of every event, they receive the Message
+var defaultTemplates = map[Event]string{
+	EventScanStart: `goforit started scanning {{.Targets}} target(s) with the {{.Profile}} profile and the {{join .Engines ","}} engine(s) into {{.Output}}`,
+	EventHostDone: `{{if .Error}}The {{.Phase}} scan of {{.Host}} failed: {{.Error}}{{else}}Finished the {{.Phase}} scan of {{.Host}}, ` +
+		`{{len .OpenPorts}} open port(s){{with .OpenPorts}}: {{join . ","}}{{end}}{{end}} ({{.Done}}/{{.Total}})`,
+	EventService: `New {{.Service.Service}} service on {{.Service.Key}}{{with .Service.ProductVersion}} ({{.}}){{end}}`,
+	EventSummary: `goforit {{if .Error}}stopped{{else}}finished{{end}} the scan into {{.Output}} after {{.Summary.Duration}}` +
+		`{{with .Error}}: {{.}}{{end}}
+{{.Summary.Hosts}} host(s) up with {{.Summary.OpenPorts}} open port(s), {{len .Summary.NewServices}} new interesting service(s)` +
+		`{{range .Summary.NewServices}}
+- {{.Key}} {{.Service}}{{with .ProductVersion}} ({{.}}){{end}}{{end}}` +
+		`{{with .Summary.Incomplete}}
+{{len .}} incomplete target(s): {{join . ", "}}{{end}}{{with .Summary.TimedOut}}
+{{len .}} timed out target(s): {{join . ", "}}{{end}}{{with .Summary.Failed}}
+{{len .}} failed target(s): {{join . ", "}}{{end}}`,
+}
+
+// titles are the titles of the Teams message cards
+var titles = map[Event]string{
+	EventScanStart: "Scan started",
+	EventHostDone:  "Host finished",
+	EventService:   "New interesting service",
+	EventSummary:   "Scan finished",
+}
+
+// Config configures notifications, it is read from NOTIFY in config.yaml
+type Config struct {
+	Webhooks []*Webhook `mapstructure:"webhooks"`
+	// Retries is how often a failed delivery is attempted again
+	Retries int `mapstructure:"retries"`
+	// RetryBackoff is the wait before the first retry, it doubles with every further retry
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// Timeout limits every single delivery
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Services are the interesting services, service names such as ms-wbt-server or ports such as 3389 or 161/udp
+	Services []string `mapstructure:"services"`
+}
+
+// Webhook is a URL notifications are posted to
+type Webhook struct {
+	Name string `mapstructure:"name"`
+	URL  string `mapstructure:"url"`
+	// Format is generic, slack or teams, it is guessed from URL when empty
+	Format string `mapstructure:"format"`
+	// Events are the events sent to the webhook, empty sends every event
+	Events []string `mapstructure:"events"`
+	// Headers are added to every request, e.g. an Authorization header
+	Headers map[string]string `mapstructure:"headers"`
+	// Templates override the default text of an event, a value is either a text/template or a file containing one
+	Templates map[string]string `mapstructure:"templates"`
+
+	events    map[Event]bool
+	templates map[Event]*template.Template
+}
+
+// LoadConfig reads NOTIFY from config.yaml and adds a webhook for every URL of urls, the --webhook flag
+func LoadConfig(urls []string) (*Config, error) {
+	config := &Config{Retries: 3, RetryBackoff: 2 * time.Second, Timeout: 10 * time.Second}
+	if err := viper.UnmarshalKey("NOTIFY", config); err != nil {
+		return nil, fmt.Errorf("could not read NOTIFY from config.yaml: %w", err)
+	}
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u != "" {
+			config.Webhooks = append(config.Webhooks, &Webhook{URL: u})
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.Retries < 0:
+		return fmt.Errorf("notify retries cannot be negative, got %d", c.Retries)
+	case c.RetryBackoff <= 0:
+		return fmt.Errorf("notify retry_backoff must be positive, got %s", c.RetryBackoff)
+	case c.Timeout <= 0:
+		return fmt.Errorf("notify timeout must be positive, got %s", c.Timeout)
+	}
+	if len(c.Services) == 0 {
+		c.Services = defaultInterestingServices
+	}
+	for i, webhook := range c.Webhooks {
+		if webhook == nil {
+			return fmt.Errorf("webhook %d is empty", i+1)
+		}
+		if err := webhook.load(i); err != nil {
+			return fmt.Errorf("invalid webhook %s: %w", webhook.Name, err)
+		}
+	}
+	return nil
+}
+
+// Interesting reports whether s is one of the interesting services of the config
+func (c *Config) Interesting(s *export.Service) bool {
+	for _, entry := range c.Services {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		port, protocol, found := strings.Cut(entry, "/")
+		if !found {
+			protocol = "tcp"
+		}
+		if entry == s.Service || port == strconv.Itoa(s.Port) && protocol == s.Protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// load validates the webhook and parses its templates, i is its position used to name webhooks without a name
+func (w *Webhook) load(i int) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q, use an http or https URL", w.URL)
+	}
+	if w.Name == "" {
+		w.Name = fmt.Sprintf("%d (%s)", i+1, u.Host)
+	}
+	w.Format = strings.ToLower(w.Format)
+	if w.Format == "" {
+		w.Format = guessFormat(u)
+	}
+	switch w.Format {
+	case FormatGeneric, FormatSlack, FormatTeams:
+	default:
+		return fmt.Errorf("unsupported format %q, use %s, %s or %s", w.Format, FormatGeneric, FormatSlack, FormatTeams)
+	}
+
+	w.events = make(map[Event]bool)
+	for _, name := range w.Events {
+		event, err := parseEvent(name)
+		if err != nil {
+			return err
+		}
+		w.events[event] = true
+	}
+
+	texts := make(map[Event]string, len(defaultTemplates))
+	for event, text := range defaultTemplates {
+		texts[event] = text
+	}
+	for name, value := range w.Templates {
+		event, err := parseEvent(name)
+		if err != nil {
+			return err
+		}
+		if texts[event], err = templateText(value); err != nil {
+			return err
+		}
+	}
+	w.templates = make(map[Event]*template.Template)
+	for event, text := range texts {
+		tmpl, err := template.New(string(event)).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid %s template: %w", event, err)
+		}
+		w.templates[event] = tmpl
+	}
+	return nil
+}
+
+// guessFormat picks the format of well known chat webhook hosts, generic for any other host
+func guessFormat(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return FormatSlack
+	case strings.HasSuffix(host, ".webhook.office.com") || host == "outlook.office.com" || strings.HasSuffix(host, ".logic.azure.com"):
+		return FormatTeams
+	default:
+		return FormatGeneric
+	}
+}
+
+func parseEvent(name string) (Event, error) {
+	for _, event := range Events() {
+		if strings.EqualFold(name, string(event)) {
+			return event, nil
+		}
+	}
+	names := make([]string, 0, len(Events()))
+	for _, event := range Events() {
+		names = append(names, string(event))
+	}
+	return "", fmt.Errorf("unknown event %q, use %s", name, strings.Join(names, ", "))
+}
+
+// templateText returns the contents of value when it is a file and value itself otherwise
+func templateText(value string) (string, error) {
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("could not read template: %w", err)
+		}
+		return string(data), nil
+	}
+	return value, nil
+}
+
+// subscribed reports whether the webhook receives event
+func (w *Webhook) subscribed(event Event) bool {
+	return len(w.events) == 0 || w.events[event]
+}
+
+// payload renders msg in the format of the webhook
+func (w *Webhook) payload(msg *Message) ([]byte, error) {
+	tmpl, ok := w.templates[msg.Event]
+	if !ok {
+		return nil, errors.New("webhook was not loaded")
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, msg); err != nil {
+		return nil, fmt.Errorf("could not render the %s template: %w", msg.Event, err)
+	}
+	switch w.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": text.String()})
+	case FormatTeams:
+		return json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  titles[msg.Event],
+			"title":    "goforit: " + titles[msg.Event],
+			// Teams renders the text as markdown, which needs two spaces before a line break
+			"text": strings.ReplaceAll(text.String(), "\n", "  \n"),
+		})
+	default:
+		return json.Marshal(struct {
+			*Message
+			Text string `json:"text"`
+		}{msg, text.String()})
+	}
+}
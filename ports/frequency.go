@@ -0,0 +1,146 @@
+package ports
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// data is the embedded copy of nmap's port frequency data, used when nmap's own nmap-services file is not installed
+//
+//go:embed data/tcp-top-ports.txt data/udp-top-ports.txt
+var data embed.FS
+
+// NmapServicesFiles are the locations nmap installs its nmap-services frequency data to, the first one found is used
+var NmapServicesFiles = []string{
+	"/usr/share/nmap/nmap-services",
+	"/usr/local/share/nmap/nmap-services",
+	"/opt/homebrew/share/nmap/nmap-services",
+}
+
+var (
+	rankingOnce sync.Once
+	rankings    map[string][]int
+	rankingErr  error
+)
+
+// Top returns the n most frequently open ports of protocol, most frequent first.
+// When fewer ports are known, e.g. without nmap's frequency data, every known port is returned and a warning is logged.
+func Top(protocol string, n int) ([]int, error) {
+	rankingOnce.Do(func() {
+		rankings, rankingErr = loadRankings()
+	})
+	if rankingErr != nil {
+		return nil, rankingErr
+	}
+	ranking := rankings[protocol]
+	if n > len(ranking) {
+		log.Printf("only the %d most frequent %s ports are known, scanning them instead of the top %d, install nmap for the full frequency data", len(ranking), protocol, n)
+		n = len(ranking)
+	}
+	return ranking[:n], nil
+}
+
+// loadRankings reads the installed nmap-services file and falls back to the embedded copy
+func loadRankings() (map[string][]int, error) {
+	for _, path := range NmapServicesFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		return parseNmapServices(f)
+	}
+
+	return loadEmbedded()
+}
+
+// loadEmbedded reads the embedded copy of the frequency data
+func loadEmbedded() (map[string][]int, error) {
+	embedded := make(map[string][]int)
+	for protocol, name := range map[string]string{TCP: "data/tcp-top-ports.txt", UDP: "data/udp-top-ports.txt"} {
+		f, err := data.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		ranking, err := parseRanking(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		embedded[protocol] = ranking
+	}
+	return embedded, nil
+}
+
+// parseRanking parses one port per line, most frequent first
+func parseRanking(r io.Reader) ([]int, error) {
+	var ranking []int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		port, err := parsePort(line)
+		if err != nil {
+			return nil, err
+		}
+		ranking = append(ranking, port)
+	}
+	return ranking, scanner.Err()
+}
+
+// parseNmapServices parses nmap-services lines such as "http	80/tcp	0.484143	# World Wide Web HTTP"
+// and ranks the ports of every protocol by their open frequency
+func parseNmapServices(r io.Reader) (map[string][]int, error) {
+	type service struct {
+		port      int
+		frequency float64
+	}
+	services := make(map[string][]service)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		portProto := strings.SplitN(fields[1], "/", 2)
+		if len(portProto) != 2 {
+			continue
+		}
+		port, err := strconv.Atoi(portProto[0])
+		if err != nil {
+			continue
+		}
+		frequency, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		services[portProto[1]] = append(services[portProto[1]], service{port: port, frequency: frequency})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ranked := make(map[string][]int, len(services))
+	for protocol, list := range services {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].frequency != list[j].frequency {
+				return list[i].frequency > list[j].frequency
+			}
+			return list[i].port < list[j].port
+		})
+		for _, s := range list {
+			ranked[protocol] = append(ranked[protocol], s.port)
+		}
+	}
+	return ranked, nil
+}
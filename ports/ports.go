@@ -0,0 +1,247 @@
+/*
+Package ports
+
+Copyright © 2023 MrPMillz
+*/
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TCP is the protocol of ports without a prefix or with the T: prefix
+	TCP = "tcp"
+	// UDP is the protocol of ports with the U: prefix
+	UDP = "udp"
+	// MaxPort is the highest port number
+	MaxPort = 65535
+)
+
+// Set is a deduplicated set of TCP and UDP ports
+type Set struct {
+	tcp map[int]struct{}
+	udp map[int]struct{}
+}
+
+// New returns an empty Set
+func New() *Set {
+	return &Set{tcp: make(map[int]struct{}), udp: make(map[int]struct{})}
+}
+
+// Parse parses an nmap style port specification such as 22,80,8000-8100 or T:22,U:53,161.
+// Like with nmap a T: or U: prefix applies to every following item until the next prefix.
+// On top of the nmap syntax top:N selects the N most frequently open ports of the protocol and all selects every port.
+func Parse(spec string) (*Set, error) {
+	set := New()
+	protocol := TCP
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' || r == ' ' || r == '\t' }) {
+		switch upper := strings.ToUpper(item); {
+		case strings.HasPrefix(upper, "T:"):
+			protocol, item = TCP, item[2:]
+		case strings.HasPrefix(upper, "U:"):
+			protocol, item = UDP, item[2:]
+		}
+		if item == "" {
+			continue
+		}
+		if err := set.addItem(protocol, item); err != nil {
+			return nil, err
+		}
+	}
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("port specification %q contains no ports", spec)
+	}
+	return set, nil
+}
+
+// ParseFile parses a file of port specifications, one or more per line. Everything after a # is a comment.
+func ParseFile(path string) (*Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	set, err := Parse(strings.Join(lines, ","))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// FromStrings returns the Set of ports in the format of Strings, e.g. 22, 8000-8100 and U:53
+func FromStrings(ports []string) (*Set, error) {
+	set := New()
+	for _, port := range ports {
+		protocol := TCP
+		if strings.HasPrefix(strings.ToUpper(port), "U:") {
+			protocol, port = UDP, port[2:]
+		}
+		if err := set.addItem(protocol, port); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// addItem adds a single port, range, top:N or all item of protocol
+func (s *Set) addItem(protocol, item string) error {
+	lower := strings.ToLower(item)
+	switch {
+	case lower == "all" || item == "-":
+		s.addRange(protocol, 1, MaxPort)
+		return nil
+	case strings.HasPrefix(lower, "top:"):
+		n, err := strconv.Atoi(item[4:])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid top ports %q, use top:N with N of at least 1", item)
+		}
+		top, err := Top(protocol, n)
+		if err != nil {
+			return err
+		}
+		for _, port := range top {
+			s.Add(protocol, port)
+		}
+		return nil
+	}
+
+	start, end, isRange := strings.Cut(item, "-")
+	if !isRange {
+		port, err := parsePort(start)
+		if err != nil {
+			return err
+		}
+		s.Add(protocol, port)
+		return nil
+	}
+	// like nmap an open range such as 1024- or -1024 extends to the highest or lowest port
+	first, last := 1, MaxPort
+	var err error
+	if start != "" {
+		if first, err = parsePort(start); err != nil {
+			return err
+		}
+	}
+	if end != "" {
+		if last, err = parsePort(end); err != nil {
+			return err
+		}
+	}
+	if first > last {
+		return fmt.Errorf("invalid port range %q, the first port is higher than the last", item)
+	}
+	s.addRange(protocol, first, last)
+	return nil
+}
+
+func (s *Set) addRange(protocol string, first, last int) {
+	for port := first; port <= last; port++ {
+		s.Add(protocol, port)
+	}
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > MaxPort {
+		return 0, fmt.Errorf("invalid port %q, ports are 1-%d", value, MaxPort)
+	}
+	return port, nil
+}
+
+// Add adds port of protocol to the set
+func (s *Set) Add(protocol string, port int) {
+	if protocol == UDP {
+		s.udp[port] = struct{}{}
+		return
+	}
+	s.tcp[port] = struct{}{}
+}
+
+// TCP returns the sorted TCP ports
+func (s *Set) TCP() []int {
+	return sorted(s.tcp)
+}
+
+// UDP returns the sorted UDP ports
+func (s *Set) UDP() []int {
+	return sorted(s.udp)
+}
+
+// Len returns the number of TCP and UDP ports
+func (s *Set) Len() int {
+	return len(s.tcp) + len(s.udp)
+}
+
+// HasUDP reports whether the set contains UDP ports
+func (s *Set) HasUDP() bool {
+	return len(s.udp) > 0
+}
+
+// Spec returns the set as a compact nmap port specification with consecutive ports collapsed into ranges,
+// e.g. 22,80,8000-8100 or T:22,U:53,161 when the set contains UDP ports
+func (s *Set) Spec() string {
+	tcp, udp := ranges(s.TCP()), ranges(s.UDP())
+	switch {
+	case len(udp) == 0:
+		return strings.Join(tcp, ",")
+	case len(tcp) == 0:
+		return "U:" + strings.Join(udp, ",")
+	default:
+		return "T:" + strings.Join(tcp, ",") + ",U:" + strings.Join(udp, ",")
+	}
+}
+
+// Strings returns the TCP ranges followed by the UDP ranges prefixed with U:, e.g. [22 8000-8100 U:53]
+func (s *Set) Strings() []string {
+	values := ranges(s.TCP())
+	for _, r := range ranges(s.UDP()) {
+		values = append(values, "U:"+r)
+	}
+	return values
+}
+
+// ranges collapses sorted ports into ranges such as 20-23
+func ranges(ports []int) []string {
+	var values []string
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if i == j {
+			values = append(values, strconv.Itoa(ports[i]))
+		} else {
+			values = append(values, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		}
+		i = j + 1
+	}
+	return values
+}
+
+func sorted(ports map[int]struct{}) []int {
+	values := make([]int, 0, len(ports))
+	for port := range ports {
+		values = append(values, port)
+	}
+	sort.Ints(values)
+	return values
+}
@@ -0,0 +1,177 @@
+package ports
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantTCP []int
+		wantUDP []int
+		wantErr bool
+	}{
+		{"Single Ports", "22,80,443", []int{22, 80, 443}, nil, false},
+		{"Range", "8000-8003,22", []int{22, 8000, 8001, 8002, 8003}, nil, false},
+		{"Duplicates", "22,22,20-23", []int{20, 21, 22, 23}, nil, false},
+		{"Protocol Prefixes", "T:22,U:53,161,T:80", []int{22, 80}, []int{53, 161}, false},
+		{"Lowercase Prefix", "u:53", nil, []int{53}, false},
+		{"Open Ranges", "65533-,-2", []int{1, 2, 65533, 65534, 65535}, nil, false},
+		{"Top Ports", "top:3", []int{23, 80, 443}, nil, false},
+		{"UDP Top Ports", "U:top:2", nil, []int{161, 631}, false},
+		{"Whitespace", " 22, 80 ", []int{22, 80}, nil, false},
+		{"Port Zero", "0", nil, nil, true},
+		{"Port Too High", "65536", nil, nil, true},
+		{"Reversed Range", "100-1", nil, nil, true},
+		{"Not A Port", "http", nil, nil, true},
+		{"Bad Top", "top:none", nil, nil, true},
+		{"Empty", "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if gotTCP := got.TCP(); len(gotTCP) > 0 || len(tt.wantTCP) > 0 {
+				if !reflect.DeepEqual(gotTCP, tt.wantTCP) {
+					t.Errorf("Parse() TCP = %v, want %v", gotTCP, tt.wantTCP)
+				}
+			}
+			if gotUDP := got.UDP(); len(gotUDP) > 0 || len(tt.wantUDP) > 0 {
+				if !reflect.DeepEqual(gotUDP, tt.wantUDP) {
+					t.Errorf("Parse() UDP = %v, want %v", gotUDP, tt.wantUDP)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	set, err := Parse("all")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if set.Len() != MaxPort {
+		t.Errorf("Len() got = %d, want %d", set.Len(), MaxPort)
+	}
+	if got := set.Spec(); got != "1-65535" {
+		t.Errorf("Spec() got = %s, want 1-65535", got)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		wantSpec    string
+		wantStrings []string
+	}{
+		{"TCP", "80,22,21,20", "20-22,80", []string{"20-22", "80"}},
+		{"TCP and UDP", "22,U:53,161,162", "T:22,U:53,161-162", []string{"22", "U:53", "U:161-162"}},
+		{"UDP Only", "U:161", "U:161", []string{"U:161"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := set.Spec(); got != tt.wantSpec {
+				t.Errorf("Spec() got = %s, want %s", got, tt.wantSpec)
+			}
+			if got := set.Strings(); !reflect.DeepEqual(got, tt.wantStrings) {
+				t.Errorf("Strings() got = %v, want %v", got, tt.wantStrings)
+			}
+			roundTrip, err := FromStrings(set.Strings())
+			if err != nil {
+				t.Fatalf("FromStrings() error = %v", err)
+			}
+			if got := roundTrip.Spec(); got != tt.wantSpec {
+				t.Errorf("FromStrings().Spec() got = %s, want %s", got, tt.wantSpec)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports.txt")
+	content := "# web ports\n80,443\n8000-8002 # dev servers\n\nU:53\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if got := set.Spec(); got != "T:80,443,8000-8002,U:53" {
+		t.Errorf("ParseFile() got = %s", got)
+	}
+}
+
+func TestTop(t *testing.T) {
+	// the embedded data has to select the same sets as nmap's --top-ports
+	rankings, err := loadEmbedded()
+	if err != nil {
+		t.Fatalf("loadEmbedded() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		protocol string
+		want     int
+	}{
+		{"TCP", TCP, 1000},
+		{"UDP", UDP, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranking := rankings[tt.protocol]
+			if len(ranking) != tt.want {
+				t.Errorf("got %d ports, want %d", len(ranking), tt.want)
+			}
+			seen := make(map[int]bool)
+			for _, port := range ranking {
+				if seen[port] {
+					t.Errorf("port %d is ranked twice", port)
+				}
+				seen[port] = true
+			}
+		})
+	}
+}
+
+func TestTopMoreThanKnown(t *testing.T) {
+	got, err := Top(UDP, 100000)
+	if err != nil {
+		t.Fatalf("Top() error = %v", err)
+	}
+	if len(got) == 0 || len(got) >= 100000 {
+		t.Errorf("Top() got %d ports, want every known port", len(got))
+	}
+}
+
+func TestParseNmapServices(t *testing.T) {
+	services := `# comment
+tcpmux	1/tcp	0.001995	# TCP Port Service Multiplexer [rfc-1078]
+http	80/tcp	0.484143	# World Wide Web HTTP
+ssh	22/tcp	0.182286	# Secure Shell Login
+domain	53/udp	0.213496	# Domain Name Server
+snmp	161/udp	0.433467	# Simple Net Mgmt Proto
+`
+	got, err := parseNmapServices(strings.NewReader(services))
+	if err != nil {
+		t.Fatalf("parseNmapServices() error = %v", err)
+	}
+	want := map[string][]int{TCP: {80, 22, 1}, UDP: {161, 53}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNmapServices() got = %v, want %v", got, want)
+	}
+}
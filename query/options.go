@@ -0,0 +1,170 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/store"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Options are the options of the query command
+type Options struct {
+	// Database is the results database, see store.Path
+	Database string
+	// Run is the run that is queried, 0 queries the latest run
+	Run int64
+	// Runs lists the saved runs, it is the default when no other question is asked
+	Runs bool
+	// OpenPort asks for every host with a port open, e.g. 445 or 161/udp
+	OpenPort string
+	// Product asks for every distinct product of a service, e.g. http
+	Product string
+	// NotIn asks for the hosts of Run that this run did not find
+	NotIn int64
+	// SQL is a read only SQL query against the database
+	SQL    string
+	Format string
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	cmd.PersistentFlags().Int64P("run", "r", 0, "ID of the run to query, defaults to the latest run")
+	cmd.PersistentFlags().BoolP("runs", "", false, "list every saved run, the default when nothing else is asked")
+	cmd.PersistentFlags().StringP("open-port", "p", "", "list every host with this port open, e.g. 445 or 161/udp")
+	cmd.PersistentFlags().StringP("product", "", "", "list every distinct product and version of a service such as http, prefixes match so http includes https")
+	cmd.PersistentFlags().Int64P("not-in", "", 0, "list the hosts of --run that this run did not find")
+	cmd.PersistentFlags().StringP("sql", "", "", "run a read only SQL query against the results database")
+	cmd.PersistentFlags().StringP("format", "", "text", "format to print the results in, text, json or csv")
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	database, err := utils.ResolveAbsPath(args[0])
+	if err != nil {
+		return err
+	}
+	opts.Database = store.Path(database)
+
+	if opts.Run, err = cmd.Flags().GetInt64("run"); err != nil {
+		return err
+	}
+	if opts.Runs, err = cmd.Flags().GetBool("runs"); err != nil {
+		return err
+	}
+	if opts.OpenPort, err = cmd.Flags().GetString("open-port"); err != nil {
+		return err
+	}
+	if opts.OpenPort != "" {
+		if _, _, err = parsePort(opts.OpenPort); err != nil {
+			return err
+		}
+	}
+	if opts.Product, err = cmd.Flags().GetString("product"); err != nil {
+		return err
+	}
+	if opts.NotIn, err = cmd.Flags().GetInt64("not-in"); err != nil {
+		return err
+	}
+	if opts.SQL, err = cmd.Flags().GetString("sql"); err != nil {
+		return err
+	}
+
+	questions := 0
+	for _, asked := range []bool{opts.Runs, opts.OpenPort != "", opts.Product != "", opts.NotIn != 0, opts.SQL != ""} {
+		if asked {
+			questions++
+		}
+	}
+	switch questions {
+	case 0:
+		opts.Runs = true
+	case 1:
+	default:
+		return errors.New("ask one of --runs, --open-port, --product, --not-in or --sql at a time")
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	opts.Format = strings.ToLower(format)
+	if _, ok := writers[opts.Format]; !ok {
+		return fmt.Errorf("unsupported query format %q, use text, json or csv", format)
+	}
+
+	return nil
+}
+
+// Run answers the question of opts from the results database and prints the answer
+func Run(ctx context.Context, opts *Options) (*store.Table, error) {
+	if _, err := os.Stat(opts.Database); err != nil {
+		return nil, fmt.Errorf("no results database found: %w", err)
+	}
+	db, err := store.OpenReadOnly(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	table, err := ask(ctx, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = writers[opts.Format](os.Stdout, table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// ask runs the query of the question of opts
+func ask(ctx context.Context, db *store.Store, opts *Options) (*store.Table, error) {
+	switch {
+	case opts.Runs:
+		return db.Runs(ctx)
+	case opts.SQL != "":
+		return db.Query(ctx, opts.SQL)
+	}
+	run := opts.Run
+	if run == 0 {
+		latest, err := db.LatestRun(ctx)
+		if err != nil {
+			return nil, err
+		}
+		run = latest
+	}
+	switch {
+	case opts.OpenPort != "":
+		port, protocol, err := parsePort(opts.OpenPort)
+		if err != nil {
+			return nil, err
+		}
+		return db.OpenPort(ctx, run, port, protocol)
+	case opts.Product != "":
+		return db.Products(ctx, run, opts.Product)
+	default:
+		return db.HostsNotIn(ctx, run, opts.NotIn)
+	}
+}
+
+// parsePort parses a port with an optional protocol such as 445 or 161/udp, the protocol defaults to tcp
+func parsePort(value string) (int, string, error) {
+	portValue, protocol, found := strings.Cut(strings.ToLower(strings.TrimSpace(value)), "/")
+	if !found {
+		protocol = "tcp"
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, "", fmt.Errorf("invalid port %q, use a port such as 445 or 161/udp", value)
+	}
+	switch protocol {
+	case "tcp", "udp", "sctp":
+		return port, protocol, nil
+	}
+	return 0, "", fmt.Errorf("invalid protocol %q, use tcp, udp or sctp", protocol)
+}
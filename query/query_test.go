@@ -0,0 +1,61 @@
+package query
+
+import (
+	"bytes"
+	"github.com/mr-pmillz/goforit/store"
+	"testing"
+)
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantPort     int
+		wantProtocol string
+		wantErr      bool
+	}{
+		{"445", 445, "tcp", false},
+		{"161/udp", 161, "udp", false},
+		{" 443/TCP ", 443, "tcp", false},
+		{"0", 0, "", true},
+		{"70000", 0, "", true},
+		{"http", 0, "", true},
+		{"53/icmp", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			port, protocol, err := parsePort(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if port != tt.wantPort || protocol != tt.wantProtocol {
+				t.Errorf("parsePort() got = %d/%s, want %d/%s", port, protocol, tt.wantPort, tt.wantProtocol)
+			}
+		})
+	}
+}
+
+func TestWriters(t *testing.T) {
+	table := &store.Table{
+		Columns: []string{"address", "product"},
+		Rows:    [][]string{{"10.0.0.1", "nginx"}, {"10.0.0.2", "Apache, httpd"}},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"text", "ADDRESS   PRODUCT\n10.0.0.1  nginx\n10.0.0.2  Apache, httpd\n2 row(s)\n"},
+		{"csv", "address,product\n10.0.0.1,nginx\n10.0.0.2,\"Apache, httpd\"\n"},
+		{"json", "[\n  {\n    \"address\": \"10.0.0.1\",\n    \"product\": \"nginx\"\n  },\n  {\n    \"address\": \"10.0.0.2\",\n    \"product\": \"Apache, httpd\"\n  }\n]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writers[tt.format](&buf, table); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Package query
+
+Copyright © 2023 MrPMillz
+*/
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mr-pmillz/goforit/store"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// writers print a query result in the formats that can be selected with --format
+var writers = map[string]func(w io.Writer, table *store.Table) error{
+	"text": WriteText,
+	"json": WriteJSON,
+	"csv":  WriteCSV,
+}
+
+// WriteText prints the table with aligned columns followed by the number of rows
+func WriteText(w io.Writer, table *store.Table) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, strings.ToUpper(strings.Join(table.Columns, "\t"))); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d row(s)\n", len(table.Rows))
+	return err
+}
+
+// WriteJSON prints every row as a JSON object keyed by column
+func WriteJSON(w io.Writer, table *store.Table) error {
+	rows := make([]map[string]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		object := make(map[string]string, len(table.Columns))
+		for i, column := range table.Columns {
+			object[column] = row[i]
+		}
+		rows = append(rows, object)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// WriteCSV prints the table as CSV with a header row
+func WriteCSV(w io.Writer, table *store.Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Columns); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
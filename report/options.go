@@ -0,0 +1,113 @@
+package report
+
+import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options are the options of the report command
+type Options struct {
+	Directory string
+	File      string
+	Format    string
+	Template  string
+	Title     string
+}
+
+// writers are the report formats that can be selected with --format
+var writers = map[string]struct {
+	fileName string
+	write    func(w io.Writer, title string, doc *export.Document, templateFile string) error
+}{
+	"html":     {fileName: "report.html", write: WriteHTML},
+	"markdown": {fileName: "report.md", write: WriteMarkdown},
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	cmd.PersistentFlags().StringP("file", "f", "", "path of the report to write, defaults to report.html or report.md inside the output directory")
+	cmd.PersistentFlags().StringP("format", "", "html", "report format, html or markdown")
+	cmd.PersistentFlags().StringP("template", "", "", "custom html/template or text/template file to render the report with instead of the built-in template")
+	cmd.PersistentFlags().StringP("title", "", "goforit scan report", "title of the report")
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command, args []string) error {
+	directory, err := utils.ResolveAbsPath(args[0])
+	if err != nil {
+		return err
+	}
+	opts.Directory = directory
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	opts.Format = strings.ToLower(format)
+	writer, ok := writers[opts.Format]
+	if !ok {
+		return fmt.Errorf("unsupported report format %q, use html or markdown", format)
+	}
+
+	file, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "file",
+		IsFilePath: true,
+		Opts:       opts.File,
+	})
+	if err != nil {
+		return err
+	}
+	opts.File = file.(string)
+	if opts.File == "" {
+		opts.File = filepath.Join(opts.Directory, writer.fileName)
+	}
+
+	templateFile, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "template",
+		IsFilePath: true,
+		Opts:       opts.Template,
+	})
+	if err != nil {
+		return err
+	}
+	opts.Template = templateFile.(string)
+
+	title, err := cmd.Flags().GetString("title")
+	if err != nil {
+		return err
+	}
+	opts.Title = title
+
+	return nil
+}
+
+// Run parses the nmap results of opts.Directory and writes the report to opts.File
+func Run(opts *Options) error {
+	results, err := runner.LoadResults(opts.Directory)
+	if err != nil {
+		return err
+	}
+	doc := results.Document
+
+	f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = writers[opts.Format].write(f, opts.Title, doc, opts.Template); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s with %d hosts and %d open ports\n", opts.File, len(doc.Hosts), len(doc.OpenServices()))
+	return nil
+}
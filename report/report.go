@@ -0,0 +1,209 @@
+/*
+Package report
+
+Copyright © 2023 MrPMillz
+*/
+package report
+
+import (
+	"embed"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/report.html.tmpl templates/report.md.tmpl
+var templates embed.FS
+
+// topN is the number of services and operating systems shown in the summary dashboard
+const topN = 10
+
+// Data is everything the report templates render
+type Data struct {
+	Title       string
+	GeneratedAt time.Time
+	Summary     Summary
+	Hosts       []HostView
+	Services    []string
+	Document    *export.Document
+}
+
+// Summary is the dashboard at the top of the report
+type Summary struct {
+	Scans       int
+	HostsUp     int
+	OpenPorts   int
+	Services    int
+	TopServices []Count
+	OSSpread    []Count
+}
+
+// Count is a name and how often it was seen, with its share of the total in percent
+type Count struct {
+	Name    string
+	Count   int
+	Percent int
+}
+
+// HostView is a host and its open services
+type HostView struct {
+	export.Host
+	Open []export.Service
+}
+
+// NewData builds the report data from an export Document
+func NewData(title string, doc *export.Document) *Data {
+	data := &Data{
+		Title:       title,
+		GeneratedAt: time.Now().UTC(),
+		Document:    doc,
+	}
+	serviceCounts := make(map[string]int)
+	osCounts := make(map[string]int)
+	for i := range doc.Hosts {
+		host := doc.Hosts[i]
+		view := HostView{Host: host, Open: host.OpenServices()}
+		data.Hosts = append(data.Hosts, view)
+		data.Summary.OpenPorts += len(view.Open)
+		for _, service := range view.Open {
+			serviceCounts[serviceName(service)]++
+		}
+		osCounts[osFamily(host.OS)]++
+	}
+	data.Summary.Scans = len(doc.Scans)
+	data.Summary.HostsUp = len(doc.Hosts)
+	data.Summary.Services = len(serviceCounts)
+	data.Summary.TopServices = topCounts(serviceCounts, data.Summary.OpenPorts, topN)
+	data.Summary.OSSpread = topCounts(osCounts, data.Summary.HostsUp, topN)
+	for name := range serviceCounts {
+		data.Services = append(data.Services, name)
+	}
+	sort.Strings(data.Services)
+	return data
+}
+
+// WriteHTML renders doc as a single self-contained HTML file. All CSS and JavaScript is inlined
+// so the report works on air-gapped networks. A custom html/template file can be passed as templateFile.
+func WriteHTML(w io.Writer, title string, doc *export.Document, templateFile string) error {
+	text, err := templateText("templates/report.html.tmpl", templateFile)
+	if err != nil {
+		return err
+	}
+	tmpl, err := htmltemplate.New("report").Funcs(funcMap()).Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, NewData(title, doc))
+}
+
+// WriteMarkdown renders doc as Markdown with per-host sections, open port tables and script evidence blocks.
+// A custom text/template file can be passed as templateFile, it receives the same Data as the default template.
+func WriteMarkdown(w io.Writer, title string, doc *export.Document, templateFile string) error {
+	text, err := templateText("templates/report.md.tmpl", templateFile)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("report").Funcs(funcMap()).Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, NewData(title, doc))
+}
+
+// templateText returns the contents of templateFile, or the embedded default template when templateFile is empty
+func templateText(defaultTemplate, templateFile string) (string, error) {
+	if templateFile != "" {
+		data, err := os.ReadFile(templateFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read template: %w", err)
+		}
+		return string(data), nil
+	}
+	data, err := templates.ReadFile(defaultTemplate)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// funcMap are the functions available to the report templates
+func funcMap() map[string]interface{} {
+	return map[string]interface{}{
+		"serviceName": serviceName,
+		"join":        strings.Join,
+		"formatTime":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05 MST") },
+		"cell":        markdownCell,
+		"codeBlock":   markdownCodeBlock,
+	}
+}
+
+// markdownCell escapes s for use inside a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownCodeBlock wraps s in a fenced code block that is longer than any backtick run inside s
+func markdownCodeBlock(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%stext\n%s\n%s", fence, strings.TrimRight(s, "\n"), fence)
+}
+
+// serviceName returns the service name of a port, falling back to unknown
+func serviceName(service export.Service) string {
+	if service.Service == "" {
+		return "unknown"
+	}
+	return service.Service
+}
+
+// osFamily shortens an OS match such as "Linux 4.15 - 5.8" or "Microsoft Windows Server 2019" into something groupable
+func osFamily(os string) string {
+	switch lower := strings.ToLower(os); {
+	case os == "":
+		return "Unknown"
+	case strings.Contains(lower, "windows"):
+		return "Windows"
+	case strings.Contains(lower, "linux"):
+		return "Linux"
+	case strings.Contains(lower, "bsd"):
+		return "BSD"
+	// Cisco IOS is no Apple OS, it has to be matched first
+	case strings.Contains(lower, "cisco"):
+		return "Cisco"
+	case strings.Contains(lower, "apple"), strings.Contains(lower, "mac os"), strings.Contains(lower, "macos"), strings.Contains(lower, "iphone os"):
+		return "Apple"
+	}
+	return os
+}
+
+// topCounts returns the n largest counts sorted by count then name
+func topCounts(counts map[string]int, total, n int) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		percent := 0
+		if total > 0 {
+			percent = count * 100 / total
+		}
+		sorted = append(sorted, Count{Name: name, Count: count, Percent: percent})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,132 @@
+package report
+
+import (
+	"bytes"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/importer"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	run, err := nmapxml.ParseFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not parse test data: %v", err)
+	}
+	doc := export.NewDocument([]nmapxml.Run{*run})
+	doc.Hosts[0].Services[1].Scripts[0].Output = "<script>alert(1)</script>"
+
+	var buf bytes.Buffer
+	if err = WriteHTML(&buf, "ACME <External>", doc, ""); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+	html := buf.String()
+
+	for _, want := range []string{"ACME &lt;External&gt;", "10.0.0.1", "10.0.0.2", "gw.corp.local", "microsoft-ds", "<summary>ssh-hostkey</summary>", "<summary>smb2-time</summary>", "&lt;script&gt;alert(1)&lt;/script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("WriteHTML() output is missing %q", want)
+		}
+	}
+	// the report has to work offline, nothing may be loaded from anywhere else
+	if external := regexp.MustCompile(`(?i)(src|href)=["']?(https?:)?//`).FindString(html); external != "" {
+		t.Errorf("WriteHTML() output references an external resource: %s", external)
+	}
+}
+
+func TestNewData(t *testing.T) {
+	run, err := nmapxml.ParseFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not parse test data: %v", err)
+	}
+	data := NewData("report", export.NewDocument([]nmapxml.Run{*run}))
+	if data.Summary.HostsUp != 2 || data.Summary.OpenPorts != 3 || data.Summary.Services != 3 {
+		t.Errorf("NewData() summary got = %+v", data.Summary)
+	}
+	if got := data.Summary.OSSpread; len(got) != 2 || got[0].Name != "Linux" || got[1].Name != "Unknown" {
+		t.Errorf("NewData() OS spread got = %+v", got)
+	}
+}
+
+func TestOSFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		os   string
+		want string
+	}{
+		{"Empty", "", "Unknown"},
+		{"Windows", "Microsoft Windows Server 2019", "Windows"},
+		{"Linux", "Linux 4.15 - 5.8", "Linux"},
+		{"BSD", "FreeBSD 12.0-RELEASE", "BSD"},
+		{"Mac OS X", "Apple Mac OS X 10.10 (Yosemite)", "Apple"},
+		{"macOS", "Apple macOS 11 (Big Sur)", "Apple"},
+		{"Apple iOS", "Apple iOS 12.0 - 13.3 (Darwin 18.0.0 - 19.0.0)", "Apple"},
+		{"iPhone OS", "iPhone OS 3.1.3", "Apple"},
+		{"Cisco IOS", "Cisco IOS 15.1", "Cisco"},
+		{"Cisco IOS XE", "Cisco IOS XE 16.9", "Cisco"},
+		{"BIOS", "HP iLO 4 BIOS", "HP iLO 4 BIOS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := osFamily(tt.os); got != tt.want {
+				t.Errorf("osFamily(%q) got = %v, want %v", tt.os, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	run, err := nmapxml.ParseFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not parse test data: %v", err)
+	}
+	doc := export.NewDocument([]nmapxml.Run{*run})
+	doc.Hosts[0].Services[1].Product = "nginx | proxy"
+	doc.Hosts[0].Services[1].Scripts[0].Output = "```\ninjected\n```"
+
+	var buf bytes.Buffer
+	if err = WriteMarkdown(&buf, "ACME External", doc, ""); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	markdown := buf.String()
+	for _, want := range []string{"# ACME External", "### 10.0.0.1 (gw.corp.local)", "| 22 | tcp | ssh | OpenSSH | 8.9p1 Ubuntu 3ubuntu0.1 |", "nginx \\| proxy", "````text\n```\ninjected\n```\n````", "#### Host script smb2-time"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("WriteMarkdown() output is missing %q", want)
+		}
+	}
+
+	templateFile := filepath.Join(t.TempDir(), "custom.md.tmpl")
+	if err = os.WriteFile(templateFile, []byte("{{ range .Hosts }}{{ .Address }}={{ len .Open }}\n{{ end }}"), 0600); err != nil {
+		t.Fatalf("could not write template: %v", err)
+	}
+	buf.Reset()
+	if err = WriteMarkdown(&buf, "custom", doc, templateFile); err != nil {
+		t.Fatalf("WriteMarkdown() with custom template error = %v", err)
+	}
+	if got, want := buf.String(), "10.0.0.1=2\n10.0.0.2=1\n"; got != want {
+		t.Errorf("WriteMarkdown() with custom template got = %q, want %q", got, want)
+	}
+}
+
+func TestRunImportedInventory(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := importer.Run(&importer.Options{Paths: []string{"../nmapxml/testdata/multihost.xml"}, Output: dir, OutputFormat: []string{"csv"}}); err != nil {
+		t.Fatalf("importer.Run() error = %v", err)
+	}
+	opts := &Options{Directory: dir, File: filepath.Join(dir, "report.md"), Format: "markdown", Title: "inventory"}
+	if err := Run(opts); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	data, err := os.ReadFile(opts.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"10.0.0.1", "10.0.0.2", "microsoft-ds"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Run() report is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	capNetAdmin = 12
+	capNetRaw   = 13
+	// vfsCapFlagsEffective is set when the file capabilities are raised into the effective set on exec
+	vfsCapFlagsEffective = 0x000001
+)
+
+// hasRawSocketCapabilities reports whether the file capabilities of binary grant cap_net_raw and cap_net_admin
+func hasRawSocketCapabilities(binaryPath string) bool {
+	path, err := filepath.EvalSymlinks(binaryPath)
+	if err != nil {
+		return false
+	}
+	data := make([]byte, 64)
+	n, err := syscall.Getxattr(path, "security.capability", data)
+	if err != nil {
+		return false
+	}
+	return rawSocketCapabilities(data[:n])
+}
+
+// rawSocketCapabilities parses a security.capability extended attribute (struct vfs_cap_data).
+// nmap and masscan are not capability aware, so the capabilities have to be effective on exec as with setcap +eip.
+func rawSocketCapabilities(data []byte) bool {
+	if len(data) < 12 {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(data[0:4])
+	permitted := binary.LittleEndian.Uint32(data[4:8])
+	want := uint32(1<<capNetAdmin | 1<<capNetRaw)
+	return magic&vfsCapFlagsEffective != 0 && permitted&want == want
+}
@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestRawSocketCapabilities(t *testing.T) {
+	vfsCapData := func(magic, permitted uint32) []byte {
+		data := make([]byte, 20)
+		binary.LittleEndian.PutUint32(data[0:4], magic)
+		binary.LittleEndian.PutUint32(data[4:8], permitted)
+		return data
+	}
+	const vfsCapRevision2 = 0x02000000
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"Effective Raw And Admin", vfsCapData(vfsCapRevision2|vfsCapFlagsEffective, 1<<capNetRaw|1<<capNetAdmin|1<<10), true},
+		{"Not Effective", vfsCapData(vfsCapRevision2, 1<<capNetRaw|1<<capNetAdmin), false},
+		{"Only Raw", vfsCapData(vfsCapRevision2|vfsCapFlagsEffective, 1<<capNetRaw), false},
+		{"Truncated", []byte{1, 0, 0, 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rawSocketCapabilities(tt.data); got != tt.want {
+				t.Errorf("rawSocketCapabilities() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package runner
+
+// hasRawSocketCapabilities reports whether the file capabilities of binary grant raw sockets, file capabilities only exist on linux
+func hasRawSocketCapabilities(string) bool {
+	return false
+}
@@ -0,0 +1,423 @@
+package runner
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"github.com/mr-pmillz/goforit/ports"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// engineConnect is the built-in TCP connect scanner, it needs neither nmap nor any privileges
+const engineConnect = "connect"
+
+// DefaultConnectConcurrency is the number of ports of a target the connect engine connects to at the same time
+// when --connect-concurrency is not set
+const DefaultConnectConcurrency = 200
+
+// bannerSize is the most a banner grab reads from a service
+const bannerSize = 1024
+
+// bannerServices name the service of a port by the start of its banner
+var bannerServices = []struct {
+	prefix  string
+	service string
+}{
+	{"SSH-", "ssh"},
+	{"HTTP/", "http"},
+	{"RFB ", "vnc"},
+	{"+OK", "pop3"},
+	{"* OK", "imap"},
+	{"220", "ftp"},
+}
+
+// connectEngine is a pure Go TCP connect scanner. It finds open ports, grabs their banners and writes the results
+// as nmap XML, so that its output is parsed and exported like the output of nmap.
+type connectEngine struct {
+	// concurrency is the number of ports of a target connected to at the same time
+	concurrency int
+	// timeout is how long a connection attempt may take before the port counts as filtered
+	timeout time.Duration
+	// bannerTimeout is how long a banner grab waits for data, 0 disables banner grabbing
+	bannerTimeout time.Duration
+	// rate limits the connection attempts per second across every target, nil does not limit them
+	rate *rateLimiter
+}
+
+func newConnectEngine(opts *Options) (ScanEngine, error) {
+	engine := &connectEngine{
+		concurrency:   opts.ConnectConcurrency,
+		timeout:       opts.ConnectTimeout,
+		bannerTimeout: opts.BannerTimeout,
+	}
+	if engine.concurrency < 1 {
+		engine.concurrency = DefaultConnectConcurrency
+	}
+	if engine.timeout <= 0 {
+		engine.timeout = 2 * time.Second
+	}
+	if opts.ConnectRate > 0 {
+		engine.rate = &rateLimiter{interval: time.Second / time.Duration(opts.ConnectRate)}
+	}
+	return engine, nil
+}
+
+// Capabilities ...
+func (e *connectEngine) Capabilities() Capabilities {
+	return Capabilities{Name: engineConnect, Discovery: true, Final: true}
+}
+
+// OutputFiles returns the nmap XML file the scan of job writes
+func (e *connectEngine) OutputFiles(job *ScanJob) []string {
+	return []string{filepath.Join(job.OutputDir, "nmap", fmt.Sprintf("%s-%s-ports.xml", sanitizeFileName(job.Target), job.OutputName))}
+}
+
+// Scan connects to every TCP port of job, ctx limits the duration of the scan
+func (e *connectEngine) Scan(ctx context.Context, job *ScanJob) (*ScanResult, error) {
+	tcpPorts, err := connectPorts(job)
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+	address, err := resolveTarget(ctx, job.Target)
+	if err != nil {
+		return nil, newScanError(ctx, job.Target, err)
+	}
+
+	fmt.Printf("Running a connect scan of %d port(s) against %s\n", len(tcpPorts), job.Target)
+	start := time.Now()
+	results, err := e.scanPorts(ctx, address, tcpPorts)
+	if ctx.Err() != nil {
+		return nil, newScanError(ctx, job.Target, ctx.Err())
+	}
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+
+	run := connectRun(job.Target, address, tcpPorts, results, start)
+	files := e.OutputFiles(job)
+	if err = writeNmapXML(files[0], run); err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+	var openPorts []string
+	for _, result := range results {
+		if result.state == "open" {
+			openPorts = append(openPorts, strconv.Itoa(result.port))
+			fmt.Printf("\tPort %d/tcp open %s %s\n", result.port, result.service, result.banner)
+		}
+	}
+	builder := export.NewBuilder()
+	for i := range run.Hosts {
+		builder.AddHost(&run.Hosts[i])
+	}
+	return &ScanResult{Files: files, OpenPorts: openPorts, Services: builder.Document().OpenServices()}, nil
+}
+
+// portResult is the outcome of a connection attempt to a single port
+type portResult struct {
+	port    int
+	state   string
+	reason  string
+	banner  string
+	service string
+}
+
+// scanPorts connects to every port of address with e.concurrency workers and returns the results sorted by port.
+// A connection attempt that fails for a local reason stops the scan, its ports would be reported as filtered otherwise.
+func (e *connectEngine) scanPorts(ctx context.Context, address string, tcpPorts []int) ([]portResult, error) {
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan int)
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  []portResult
+		firstErr error
+	)
+	for i := 0; i < e.concurrency && i < len(tcpPorts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range jobs {
+				result, err := e.scanPort(scanCtx, address, port)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+queue:
+	for _, port := range tcpPorts {
+		if e.rate != nil && e.rate.wait(scanCtx) != nil {
+			break
+		}
+		select {
+		case jobs <- port:
+		case <-scanCtx.Done():
+			break queue
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].port < results[j].port })
+	return results, nil
+}
+
+// scanPort connects to a single port and grabs its banner.
+// Like nmap a refused connection means closed and an unanswered or unreachable one filtered,
+// any other failure such as running out of file descriptors is returned.
+func (e *connectEngine) scanPort(ctx context.Context, address string, port int) (portResult, error) {
+	result := portResult{port: port, state: "filtered", reason: "no-response"}
+	dialer := &net.Dialer{Timeout: e.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		var ok bool
+		if result.state, result.reason, ok = dialState(err); !ok && ctx.Err() == nil {
+			return result, fmt.Errorf("could not connect to %s port %d: %w", address, port, err)
+		}
+		return result, nil
+	}
+	defer conn.Close()
+	result.state, result.reason = "open", "syn-ack"
+	if e.bannerTimeout > 0 {
+		result.banner = grabBanner(conn, e.bannerTimeout)
+		result.service = bannerService(result.banner)
+	}
+	return result, nil
+}
+
+// dialState returns the port state and reason of a failed connection attempt,
+// ok is false when the attempt failed for a reason that says nothing about the port
+func dialState(err error) (state, reason string, ok bool) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "closed", "conn-refused", true
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return "filtered", "host-unreach", true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "filtered", "no-response", true
+	}
+	return "filtered", "no-response", false
+}
+
+// grabBanner reads what the service sends after connecting.
+// Services such as HTTP wait for the client to speak first, they are sent a HEAD request.
+func grabBanner(conn net.Conn, timeout time.Duration) string {
+	buf := make([]byte, bannerSize)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	n, _ := conn.Read(buf)
+	if n == 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := conn.Write([]byte("HEAD / HTTP/1.0\r\n\r\n")); err == nil {
+			n, _ = conn.Read(buf)
+		}
+	}
+	return printableBanner(buf[:n])
+}
+
+// printableBanner trims a banner and replaces everything that is not printable like the nmap banner script does
+func printableBanner(data []byte) string {
+	var b strings.Builder
+	for _, r := range strings.ToValidUTF8(strings.TrimSpace(string(data)), "?") {
+		switch {
+		case r == '\r':
+		case r == '\n':
+			b.WriteString("\\n")
+		case unicode.IsPrint(r):
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "\\x%02X", r)
+		}
+	}
+	return b.String()
+}
+
+// bannerService names the service of a banner, empty when the banner is not recognised
+func bannerService(banner string) string {
+	for _, s := range bannerServices {
+		if !strings.HasPrefix(banner, s.prefix) {
+			continue
+		}
+		if s.service == "ftp" && strings.Contains(strings.ToUpper(banner), "SMTP") {
+			return "smtp"
+		}
+		return s.service
+	}
+	return ""
+}
+
+// connectPorts returns the TCP ports of job. Without ports of its own the ports of the job profile are scanned
+// and without those the top 1000 TCP ports. UDP ports are left out, connect scans are TCP only.
+func connectPorts(job *ScanJob) ([]int, error) {
+	set, err := scanPorts(job.Ports, job.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return set.TCP(), nil
+}
+
+// scanPorts returns targetPorts, without them the ports of profile and without those the top 1000 TCP ports
+func scanPorts(targetPorts []string, profile *Profile) (*ports.Set, error) {
+	switch {
+	case len(targetPorts) > 0:
+		return ports.FromStrings(targetPorts)
+	case profile != nil && profile.Ports != "":
+		return ports.Parse(profile.Ports)
+	case profile != nil && profile.TopPorts > 0:
+		return ports.Parse(fmt.Sprintf("top:%d", profile.TopPorts))
+	}
+	return ports.Parse("top:1000")
+}
+
+// resolveTarget returns the address to connect to, the first address of a hostname
+func resolveTarget(ctx context.Context, target string) (string, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		return ip.String(), nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("%s has no addresses", target)
+	}
+	return addrs[0].IP.String(), nil
+}
+
+// connectRun builds the nmap run of a connect scan. A host is up when any port answered, open or closed.
+func connectRun(target, address string, tcpPorts []int, results []portResult, start time.Time) *nmapxml.Run {
+	end := time.Now()
+	set := ports.New()
+	for _, port := range tcpPorts {
+		set.Add(ports.TCP, port)
+	}
+	spec := set.Spec()
+	addrType := "ipv4"
+	if strings.Contains(address, ":") {
+		addrType = "ipv6"
+	}
+	host := nmapxml.Host{
+		StartTime: nmapxml.Timestamp(start),
+		EndTime:   nmapxml.Timestamp(end),
+		Status:    nmapxml.Status{State: "down", Reason: "no-response"},
+		Addresses: []nmapxml.Address{{Addr: address, AddrType: addrType}},
+	}
+	if target != address {
+		host.Hostnames = []nmapxml.Hostname{{Name: target, Type: "user"}}
+	}
+	filtered := 0
+	for _, result := range results {
+		if result.state != "filtered" {
+			host.Status = nmapxml.Status{State: "up", Reason: "conn-refused"}
+		}
+		if result.state != "open" {
+			if result.state == "filtered" {
+				filtered++
+			}
+			continue
+		}
+		host.Status = nmapxml.Status{State: "up", Reason: "syn-ack"}
+		port := nmapxml.Port{
+			Protocol: "tcp",
+			PortID:   result.port,
+			State:    nmapxml.State{State: result.state, Reason: result.reason},
+			Service:  nmapxml.Service{Name: result.service, Method: "probed", Conf: 3},
+		}
+		if result.banner != "" {
+			port.Scripts = []nmapxml.Script{{ID: "banner", Output: result.banner}}
+		}
+		host.Ports = append(host.Ports, port)
+	}
+	closed := len(results) - len(host.Ports) - filtered
+	for state, count := range map[string]int{"closed": closed, "filtered": filtered} {
+		if count > 0 {
+			host.ExtraPorts = append(host.ExtraPorts, nmapxml.ExtraPorts{State: state, Count: count})
+		}
+	}
+	sort.Slice(host.ExtraPorts, func(i, j int) bool { return host.ExtraPorts[i].State < host.ExtraPorts[j].State })
+
+	up := 0
+	if host.Up() {
+		up = 1
+	}
+	return &nmapxml.Run{
+		Scanner:          "goforit",
+		Args:             fmt.Sprintf("goforit connect -p %s %s", spec, target),
+		Start:            nmapxml.Timestamp(start),
+		StartStr:         start.Format(time.ANSIC),
+		XMLOutputVersion: "1.05",
+		ScanInfo:         []nmapxml.ScanInfo{{Type: "connect", Protocol: "tcp", NumServices: len(tcpPorts), Services: spec}},
+		Hosts:            []nmapxml.Host{host},
+		RunStats: nmapxml.RunStats{
+			Finished: nmapxml.Finished{
+				Time:    nmapxml.Timestamp(end),
+				TimeStr: end.Format(time.ANSIC),
+				Elapsed: end.Sub(start).Seconds(),
+				Summary: fmt.Sprintf("goforit connect scan done: 1 IP address (%d host up) scanned in %.2f seconds", up, end.Sub(start).Seconds()),
+				Exit:    "success",
+			},
+			Hosts: nmapxml.HostStats{Up: up, Down: 1 - up, Total: 1},
+		},
+	}
+}
+
+// writeNmapXML writes run as an nmap XML output file
+func writeNmapXML(path string, run *nmapxml.Run) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := xml.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0600)
+}
+
+// rateLimiter spaces calls to wait at least interval apart
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next call is allowed or ctx is cancelled
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"context"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listen starts a TCP server on a free local port that greets every connection with banner
+func listen(t *testing.T, banner string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if banner != "" {
+				_, _ = conn.Write([]byte(banner))
+			}
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+	return port
+}
+
+func TestConnectEngineScan(t *testing.T) {
+	sshPort := listen(t, "SSH-2.0-OpenSSH_9.6\r\n")
+	closed := closedPort(t)
+	engine, err := newConnectEngine(&Options{ConnectConcurrency: 4, ConnectTimeout: time.Second, BannerTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &ScanJob{
+		Phase:      engineConnect,
+		Target:     "127.0.0.1",
+		Ports:      []string{strconv.Itoa(sshPort), strconv.Itoa(closed)},
+		OutputDir:  t.TempDir(),
+		OutputName: engineConnect,
+	}
+	result, err := engine.Scan(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if want := []string{strconv.Itoa(sshPort)}; !reflect.DeepEqual(result.OpenPorts, want) {
+		t.Errorf("Scan() open ports got = %v, want %v", result.OpenPorts, want)
+	}
+	if len(result.Services) != 1 || result.Services[0].Port != sshPort {
+		t.Errorf("Scan() services got = %v, want the service on port %d", result.Services, sshPort)
+	}
+
+	run, err := parseNmapFile(result.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := run.Hosts[0]
+	if !host.Up() || len(host.Ports) != 1 {
+		t.Fatalf("host got = %+v, want up with a single open port", host)
+	}
+	port := host.Ports[0]
+	if port.PortID != sshPort || port.Service.Name != "ssh" {
+		t.Errorf("port got = %d/%s, want %d/ssh", port.PortID, port.Service.Name, sshPort)
+	}
+	if len(port.Scripts) != 1 || port.Scripts[0].Output != "SSH-2.0-OpenSSH_9.6" {
+		t.Errorf("banner got = %+v, want SSH-2.0-OpenSSH_9.6", port.Scripts)
+	}
+	if want := []nmapxml.ExtraPorts{{State: "closed", Count: 1}}; !reflect.DeepEqual(host.ExtraPorts, want) {
+		t.Errorf("extra ports got = %+v, want %+v", host.ExtraPorts, want)
+	}
+}
+
+func TestPrintableBanner(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"SSH", "SSH-2.0-OpenSSH_9.6\r\n", "SSH-2.0-OpenSSH_9.6"},
+		{"Multiline", "220 mail ESMTP\r\n250 OK\r\n\r\n", "220 mail ESMTP\\n250 OK"},
+		{"Binary", "RFB\x00\x01", "RFB\\x00\\x01"},
+		{"Empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := printableBanner([]byte(tt.data)); got != tt.want {
+				t.Errorf("printableBanner() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBannerService(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   string
+	}{
+		{"SSH-2.0-OpenSSH_9.6", "ssh"},
+		{"HTTP/1.1 200 OK\\nServer: nginx", "http"},
+		{"220 mail.example.com ESMTP Postfix", "smtp"},
+		{"220 (vsFTPd 3.0.5)", "ftp"},
+		{"+OK Dovecot ready.", "pop3"},
+		{"RFB 003.008", "vnc"},
+		{"hello", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.banner, func(t *testing.T) {
+			if got := bannerService(tt.banner); got != tt.want {
+				t.Errorf("bannerService() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialState(t *testing.T) {
+	dialErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+	tests := []struct {
+		name       string
+		err        error
+		wantState  string
+		wantReason string
+		wantOK     bool
+	}{
+		{"Refused", dialErr(syscall.ECONNREFUSED), "closed", "conn-refused", true},
+		{"Host Unreachable", dialErr(syscall.EHOSTUNREACH), "filtered", "host-unreach", true},
+		{"Timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, "filtered", "no-response", true},
+		{"Too Many Open Files", dialErr(syscall.EMFILE), "filtered", "no-response", false},
+		{"Network Unreachable", dialErr(syscall.ENETUNREACH), "filtered", "no-response", false},
+		{"Permission Denied", dialErr(syscall.EACCES), "filtered", "no-response", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, reason, ok := dialState(tt.err)
+			if state != tt.wantState || reason != tt.wantReason || ok != tt.wantOK {
+				t.Errorf("dialState() got = %s, %s, %v, want %s, %s, %v", state, reason, ok, tt.wantState, tt.wantReason, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// engineNmap runs the nmap binary for every target and parses its XML output
+	engineNmap = "nmap"
+	// engineNmapStream runs nmap through the nmap library and prints the results of every target as soon as it finishes
+	engineNmapStream = "nmap-stream"
+	// batchJobTarget is the target of the single job of a batch engine, see Capabilities.Batch
+	batchJobTarget = "*"
+)
+
+// ScanJob is the scan of a single target by a ScanEngine
+type ScanJob struct {
+	// Phase is the scan phase the job belongs to
+	Phase string
+	// Target is the host, CIDR or range to scan, batchJobTarget for the job of a batch engine
+	Target string
+	// Targets are every target of the job of a batch engine and their ports
+	Targets map[string][]string
+	// Ports are the ports to scan, nil scans the ports of Profile
+	Ports []string
+	// Profile holds the scan arguments
+	Profile *Profile
+	// OutputDir is the scan output directory
+	OutputDir string
+	// OutputName tells the output files of the phases apart, see scanPhase.outputName
+	OutputName string
+	// Exclude are the addresses of a range target that are not scanned, as CIDRs
+	Exclude []string
+	// HostTimeout limits the scan of every host of a range target, the scan of the whole range is not limited
+	HostTimeout time.Duration
+}
+
+// nmapArgs returns the nmap arguments of job without the target and output options
+func (job *ScanJob) nmapArgs() []string {
+	args := job.Profile.nmapArgs(job.Ports)
+	if job.HostTimeout > 0 {
+		args = append(args, "--host-timeout", fmt.Sprintf("%dms", job.HostTimeout.Milliseconds()))
+	}
+	if len(job.Exclude) > 0 {
+		args = append(args, "--exclude", strings.Join(job.Exclude, ","))
+	}
+	return args
+}
+
+// ScanResult is the outcome of a ScanJob
+type ScanResult struct {
+	// Files are the output files the scan wrote
+	Files []string
+	// OpenPorts are the open ports found, UDP ports are prefixed with U:. They are the ports the next pipeline stage scans.
+	OpenPorts []string
+	// Services are the open services found, the notifications about new services are sent for them
+	Services []export.Service
+	// Hosts are the open ports of every target of the job of a batch engine, targets without open ports are left out
+	Hosts map[string][]string
+}
+
+// Capabilities describes what a ScanEngine can do
+type Capabilities struct {
+	// Name is the name the engine is selected with in --engines
+	Name string
+	// Discovery engines find open ports, only they can run before another stage of a pipeline
+	Discovery bool
+	// Final engines write the results that are exported, only they can be the last stage of a pipeline
+	Final bool
+	// Privileged engines run nmap, their profiles are adapted to the privileges nmap runs with
+	Privileged bool
+	// UDP reports whether the engine can scan UDP ports
+	UDP bool
+	// Streams reports whether Scan returns the parsed Run so that the results are printed as soon as a target finishes
+	Streams bool
+	// Ranges reports whether the engine scans a CIDR or range target at once, their addresses are scanned one by one otherwise
+	Ranges bool
+	// Batch engines scan every target of a phase in a single job, e.g. masscan
+	Batch bool
+}
+
+// ScanEngine scans a single target at a time, or every target at once when it is a batch engine. Hosts.Scanner composes engines into the pipeline selected with --engines.
+type ScanEngine interface {
+	// Capabilities returns what the engine can do
+	Capabilities() Capabilities
+	// OutputFiles returns the files Scan writes for job, they are recorded in the journal before the scan starts
+	OutputFiles(job *ScanJob) []string
+	// Scan runs job, ctx limits how long it may take. Failures are returned as *ScanError so that they can be retried.
+	Scan(ctx context.Context, job *ScanJob) (*ScanResult, error)
+}
+
+// engines are the scan engines that can be selected with --engines
+var engines = map[string]func(opts *Options) (ScanEngine, error){
+	engineConnect:    newConnectEngine,
+	engineMasscan:    newMasscanEngine,
+	engineNmap:       newNmapExecEngine,
+	engineNmapStream: newNmapStreamEngine,
+}
+
+// EngineNames returns the names of every scan engine
+func EngineNames() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateEngines returns an error for an unknown engine or a pipeline that does not end with an engine scanning services
+func ValidateEngines(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no scan engines selected, available engines: %s", strings.Join(EngineNames(), ", "))
+	}
+	for _, name := range names {
+		if _, ok := engines[name]; !ok {
+			return fmt.Errorf("unknown scan engine %q, available engines: %s", name, strings.Join(EngineNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// newPipeline creates the engines of the pipeline in the order they run, opts configures the engines.
+// Every stage but the last has to be a discovery engine, the open ports it finds are the ports the next stage scans.
+func newPipeline(names []string, opts *Options) ([]ScanEngine, error) {
+	if err := ValidateEngines(names); err != nil {
+		return nil, err
+	}
+	pipeline := make([]ScanEngine, 0, len(names))
+	for i, name := range names {
+		engine, err := engines[name](opts)
+		if err != nil {
+			return nil, err
+		}
+		capabilities := engine.Capabilities()
+		switch last := i == len(names)-1; {
+		case last && !capabilities.Final:
+			return nil, fmt.Errorf("the %s engine only discovers open ports, it cannot be the last engine of the pipeline", name)
+		case !last && !capabilities.Discovery:
+			return nil, fmt.Errorf("the %s engine can only be the last engine of the pipeline", name)
+		}
+		pipeline = append(pipeline, engine)
+	}
+	return pipeline, nil
+}
+
+// scanPhase is a scan phase that runs an engine against targets, e.g. the TCP phase or the UDP phase
+type scanPhase struct {
+	// Name identifies the phase in the journal and selects its worker pool
+	Name string
+	// Engine runs the scans of the phase
+	Engine ScanEngine
+	// Profile holds the scan arguments of the phase
+	Profile *Profile
+	// Targets maps every target to its ports, targets without ports are scanned on the ports of Profile
+	Targets map[string][]string
+	// Exclude holds the addresses of the CIDR and range targets that are not scanned, see Hosts.Exclude
+	Exclude map[string][]string
+	// Finished is called after the scan of every target finished or failed, nil for discovery phases
+	Finished hostFinished
+}
+
+// hostFinished receives the outcome of the scan of a single target, done of the total targets of the phase are finished
+type hostFinished func(job *ScanJob, result *ScanResult, err error, done, total int)
+
+// outputName is the part of the output file names that tells the phases apart, e.g. 10.0.0.1-udp-ports.xml
+func (p *scanPhase) outputName() string {
+	switch p.Name {
+	case phaseNmap:
+		return "top"
+	case phaseUDP:
+		return "udp"
+	}
+	return p.Name
+}
+
+// expandRanges replaces the CIDR and range targets of the phase with their addresses that are not excluded
+func (p *scanPhase) expandRanges() error {
+	for host, ports := range p.Targets {
+		if !isRangeTarget(host) {
+			continue
+		}
+		addrs, err := expandTarget(host, p.Exclude[host])
+		if err != nil {
+			return err
+		}
+		delete(p.Targets, host)
+		for _, addr := range addrs {
+			if _, ok := p.Targets[addr]; !ok {
+				p.Targets[addr] = ports
+			}
+		}
+	}
+	return nil
+}
+
+// runPhase runs the engine of phase against every target concurrently, bounded by pool.
+// Failed scans are retried according to the retry policy of opts.
+func runPhase(ctx context.Context, phase *scanPhase, opts *Options, pool *Pool, journal *Journal) (*phaseResult, error) {
+	var hosts []string
+	for _, target := range sortedTargets(phase.Targets) {
+		if !isValidTarget(target) {
+			log.Printf("skipping invalid target %q", target)
+			continue
+		}
+		hosts = append(hosts, target)
+	}
+	capabilities := phase.Engine.Capabilities()
+	if capabilities.Batch {
+		fmt.Printf("Running the %s phase with the %s engine against %d hosts at once\n", phase.Name, capabilities.Name, len(hosts))
+		return runBatch(ctx, phase, hosts, opts, journal), nil
+	}
+	fmt.Printf("Running the %s phase with the %s engine and the %s profile against %d hosts, %d at a time\n", phase.Name, capabilities.Name, phase.Profile.Name, len(hosts), pool.Workers)
+
+	policy := opts.retryPolicy()
+	progress := newScanProgress()
+	var mu sync.Mutex
+	var finished int
+	pool.Run(ctx, len(hosts), func(ctx context.Context, i int) {
+		job := &ScanJob{
+			Phase:      phase.Name,
+			Target:     hosts[i],
+			Ports:      phase.Targets[hosts[i]],
+			Profile:    phase.Profile,
+			OutputDir:  opts.Output,
+			OutputName: phase.outputName(),
+			Exclude:    phase.Exclude[hosts[i]],
+		}
+		// a range scans many hosts, nmap limits every one of them instead of the whole scan
+		hostTimeout := opts.HostTimeout
+		if isRangeTarget(job.Target) {
+			job.HostTimeout, hostTimeout = opts.HostTimeout, 0
+		}
+		var result *ScanResult
+		err := policy.run(ctx, func(ctx context.Context, attempt int) error {
+			if err := journal.Start(job, phase.Engine.OutputFiles(job)); err != nil {
+				log.Printf("%v", err)
+			}
+			hostCtx, cancel := withHostTimeout(ctx, hostTimeout)
+			defer cancel()
+			var err error
+			result, err = phase.Engine.Scan(hostCtx, job)
+			return err
+		})
+		if ctx.Err() != nil {
+			finishJob(journal, job.Phase, job.Target, ctx.Err())
+			return
+		}
+		progress.finish(job.Target, err)
+		if err == nil {
+			journal.Discovered(job.Phase, job.Target, result.OpenPorts)
+		}
+		finishJob(journal, job.Phase, job.Target, err)
+		if phase.Finished != nil {
+			// only the count is shared, a slow notification must not hold up the other workers
+			mu.Lock()
+			finished++
+			done := finished
+			mu.Unlock()
+			phase.Finished(job, result, err, done, len(hosts))
+		}
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		if capabilities.Streams {
+			printNmapResults(result.Services)
+		}
+	})
+	return progress.result(hosts), nil
+}
+
+// runBatch runs the batch engine of phase against every host in a single job.
+// Every host is recorded in the journal with the open ports found, so that the next stage and a resumed scan find them.
+func runBatch(ctx context.Context, phase *scanPhase, hosts []string, opts *Options, journal *Journal) *phaseResult {
+	if len(hosts) == 0 {
+		return &phaseResult{}
+	}
+	job := &ScanJob{
+		Phase:      phase.Name,
+		Target:     batchJobTarget,
+		Targets:    make(map[string][]string, len(hosts)),
+		Profile:    phase.Profile,
+		OutputDir:  opts.Output,
+		OutputName: phase.outputName(),
+	}
+	for _, host := range hosts {
+		job.Targets[host] = phase.Targets[host]
+	}
+	var result *ScanResult
+	err := opts.retryPolicy().run(ctx, func(ctx context.Context, attempt int) error {
+		if err := journal.Start(job, phase.Engine.OutputFiles(job)); err != nil {
+			log.Printf("%v", err)
+		}
+		var err error
+		result, err = phase.Engine.Scan(ctx, job)
+		return err
+	})
+	finishJob(journal, job.Phase, job.Target, err)
+	progress := newScanProgress()
+	if ctx.Err() != nil {
+		return progress.result(hosts)
+	}
+	if err != nil {
+		log.Printf("%v", err)
+	} else if err = journal.Batch(job, result.Hosts); err != nil {
+		log.Printf("%v", err)
+	}
+	for _, host := range hosts {
+		progress.finish(host, err)
+	}
+	return progress.result(hosts)
+}
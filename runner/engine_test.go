@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEngine is a ScanEngine that answers every job with scan
+type fakeEngine struct {
+	capabilities Capabilities
+	scan         func(job *ScanJob) (*ScanResult, error)
+}
+
+func (e *fakeEngine) Capabilities() Capabilities { return e.capabilities }
+
+func (e *fakeEngine) OutputFiles(*ScanJob) []string { return nil }
+
+func (e *fakeEngine) Scan(_ context.Context, job *ScanJob) (*ScanResult, error) { return e.scan(job) }
+
+func TestNewPipeline(t *testing.T) {
+	engines["fake-discovery"] = func(*Options) (ScanEngine, error) {
+		return &fakeEngine{capabilities: Capabilities{Name: "fake-discovery", Discovery: true}}, nil
+	}
+	engines["fake-scan"] = func(*Options) (ScanEngine, error) {
+		return &fakeEngine{capabilities: Capabilities{Name: "fake-scan", Final: true}}, nil
+	}
+	defer delete(engines, "fake-discovery")
+	defer delete(engines, "fake-scan")
+
+	tests := []struct {
+		name    string
+		engines []string
+		wantErr bool
+	}{
+		{"Single Engine", []string{"fake-scan"}, false},
+		{"Discovery Then Scan", []string{"fake-discovery", "fake-scan"}, false},
+		{"Discovery Last", []string{"fake-scan", "fake-discovery"}, true},
+		{"Only Discovery", []string{"fake-discovery"}, true},
+		{"Unknown Engine", []string{"zmap"}, true},
+		{"Empty", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := newPipeline(tt.engines, &Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPipeline() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(pipeline) != len(tt.engines) {
+				t.Errorf("newPipeline() got %d engines, want %d", len(pipeline), len(tt.engines))
+			}
+		})
+	}
+}
+
+func TestRunPhase(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	engine := &fakeEngine{
+		capabilities: Capabilities{Name: "fake-discovery", Discovery: true},
+		scan: func(job *ScanJob) (*ScanResult, error) {
+			switch job.Target {
+			case "10.0.0.1":
+				return &ScanResult{OpenPorts: []string{"22", "U:161"}}, nil
+			case "10.0.0.2":
+				return &ScanResult{}, nil
+			}
+			return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: errors.New("unreachable")}
+		},
+	}
+	opts := &Options{Output: dir, MaxParallelHosts: 2, MaxAttempts: 1}
+	phase := &scanPhase{
+		Name:    "fake-discovery",
+		Engine:  engine,
+		Profile: opts.scanProfile(),
+		Targets: map[string][]string{"10.0.0.1": nil, "10.0.0.2": nil, "10.0.0.3": nil, "not a target": nil},
+	}
+	result, err := runPhase(context.Background(), phase, opts, opts.newPool(phase.Name, NewLimiter(2)), journal)
+	if err != nil {
+		t.Fatalf("runPhase() error = %v", err)
+	}
+	if want := (&phaseResult{Failed: []string{"10.0.0.3"}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("runPhase() got = %+v, want %+v", result, want)
+	}
+	openPorts := journal.OpenPorts(phase.Name, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+	if want := map[string][]string{"10.0.0.1": {"22", "U:161"}}; !reflect.DeepEqual(openPorts, want) {
+		t.Errorf("OpenPorts() got = %v, want %v", openPorts, want)
+	}
+}
+
+func TestRunPhaseBatch(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	var jobs []*ScanJob
+	engine := &fakeEngine{
+		capabilities: Capabilities{Name: "fake-batch", Discovery: true, Batch: true},
+		scan: func(job *ScanJob) (*ScanResult, error) {
+			jobs = append(jobs, job)
+			return &ScanResult{Hosts: map[string][]string{"10.0.0.1": {"22"}}}, nil
+		},
+	}
+	opts := &Options{Output: dir, MaxParallelHosts: 2, MaxAttempts: 1}
+	phase := &scanPhase{
+		Name:    "fake-batch",
+		Engine:  engine,
+		Profile: opts.scanProfile(),
+		Targets: map[string][]string{"10.0.0.1": nil, "10.0.0.2": {"80"}},
+	}
+	result, err := runPhase(context.Background(), phase, opts, opts.newPool(phase.Name, NewLimiter(2)), journal)
+	if err != nil {
+		t.Fatalf("runPhase() error = %v", err)
+	}
+	if !reflect.DeepEqual(result, &phaseResult{}) {
+		t.Errorf("runPhase() got = %+v, want no failures", result)
+	}
+	if len(jobs) != 1 || jobs[0].Target != batchJobTarget || !reflect.DeepEqual(jobs[0].Targets, phase.Targets) {
+		t.Fatalf("runPhase() ran %+v, want a single job of every target", jobs)
+	}
+	openPorts := journal.OpenPorts(phase.Name, []string{"10.0.0.1", "10.0.0.2"})
+	if want := map[string][]string{"10.0.0.1": {"22"}}; !reflect.DeepEqual(openPorts, want) {
+		t.Errorf("OpenPorts() got = %v, want %v", openPorts, want)
+	}
+	if pending := journal.Pending(phase); len(pending) != 0 {
+		t.Errorf("Pending() got = %v, want every target done", pending)
+	}
+}
+
+func TestScanPhaseExpandRanges(t *testing.T) {
+	phase := &scanPhase{
+		Targets: map[string][]string{"10.0.0.0/29": {"22"}, "10.0.0.1": {"22", "443"}, "example.com": nil},
+		Exclude: map[string][]string{"10.0.0.0/29": {"10.0.0.1/32", "10.0.0.4/30"}},
+	}
+	if err := phase.expandRanges(); err != nil {
+		t.Fatalf("expandRanges() error = %v", err)
+	}
+	want := map[string][]string{"10.0.0.0": {"22"}, "10.0.0.1": {"22", "443"}, "10.0.0.2": {"22"}, "10.0.0.3": {"22"}, "example.com": nil}
+	if !reflect.DeepEqual(phase.Targets, want) {
+		t.Errorf("expandRanges() got = %v, want %v", phase.Targets, want)
+	}
+}
+
+func TestScanJobNmapArgs(t *testing.T) {
+	profile, err := LoadProfile("quick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		job  *ScanJob
+		want string
+	}{
+		{"Single Host", &ScanJob{Target: "10.0.0.1", Ports: []string{"22"}, Profile: profile}, "-vvv -Pn -p 22 -T4 -sS -sV"},
+		{"Range", &ScanJob{Target: "10.0.0.0/24", Ports: []string{"22"}, Profile: profile, Exclude: []string{"10.0.0.1/32", "10.0.0.8/29"}, HostTimeout: 10 * time.Minute},
+			"-vvv -Pn -p 22 -T4 -sS -sV --host-timeout 600000ms --exclude 10.0.0.1/32,10.0.0.8/29"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.job.nmapArgs(), " "); got != tt.want {
+				t.Errorf("nmapArgs() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsPipeline(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		want []string
+	}{
+		{"Default", &Options{}, []string{engineNmap}},
+		{"Stream Nmap", &Options{StreamNmap: true}, []string{engineNmapStream}},
+		{"Masscan", &Options{Masscan: true}, []string{engineMasscan, engineNmap}},
+		{"Masscan With Engines", &Options{Masscan: true, Engines: []string{engineNmapStream}}, []string{engineMasscan, engineNmapStream}},
+		{"Masscan Engine", &Options{Masscan: true, Engines: []string{engineMasscan, engineNmap}}, []string{engineMasscan, engineNmap}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.pipeline(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pipeline() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// incompleteSuffix is appended to the output files of interrupted scans so that their half-written XML is never parsed
+const incompleteSuffix = ".incomplete"
+
+// phaseResult is the outcome of a scan phase
+type phaseResult struct {
+	// Incomplete are the targets that were not scanned to the end because the run was interrupted
+	Incomplete []string
+	// TimedOut are the targets whose last attempt ran into the host timeout
+	TimedOut []string
+	// Failed are the targets whose last attempt failed for any other reason
+	Failed []string
+}
+
+// scanProgress records which targets of a scan phase finished and how
+type scanProgress struct {
+	mu       sync.Mutex
+	finished map[string]error
+}
+
+func newScanProgress() *scanProgress {
+	return &scanProgress{finished: make(map[string]error)}
+}
+
+// finish records the outcome of the scan of target, err is nil when the scan succeeded
+func (p *scanProgress) finish(target string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished[target] = err
+}
+
+// result sorts the targets by their outcome, keeping the order of targets
+func (p *scanProgress) result(targets []string) *phaseResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := &phaseResult{}
+	for _, target := range targets {
+		err, ok := p.finished[target]
+		var scanErr *ScanError
+		switch {
+		case !ok:
+			result.Incomplete = append(result.Incomplete, target)
+		case errors.As(err, &scanErr) && scanErr.Kind == FailureTimeout:
+			result.TimedOut = append(result.TimedOut, target)
+		case err != nil:
+			result.Failed = append(result.Failed, target)
+		}
+	}
+	return result
+}
+
+// merge adds the targets of other that are not in the result yet, a target scanned by several phases is listed once
+func (r *phaseResult) merge(other *phaseResult) {
+	r.Incomplete = appendMissing(r.Incomplete, other.Incomplete)
+	r.TimedOut = appendMissing(r.TimedOut, other.TimedOut)
+	r.Failed = appendMissing(r.Failed, other.Failed)
+}
+
+func appendMissing(targets, add []string) []string {
+	for _, target := range add {
+		found := false
+		for _, t := range targets {
+			if t == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// markIncomplete sets the nmap output files of the targets that phase did not finish aside,
+// so that the partial results of the finished targets and phases can still be parsed
+func markIncomplete(outputDir string, phase *scanPhase, targets []string) error {
+	for _, target := range targets {
+		files, err := targetOutputFiles(outputDir, phase, target)
+		if err != nil {
+			return err
+		}
+		if err = setAside(files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIncomplete lists the interrupted targets in incomplete.txt so that they can be rescanned
+func writeIncomplete(outputDir string, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	incompleteFile := filepath.Join(outputDir, "incomplete.txt")
+	if err := os.WriteFile(incompleteFile, []byte(strings.Join(targets, "\n")+"\n"), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Scan interrupted, %d incomplete target(s) written to %s\n", len(targets), incompleteFile)
+	return nil
+}
+
+// setAsideBrokenOutput sets the nmap output files of the failed or timed out targets of phase aside when their XML cannot be parsed
+func setAsideBrokenOutput(outputDir string, phase *scanPhase, targets []string) error {
+	for _, target := range targets {
+		files, err := targetOutputFiles(outputDir, phase, target)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if filepath.Ext(f) != ".xml" {
+				continue
+			}
+			// only the validity of the file matters, its hosts are not kept
+			if _, err = nmapxml.StreamFile(f, func(*nmapxml.Host) error { return nil }); err != nil {
+				log.Printf("Setting the output of %s aside, %s cannot be parsed: %v\n", target, f, err)
+				if err = setAside(files); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// targetOutputFiles returns the nmap output files of the phase scan of target that were not set aside yet
+func targetOutputFiles(outputDir string, phase *scanPhase, target string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(outputDir, "nmap", sanitizeFileName(target)+"?"+phase.outputName()+"?ports.*"))
+	if err != nil {
+		return nil, err
+	}
+	var outputFiles []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, incompleteSuffix) {
+			outputFiles = append(outputFiles, f)
+		}
+	}
+	return outputFiles, nil
+}
+
+// setAside renames files so that their half-written XML is never parsed
+func setAside(files []string) error {
+	for _, f := range files {
+		if err := os.Rename(f, f+incompleteSuffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
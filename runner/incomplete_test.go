@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMarkIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "nmap"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"10.0.0.1-top-ports.xml", "10.0.0.1-top-ports.nmap", "10.0.0.2-top-ports.xml", "10.0.0.10-top-ports.xml", "scanme.nmap.org_top_ports.xml", "scanme.nmap.org_udp_ports.xml"} {
+		if err := os.WriteFile(filepath.Join(dir, "nmap", name), []byte("<nmaprun>"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	progress := newScanProgress()
+	progress.finish("10.0.0.2", nil)
+	progress.finish("10.0.0.10", &ScanError{Target: "10.0.0.10", Kind: FailureTimeout})
+	progress.finish("10.0.0.11", &ScanError{Target: "10.0.0.11", Kind: FailureExitCode, ExitCode: 1})
+	result := progress.result([]string{"10.0.0.1", "10.0.0.2", "10.0.0.10", "10.0.0.11", "scanme.nmap.org"})
+	want := &phaseResult{Incomplete: []string{"10.0.0.1", "scanme.nmap.org"}, TimedOut: []string{"10.0.0.10"}, Failed: []string{"10.0.0.11"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("result() got = %+v, want %+v", result, want)
+	}
+	incomplete := result.Incomplete
+	// the UDP scan of scanme.nmap.org finished, only its TCP scan is set aside
+	if err := markIncomplete(dir, &scanPhase{Name: phaseNmap}, incomplete); err != nil {
+		t.Fatalf("markIncomplete() error = %v", err)
+	}
+	if err := writeIncomplete(dir, incomplete); err != nil {
+		t.Fatalf("writeIncomplete() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "nmap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	sort.Strings(got)
+	wantFiles := []string{"10.0.0.1-top-ports.nmap.incomplete", "10.0.0.1-top-ports.xml.incomplete", "10.0.0.10-top-ports.xml", "10.0.0.2-top-ports.xml", "scanme.nmap.org_top_ports.xml.incomplete", "scanme.nmap.org_udp_ports.xml"}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("markIncomplete() files got = %v, want %v", got, wantFiles)
+	}
+	listed, err := os.ReadFile(filepath.Join(dir, "incomplete.txt"))
+	if err != nil || string(listed) != "10.0.0.1\nscanme.nmap.org\n" {
+		t.Errorf("incomplete.txt got = %q, %v", listed, err)
+	}
+}
+
+func TestPhaseResultMerge(t *testing.T) {
+	result := &phaseResult{Incomplete: []string{"10.0.0.1"}, Failed: []string{"10.0.0.2"}}
+	result.merge(&phaseResult{Incomplete: []string{"10.0.0.1", "10.0.0.3"}, TimedOut: []string{"10.0.0.4"}})
+	want := &phaseResult{Incomplete: []string{"10.0.0.1", "10.0.0.3"}, TimedOut: []string{"10.0.0.4"}, Failed: []string{"10.0.0.2"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("merge() got = %+v, want %+v", result, want)
+	}
+}
@@ -0,0 +1,259 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobState is the state of a scan job in the Journal
+type JobState string
+
+const (
+	JobPending JobState = "pending"
+	JobRunning JobState = "running"
+	JobDone    JobState = "done"
+	JobFailed  JobState = "failed"
+	// JobTimedOut is a job whose last attempt ran into the host timeout
+	JobTimedOut JobState = "timed-out"
+)
+
+// journalFileName is the name of the journal inside the output directory
+const journalFileName = "journal.jsonl"
+
+// Job is a single target and port set scanned by a scan phase
+type Job struct {
+	Phase  string   `json:"phase"`
+	Target string   `json:"target"`
+	Ports  []string `json:"ports"`
+	// Profile is the name of the scan profile the job ran with
+	Profile string `json:"profile,omitempty"`
+	// Exclude are the addresses of a range target the job left out, see ScanJob.Exclude
+	Exclude []string `json:"exclude,omitempty"`
+	State   JobState `json:"state"`
+	// Files are the output files the job writes
+	Files []string `json:"files,omitempty"`
+	// OpenPorts are the open ports a finished job found, the next pipeline stage scans them
+	OpenPorts []string  `json:"open_ports,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  int       `json:"attempts"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// key identifies a job by phase and target
+func (j *Job) key() string {
+	return j.Phase + "\x00" + j.Target
+}
+
+// Journal is an append-only log of the state of every scan job, one JSON line per state change.
+// It lives in the output directory so that an interrupted scan can be resumed with --resume.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	jobs map[string]*Job
+}
+
+// OpenJournal opens the journal of an output directory.
+// With resume the jobs recorded by an earlier scan are loaded, otherwise the journal starts empty.
+func OpenJournal(outputDir string, resume bool) (*Journal, error) {
+	path := filepath.Join(outputDir, journalFileName)
+	journal := &Journal{jobs: make(map[string]*Job)}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := journal.load(path); err != nil {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	journal.file = f
+	if resume {
+		if err = terminateLastLine(path, f); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return journal, nil
+}
+
+// terminateLastLine ends a journal that was cut off in the middle of a line with a newline,
+// so that the next record starts on a line of its own
+func terminateLastLine(path string, f *os.File) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		_, err = f.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// load replays the journal file, the last recorded state of a job wins
+func (j *Journal) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No journal found at %s, nothing to resume\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		job := &Job{}
+		if err = json.Unmarshal(scanner.Bytes(), job); err != nil {
+			// the last line is cut off when goforit was killed while writing it
+			log.Printf("Skipping invalid journal line %d: %v\n", line, err)
+			continue
+		}
+		j.jobs[job.key()] = job
+	}
+	return scanner.Err()
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Job returns the last recorded state of the job of target in phase
+func (j *Journal) Job(phase, target string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[(&Job{Phase: phase, Target: target}).key()]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Done reports whether the target of job was already scanned in its phase with the same ports, profile and exclusions
+func (j *Journal) Done(job *ScanJob) bool {
+	done, ok := j.Job(job.Phase, job.Target)
+	return ok && done.State == JobDone &&
+		strings.Join(done.Ports, ",") == strings.Join(job.Ports, ",") &&
+		done.Profile == profileName(job.Profile) &&
+		strings.Join(done.Exclude, ",") == strings.Join(job.Exclude, ",")
+}
+
+// Pending returns the targets of phase that still have to be scanned.
+// Finished jobs are skipped, pending, failed, timed out and interrupted jobs are retried.
+func (j *Journal) Pending(phase *scanPhase) map[string][]string {
+	pending := make(map[string][]string, len(phase.Targets))
+	for target, ports := range phase.Targets {
+		if !j.Done(&ScanJob{Phase: phase.Name, Target: target, Ports: ports, Profile: phase.Profile, Exclude: phase.Exclude[target]}) {
+			pending[target] = ports
+		}
+	}
+	if skipped := len(phase.Targets) - len(pending); skipped > 0 {
+		fmt.Printf("Resuming %s phase, skipping %d completed job(s)\n", phase.Name, skipped)
+	}
+	return pending
+}
+
+// Start records that job is running and writes files
+func (j *Journal) Start(job *ScanJob, files []string) error {
+	attempts := 1
+	if started, ok := j.Job(job.Phase, job.Target); ok {
+		attempts = started.Attempts + 1
+	}
+	return j.record(&Job{Phase: job.Phase, Target: job.Target, Ports: job.Ports, Profile: profileName(job.Profile), Exclude: job.Exclude, State: JobRunning, Files: files, Attempts: attempts})
+}
+
+// Discovered keeps the open ports the job of target in phase found, they are written with the state Finish records
+func (j *Journal) Discovered(phase, target string, openPorts []string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job, ok := j.jobs[(&Job{Phase: phase, Target: target}).key()]; ok {
+		job.OpenPorts = openPorts
+	}
+}
+
+// Batch records that every target of the job of a batch engine was scanned and found openPorts
+func (j *Journal) Batch(job *ScanJob, openPorts map[string][]string) error {
+	for _, target := range sortedTargets(job.Targets) {
+		if err := j.record(&Job{Phase: job.Phase, Target: target, Ports: job.Targets[target], Profile: profileName(job.Profile), State: JobDone, OpenPorts: openPorts[target], Attempts: 1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenPorts returns the open ports found by the finished jobs of phase for targets.
+// Targets without open ports are left out, they have nothing left to scan.
+func (j *Journal) OpenPorts(phase string, targets []string) map[string][]string {
+	openPorts := make(map[string][]string)
+	for _, target := range targets {
+		if job, ok := j.Job(phase, target); ok && job.State == JobDone && len(job.OpenPorts) > 0 {
+			openPorts[target] = job.OpenPorts
+		}
+	}
+	return openPorts
+}
+
+// Finish records the outcome of the job of target in phase.
+// A job that was interrupted by a cancelled context or the run deadline is pending again, a ScanError
+// of kind FailureTimeout times it out and any other error fails it.
+func (j *Journal) Finish(phase, target string, err error) error {
+	job, ok := j.Job(phase, target)
+	if !ok {
+		return fmt.Errorf("no %s job was started for %s", phase, target)
+	}
+	job.State, job.Error = JobDone, ""
+	var scanErr *ScanError
+	switch {
+	case errors.As(err, &scanErr) && scanErr.Kind == FailureTimeout:
+		job.State, job.Error = JobTimedOut, err.Error()
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		job.State, job.Error = JobPending, err.Error()
+	case err != nil:
+		job.State, job.Error = JobFailed, err.Error()
+	}
+	return j.record(&job)
+}
+
+// record appends the new state of a job to the journal file
+func (j *Journal) record(job *Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.key()] = job
+	if _, err = j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write journal: %w", err)
+	}
+	return nil
+}
+
+// profileName returns the name of profile, empty when there is none
+func profileName(profile *Profile) string {
+	if profile == nil {
+		return ""
+	}
+	return profile.Name
+}
+
+// finishJob records the outcome of a job, a journal that cannot be written does not stop the scan
+func finishJob(journal *Journal, phase, target string, err error) {
+	if err := journal.Finish(phase, target, err); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournalResume(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	ports := []string{"22", "80"}
+	profile := &Profile{Name: DefaultProfile}
+	for _, target := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		if err = journal.Start(&ScanJob{Phase: phaseNmap, Target: target, Ports: ports, Profile: profile}, []string{target + ".xml"}); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+	finishJob(journal, phaseNmap, "10.0.0.1", nil)
+	finishJob(journal, phaseNmap, "10.0.0.2", errors.New("exit status 1"))
+	finishJob(journal, phaseNmap, "10.0.0.3", fmt.Errorf("nmap was interrupted: %w", context.Canceled))
+	finishJob(journal, phaseNmap, "10.0.0.5", nil)
+	if err = journal.Start(&ScanJob{Phase: phaseNmap, Target: "10.0.0.6", Ports: ports, Profile: profile}, nil); err != nil {
+		t.Fatal(err)
+	}
+	finishJob(journal, phaseNmap, "10.0.0.6", &ScanError{Target: "10.0.0.6", Kind: FailureTimeout, Err: context.DeadlineExceeded})
+	// the range skipped 10.0.0.17 when it was scanned
+	rangeJob := &ScanJob{Phase: phaseNmap, Target: "10.0.0.16/30", Ports: ports, Profile: profile, Exclude: []string{"10.0.0.17/32"}}
+	if err = journal.Start(rangeJob, nil); err != nil {
+		t.Fatal(err)
+	}
+	finishJob(journal, phaseNmap, rangeJob.Target, nil)
+	// 10.0.0.4 is still running when goforit dies
+	if err = journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"phase":"nmap","target":"10.0.0.`)
+	_ = f.Close()
+
+	resumed, err := OpenJournal(dir, true)
+	if err != nil {
+		t.Fatalf("OpenJournal() resume error = %v", err)
+	}
+
+	states := map[string]JobState{"10.0.0.1": JobDone, "10.0.0.2": JobFailed, "10.0.0.3": JobPending, "10.0.0.4": JobRunning, "10.0.0.6": JobTimedOut}
+	for target, want := range states {
+		if job, ok := resumed.Job(phaseNmap, target); !ok || job.State != want {
+			t.Errorf("Job(%s) state = %q, want %q", target, job.State, want)
+		}
+	}
+
+	targets := map[string][]string{
+		"10.0.0.1": ports,
+		"10.0.0.2": ports,
+		"10.0.0.3": ports,
+		"10.0.0.4": ports,
+		"10.0.0.5": {"443"},
+		"10.0.0.6": ports,
+	}
+	tests := []struct {
+		name    string
+		profile *Profile
+		exclude []string
+		want    map[string][]string
+	}{
+		{"Same Scan", profile, []string{"10.0.0.17/32"}, map[string][]string{"10.0.0.2": ports, "10.0.0.3": ports, "10.0.0.4": ports, "10.0.0.5": {"443"}, "10.0.0.6": ports}},
+		{"Other Exclusions", profile, []string{"10.0.0.17/32", "10.0.0.18/32"}, map[string][]string{"10.0.0.2": ports, "10.0.0.3": ports, "10.0.0.4": ports, "10.0.0.5": {"443"}, "10.0.0.6": ports, "10.0.0.16/30": ports}},
+		{"Other Profile", &Profile{Name: "quick"}, []string{"10.0.0.17/32"}, map[string][]string{"10.0.0.1": ports, "10.0.0.2": ports, "10.0.0.3": ports, "10.0.0.4": ports, "10.0.0.5": {"443"}, "10.0.0.6": ports, "10.0.0.16/30": ports}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phase := &scanPhase{Name: phaseNmap, Profile: tt.profile, Targets: map[string][]string{"10.0.0.16/30": ports}, Exclude: map[string][]string{"10.0.0.16/30": tt.exclude}}
+			for target, targetPorts := range targets {
+				phase.Targets[target] = targetPorts
+			}
+			if pending := resumed.Pending(phase); !reflect.DeepEqual(pending, tt.want) {
+				t.Errorf("Pending() got = %v, want %v", pending, tt.want)
+			}
+		})
+	}
+
+	if err = resumed.Start(&ScanJob{Phase: phaseNmap, Target: "10.0.0.2", Ports: ports, Profile: profile}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := resumed.Job(phaseNmap, "10.0.0.2"); job.Attempts != 2 {
+		t.Errorf("retried job attempts = %d, want 2", job.Attempts)
+	}
+	if err = resumed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the record written after the cut off line has to survive the next resume
+	again, err := OpenJournal(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if job, _ := again.Job(phaseNmap, "10.0.0.2"); job.State != JobRunning {
+		t.Errorf("Job(10.0.0.2) state after second resume = %q, want %q", job.State, JobRunning)
+	}
+
+	fresh, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	if _, ok := fresh.Job(phaseNmap, "10.0.0.1"); ok {
+		t.Errorf("OpenJournal() without resume kept the jobs of the earlier scan")
+	}
+}
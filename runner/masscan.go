@@ -0,0 +1,311 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	valid "github.com/asaskevich/govalidator"
+	"github.com/mr-pmillz/goforit/ports"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// masscanRecord is a single host line from masscan -oJ output
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port   int    `json:"port"`
+		Proto  string `json:"proto"`
+		Status string `json:"status"`
+	} `json:"ports"`
+}
+
+// engineMasscan discovers open ports of every target at once with masscan
+const engineMasscan = "masscan"
+
+// masscanEngine runs masscan against every target of a phase in a single batch job.
+// masscan only sends raw packets, it needs root or the cap_net_raw and cap_net_admin capabilities.
+type masscanEngine struct {
+	masscanPath string
+	// rate is the number of packets per second masscan sends
+	rate int
+	// udp also discovers open UDP ports, on the same ports as TCP unless UDP ports were given
+	udp bool
+}
+
+func newMasscanEngine(opts *Options) (ScanEngine, error) {
+	masscanPath, err := exec.LookPath("masscan")
+	if err != nil {
+		return nil, fmt.Errorf("could not get masscan path: %w", err)
+	}
+	if !DetectPrivilege(masscanPath).Raw() {
+		return nil, fmt.Errorf("masscan needs root or the cap_net_raw and cap_net_admin capabilities, e.g. sudo setcap cap_net_raw,cap_net_admin+eip %s", masscanPath)
+	}
+	engine := &masscanEngine{masscanPath: masscanPath, rate: opts.MasscanRate, udp: opts.MasscanUDP}
+	if engine.rate <= 0 {
+		engine.rate = 1000
+	}
+	return engine, nil
+}
+
+// Capabilities ...
+func (e *masscanEngine) Capabilities() Capabilities {
+	return Capabilities{Name: engineMasscan, Discovery: true, UDP: true, Batch: true}
+}
+
+// OutputFiles returns the list output file of the scan of job
+func (e *masscanEngine) OutputFiles(job *ScanJob) []string {
+	return []string{filepath.Join(job.OutputDir, "masscan", job.OutputName+".txt")}
+}
+
+// Scan runs masscan against every target of the batch job on the ports of all of them
+func (e *masscanEngine) Scan(ctx context.Context, job *ScanJob) (*ScanResult, error) {
+	outputFile := e.OutputFiles(job)[0]
+	masscanDir := filepath.Dir(outputFile)
+	if err := os.MkdirAll(masscanDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	ips, hosts, err := masscanTargets(sortedTargets(job.Targets))
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+	targetsFile := filepath.Join(masscanDir, "targets.txt")
+	if err = os.WriteFile(targetsFile, []byte(strings.Join(ips, "\n")+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	portSpec, err := masscanPorts(job, e.udp)
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+
+	args := []string{"-p", portSpec, "--rate", strconv.Itoa(e.rate), "--wait", "10", "-oL", outputFile, "-iL", targetsFile}
+	fmt.Printf("Running masscan against %d target(s)\n", len(ips))
+	cmd := exec.Command(e.masscanPath, args...) //nolint:gosec
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = runCommand(ctx, cmd); err != nil {
+		return nil, newScanError(ctx, job.Target, fmt.Errorf("error executing masscan: %w", err))
+	}
+	openPorts, err := parseMasscanFile(outputFile)
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: err}
+	}
+	return &ScanResult{Files: []string{outputFile}, Hosts: masscanHosts(openPorts, hosts)}, nil
+}
+
+// masscanPorts returns the masscan -p argument, the ports of every target of job.
+// Targets without ports, neither given as host:port nor with --ports, are discovered on every TCP port.
+// With udp the same ports are discovered over UDP unless UDP ports were given.
+func masscanPorts(job *ScanJob, udp bool) (string, error) {
+	set := ports.New()
+	seen := make(map[string]bool)
+	for _, targetPorts := range job.Targets {
+		key := strings.Join(targetPorts, ",")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if len(targetPorts) == 0 {
+			targetPorts = []string{"1-65535"}
+		}
+		targetSet, err := ports.FromStrings(targetPorts)
+		if err != nil {
+			return "", err
+		}
+		for _, port := range targetSet.TCP() {
+			set.Add(ports.TCP, port)
+		}
+		for _, port := range targetSet.UDP() {
+			set.Add(ports.UDP, port)
+		}
+	}
+	if udp && !set.HasUDP() {
+		for _, port := range set.TCP() {
+			set.Add(ports.UDP, port)
+		}
+	}
+	return strings.Join(set.Strings(), ","), nil
+}
+
+// masscanTargets converts targets into something masscan understands.
+// masscan does not do DNS resolution so DNS names are resolved to their IP addresses, hosts maps every resolved
+// address back to the targets it belongs to.
+func masscanTargets(targets []string) (ips []string, hosts map[string][]string, err error) {
+	hosts = make(map[string][]string)
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		switch {
+		case target == "":
+			continue
+		case valid.IsIP(target), valid.IsCIDR(target), isIPRange(target):
+			ips = append(ips, target)
+		default:
+			addrs, err := net.LookupHost(target)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not resolve %s: %w", target, err)
+			}
+			ips = append(ips, addrs...)
+			for _, addr := range addrs {
+				hosts[addr] = append(hosts[addr], target)
+			}
+		}
+	}
+	return ips, hosts, nil
+}
+
+// masscanHosts returns the open ports of every target, the open ports of a resolved address belong to its hostnames
+func masscanHosts(openPorts map[string][]string, hosts map[string][]string) map[string][]string {
+	targets := make(map[string]map[string]struct{})
+	for addr, addrPorts := range openPorts {
+		names, ok := hosts[addr]
+		if !ok {
+			names = []string{addr}
+		}
+		for _, name := range names {
+			for _, port := range addrPorts {
+				if _, ok := targets[name]; !ok {
+					targets[name] = make(map[string]struct{})
+				}
+				targets[name][port] = struct{}{}
+			}
+		}
+	}
+	return sortOpenPorts(targets)
+}
+
+// isIPRange reports whether target is a masscan style 10.0.0.1-10.0.0.20 range.
+func isIPRange(target string) bool {
+	start, end, found := strings.Cut(target, "-")
+	return found && net.ParseIP(start) != nil && net.ParseIP(end) != nil
+}
+
+// parseMasscanFile parses masscan list (-oL) or JSON (-oJ) output.
+func parseMasscanFile(masscanFile string) (map[string][]string, error) {
+	data, err := os.ReadFile(masscanFile)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseMasscanJSON(bytes.NewReader(data))
+	}
+	return parseMasscanList(bytes.NewReader(data))
+}
+
+// parseMasscanList parses masscan -oL output which looks like
+//
+//	#masscan
+//	open tcp 443 10.0.0.1 1688415732
+//	# end
+func parseMasscanList(r io.Reader) (map[string][]string, error) {
+	openPorts := make(map[string]map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "open" {
+			continue
+		}
+		addOpenPort(openPorts, fields[3], fields[1], fields[2])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sortOpenPorts(openPorts), nil
+}
+
+// parseMasscanJSON parses masscan -oJ output. masscan writes one record per line and its output
+// is frequently not valid JSON as a whole (trailing commas, "{finished: 1}"), so each line is decoded on its own.
+func parseMasscanJSON(r io.Reader) (map[string][]string, error) {
+	openPorts := make(map[string]map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ",")
+		if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"ip"`) {
+			continue
+		}
+		record := masscanRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("could not parse masscan line %q: %w", line, err)
+		}
+		for _, port := range record.Ports {
+			if port.Status != "" && port.Status != "open" {
+				continue
+			}
+			addOpenPort(openPorts, record.IP, port.Proto, strconv.Itoa(port.Port))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sortOpenPorts(openPorts), nil
+}
+
+// addOpenPort records an open port for a host. UDP ports are prefixed with U: so nmap can tell them apart.
+func addOpenPort(openPorts map[string]map[string]struct{}, host, proto, port string) {
+	if _, ok := openPorts[host]; !ok {
+		openPorts[host] = make(map[string]struct{})
+	}
+	if strings.EqualFold(proto, "udp") {
+		port = fmt.Sprintf("U:%s", port)
+	}
+	openPorts[host][port] = struct{}{}
+}
+
+// sortOpenPorts converts the open port sets into sorted slices, TCP ports first.
+func sortOpenPorts(openPorts map[string]map[string]struct{}) map[string][]string {
+	targets := make(map[string][]string, len(openPorts))
+	for host, ports := range openPorts {
+		for port := range ports {
+			targets[host] = append(targets[host], port)
+		}
+		sortPorts(targets[host])
+	}
+	return targets
+}
+
+// sortPorts sorts ports numerically with TCP ports ahead of U: prefixed UDP ports.
+func sortPorts(ports []string) {
+	sort.Slice(ports, func(i, j int) bool {
+		iUDP, jUDP := strings.HasPrefix(ports[i], "U:"), strings.HasPrefix(ports[j], "U:")
+		if iUDP != jUDP {
+			return jUDP
+		}
+		iNum, _ := strconv.Atoi(strings.TrimPrefix(ports[i], "U:"))
+		jNum, _ := strconv.Atoi(strings.TrimPrefix(ports[j], "U:"))
+		return iNum < jNum
+	})
+}
+
+// nmapPortSpec builds an nmap -p argument from a slice of ports.
+// Consecutive ports are collapsed into ranges and when U: prefixed UDP ports are present
+// the TCP ports are qualified with T: so they are not also scanned over UDP.
+func nmapPortSpec(portList []string) string {
+	set, err := ports.FromStrings(portList)
+	if err != nil {
+		return strings.Join(portList, ",")
+	}
+	return set.Spec()
+}
+
+// hasUDPPorts reports whether any of the ports are U: prefixed UDP ports.
+func hasUDPPorts(ports []string) bool {
+	for _, port := range ports {
+		if strings.HasPrefix(port, "U:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMasscanList(t *testing.T) {
+	type args struct {
+		output string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"TCP and UDP", args{output: "#masscan\nopen tcp 8443 10.0.0.1 1688415732\nopen tcp 22 10.0.0.1 1688415732\nopen udp 161 10.0.0.1 1688415733\nopen tcp 22 10.0.0.1 1688415734\nopen tcp 80 10.0.0.2 1688415735\n# end\n"}, map[string][]string{
+			"10.0.0.1": {"22", "8443", "U:161"},
+			"10.0.0.2": {"80"},
+		}, false},
+		{"Empty", args{output: "#masscan\n# end\n"}, map[string][]string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMasscanList(strings.NewReader(tt.args.output))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseMasscanList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMasscanList() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMasscanJSON(t *testing.T) {
+	type args struct {
+		output string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"Trailing Commas", args{output: "[\n{   \"ip\": \"10.0.0.1\",   \"timestamp\": \"1688415732\", \"ports\": [ {\"port\": 443, \"proto\": \"tcp\", \"status\": \"open\", \"reason\": \"syn-ack\", \"ttl\": 64} ] },\n{   \"ip\": \"10.0.0.1\",   \"timestamp\": \"1688415733\", \"ports\": [ {\"port\": 53, \"proto\": \"udp\", \"status\": \"open\", \"reason\": \"none\", \"ttl\": 64} ] },\n{finished: 1}\n]\n"}, map[string][]string{
+			"10.0.0.1": {"443", "U:53"},
+		}, false},
+		{"Malformed", args{output: "[\n{ \"ip\": \"10.0.0.1\", \"ports\": [ \n]\n"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMasscanJSON(strings.NewReader(tt.args.output))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseMasscanJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMasscanJSON() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNmapPortSpec(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []string
+		want  string
+	}{
+		{"TCP Only", []string{"22", "80", "443"}, "22,80,443"},
+		{"TCP and UDP", []string{"22", "U:53", "U:161"}, "T:22,U:53,161"},
+		{"UDP Only", []string{"U:161"}, "U:161"},
+		{"Ranges", []string{"20", "21", "22", "80", "8000-8100", "U:161", "U:162"}, "T:20-22,80,8000-8100,U:161-162"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nmapPortSpec(tt.ports); got != tt.want {
+				t.Errorf("nmapPortSpec() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMasscanPorts(t *testing.T) {
+	web, err := LoadProfile("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		targets map[string][]string
+		profile *Profile
+		udp     bool
+		want    string
+	}{
+		{"Target Ports", map[string][]string{"10.0.0.1": {"22", "80"}, "10.0.0.2": {"8000-8100"}}, nil, false, "22,80,8000-8100"},
+		{"Target Ports With UDP", map[string][]string{"10.0.0.1": {"22", "U:53"}}, nil, true, "22,U:53"},
+		{"Masscan UDP", map[string][]string{"10.0.0.1": {"1-1024"}}, nil, true, "1-1024,U:1-1024"},
+		// the ports of a profile do not narrow the discovery
+		{"Every Port", map[string][]string{"10.0.0.1": nil}, web, false, "1-65535"},
+		{"Every Port And Target Ports", map[string][]string{"10.0.0.1": nil, "10.0.0.2": {"U:161"}}, nil, true, "1-65535,U:161"},
+		{"Every Port With UDP", map[string][]string{"10.0.0.1": nil}, nil, true, "1-65535,U:1-65535"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := masscanPorts(&ScanJob{Targets: tt.targets, Profile: tt.profile}, tt.udp)
+			if err != nil {
+				t.Fatalf("masscanPorts() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("masscanPorts() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMasscanHosts(t *testing.T) {
+	openPorts := map[string][]string{"10.0.0.1": {"22"}, "10.0.0.2": {"443"}, "10.0.0.3": {"80", "U:53"}}
+	hosts := map[string][]string{"10.0.0.2": {"example.com"}, "10.0.0.3": {"example.com", "www.example.com"}}
+	want := map[string][]string{
+		"10.0.0.1":        {"22"},
+		"example.com":     {"80", "443", "U:53"},
+		"www.example.com": {"80", "U:53"},
+	}
+	if got := masscanHosts(openPorts, hosts); !reflect.DeepEqual(got, want) {
+		t.Errorf("masscanHosts() got = %v, want %v", got, want)
+	}
+}
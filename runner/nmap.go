@@ -1,21 +1,24 @@
 package runner
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/Ullaakut/nmap/v2"
 	valid "github.com/asaskevich/govalidator"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/nmapxml"
 	"github.com/mr-pmillz/goforit/utils"
-	"io"
 	"log"
 	"os"
 	"os/exec"
-	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
-	"syscall"
-	"time"
 )
 
 // NmapStdoutStreamer is your custom type in code.
@@ -35,451 +38,346 @@ func (c *NmapStdoutStreamer) Write(d []byte) (int, error) {
 	return len(d), nil
 }
 
-// Bytes returns scan result bytes.
+// Bytes satisfies nmap.Streamer, the XML output is streamed from File instead of being read into memory.
 func (c *NmapStdoutStreamer) Bytes() []byte {
-	data, err := os.ReadFile(c.File)
-	if err != nil {
-		data = append(data, "\ncould not read File"...)
-	}
-	return data
+	return nil
 }
 
-// streamNmap ...
-func streamNmap(targets map[string][]string, outputDir string) error {
-	if err := os.MkdirAll(fmt.Sprintf("%s/nmap", outputDir), os.ModePerm); err != nil {
-		return err
-	}
-	tasks := make(chan *nmap.Run, len(targets))
-	var wg sync.WaitGroup
-
-	// Spawn 5 goroutines
-	for i := 0; i < 5; i++ {
-		wg.Add(1)
-		go func(num int, wg *sync.WaitGroup) {
-			printNmapResults(tasks, wg)
-		}(i, &wg)
-	}
-
-	for target, ports := range targets {
-		switch {
-		case len(ports) >= 100:
-			fmt.Printf("Running nmap against %s\n", target)
-		default:
-			fmt.Printf("Running nmap against %s\t%+v", target, ports)
-		}
-		tasks <- runNmap(target, outputDir, ports)
-	}
+// nmapStreamEngine runs nmap through the nmap library and returns the parsed run, so that the results of every target are printed as soon as it finishes
+type nmapStreamEngine struct{}
 
-	close(tasks)
-	wg.Wait()
-	return nil
+func newNmapStreamEngine(*Options) (ScanEngine, error) {
+	return &nmapStreamEngine{}, nil
 }
 
-// printNmapResults ...
-func printNmapResults(ch <-chan *nmap.Run, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for task := range ch {
-		// use result to format custom output
-		for _, host := range task.Hosts {
-			if len(host.Ports) == 0 || len(host.Addresses) == 0 {
-				continue
-			}
+// Capabilities ...
+func (e *nmapStreamEngine) Capabilities() Capabilities {
+	return Capabilities{Name: engineNmapStream, Final: true, Privileged: true, UDP: true, Streams: true, Ranges: true}
+}
 
-			fmt.Printf("Host %q:\n", host.Addresses[0])
-			for _, port := range host.Ports {
-				fmt.Printf("\tPort %d/%s %s %s\n", port.ID, port.Protocol, port.State, port.Service.Name)
-				for _, script := range port.Scripts {
-					fmt.Printf("%s\n", script.Output)
-				}
-			}
-		}
-	}
+// OutputFiles returns the XML and normal output file of the scan of job
+func (e *nmapStreamEngine) OutputFiles(job *ScanJob) []string {
+	base := fmt.Sprintf("%s/nmap/%s_%s_ports", job.OutputDir, sanitizeFileName(job.Target), job.OutputName)
+	return []string{base + ".xml", base + ".nmap"}
 }
 
-// runNmap runs StreamNmap against a target and slice of ports
-func runNmap(target, outputDir string, ports []string) *nmap.Run {
-	// limit each scan to maximum of 10 minutes in case something gets stuck..
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	xmlOutput := fmt.Sprintf("%s/nmap/%s_top_ports.xml", outputDir, target)
-	nmapOutput := fmt.Sprintf("%s/nmap/%s_top_ports.nmap", outputDir, target)
+// Scan runs nmap against the target and ports of job with the arguments of the job profile, ctx limits the duration of the scan
+func (e *nmapStreamEngine) Scan(ctx context.Context, job *ScanJob) (*ScanResult, error) {
+	files := e.OutputFiles(job)
+	xmlOutput, nmapOutput := files[0], files[1]
+	if err := os.MkdirAll(filepath.Dir(xmlOutput), os.ModePerm); err != nil {
+		return nil, err
+	}
 	cType := &NmapStdoutStreamer{
 		File: xmlOutput,
 	}
 
 	s, err := nmap.NewScanner(
-		nmap.WithTargets(target),
-		nmap.WithPorts(strings.Join(ports, ",")),
+		nmap.WithTargets(job.Target),
+		nmap.WithCustomArguments(job.nmapArgs()...),
 		nmap.WithNmapOutput(nmapOutput),
-		nmap.WithAggressiveScan(),
-		nmap.WithVerbosity(3),
-		nmap.WithTimingTemplate(nmap.TimingAggressive),
-		// Filter out hosts that don't have any open ports
-		nmap.WithFilterHost(func(h nmap.Host) bool {
-			// Filter out hosts with no open ports.
-			for i := range h.Ports {
-				if h.Ports[i].Status() == "open" {
-					return true
-				}
-			}
-
-			return false
-		}),
 		nmap.WithContext(ctx),
 	)
-	if valid.IsDNSName(target) {
+	if err != nil {
+		return nil, &ScanError{Target: job.Target, Kind: FailureError, Err: fmt.Errorf("unable to create nmap scanner: %w", err)}
+	}
+	if valid.IsDNSName(job.Target) {
 		s.AddOptions(nmap.WithCustomArguments("--resolve-all"))
 	}
 
+	fmt.Printf("Running nmap against %s\n", job.Target)
+	warnings, err := s.RunWithStreamer(cType, cType.File)
+	fmt.Printf("StreamNmap warnings: %v\n", warnings)
+	// RunWithStreamer does not report every failure, a killed scan is only visible through ctx
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
-		log.Printf("unable to create nmap scanner: %v", err)
+		return nil, newScanError(ctx, job.Target, err)
 	}
-
-	warnings, err := s.RunWithStreamer(cType, cType.File)
+	result, err := readXMLOutput(job.Target, xmlOutput)
 	if err != nil {
-		log.Printf("unable to run nmap scan: %v", err)
+		return nil, err
 	}
+	result.Files = files
+	return result, nil
+}
 
-	fmt.Printf("StreamNmap warnings: %v\n", warnings)
+// printNmapResults prints the open services and their script output in a single write,
+// so that the results of scans that finish at the same time do not interleave
+func printNmapResults(services []export.Service) {
+	var b strings.Builder
+	host := ""
+	for _, service := range services {
+		if service.Host != host {
+			host = service.Host
+			fmt.Fprintf(&b, "Host %q:\n", host)
+		}
+		fmt.Fprintf(&b, "\tPort %d/%s %s %s\n", service.Port, service.Protocol, service.State, service.Service)
+		for _, script := range service.Scripts {
+			fmt.Fprintf(&b, "%s\n", script.Output)
+		}
+	}
+	fmt.Print(b.String())
+}
+
+// nmapExecEngine runs the nmap binary for every target and parses its XML output
+type nmapExecEngine struct {
+	nmapPath string
+}
 
-	result, err := nmap.Parse(cType.Bytes())
+func newNmapExecEngine(*Options) (ScanEngine, error) {
+	nmapPath, err := exec.LookPath("nmap")
 	if err != nil {
-		log.Printf("unable to parse nmap output: %v", err)
+		return nil, fmt.Errorf("could not get nmap path: %w", err)
 	}
-	return result
+	return &nmapExecEngine{nmapPath: nmapPath}, nil
 }
 
-// runNmapAsync runs nmap concurrently with 10 goroutines in parallel.
-func runNmapAsync(outputDir string, targets map[string][]string) error {
-	if err := os.MkdirAll(fmt.Sprintf("%s/nmap", outputDir), os.ModePerm); err != nil {
-		return err
-	}
-	fmt.Printf("Running nmap against %d hosts\n", len(targets))
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var errors []error
-	// Common channel for the goroutines
-	tasks := make(chan *exec.Cmd, len(targets))
-	var workers int
-	if len(targets) < 10 {
-		workers = len(targets)
-	} else {
-		workers = 10
-	}
+// Capabilities ...
+func (e *nmapExecEngine) Capabilities() Capabilities {
+	return Capabilities{Name: engineNmap, Final: true, Privileged: true, UDP: true, Ranges: true}
+}
 
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func(num int, w *sync.WaitGroup) {
-			defer w.Done()
-			var (
-				out []byte
-				err error
-			)
-			for cmd := range tasks {
-				fmt.Printf("%s\n", strings.ReplaceAll(cmd.String(), "/usr/bin/bash -c ", ""))
-				out, err = cmd.CombinedOutput()
-				if err != nil {
-					log.Printf("Error executing command: %v", err)
-					mu.Lock()
-					errors = append(errors, fmt.Errorf("error executing command: %w", err))
-					mu.Unlock()
-					continue
-				}
-				fmt.Println(string(out))
-			}
-		}(i, &wg)
+// OutputFiles returns the -oA output files of the scan of job
+func (e *nmapExecEngine) OutputFiles(job *ScanJob) []string {
+	base := e.outputBase(job)
+	return []string{base + ".xml", base + ".nmap", base + ".gnmap"}
+}
+
+func (e *nmapExecEngine) outputBase(job *ScanJob) string {
+	return filepath.Join(job.OutputDir, "nmap", fmt.Sprintf("%s-%s-ports", sanitizeFileName(job.Target), job.OutputName))
+}
+
+// Scan runs nmap against the target and ports of job with the arguments of the job profile, ctx limits the duration of the scan
+func (e *nmapExecEngine) Scan(ctx context.Context, job *ScanJob) (*ScanResult, error) {
+	outputBase := e.outputBase(job)
+	if err := os.MkdirAll(filepath.Dir(outputBase), os.ModePerm); err != nil {
+		return nil, err
 	}
-	bashPath, err := exec.LookPath("bash")
-	if err != nil {
-		log.Fatalf("could not get bash path: %v", err)
+	args := append(job.nmapArgs(), "-oA", outputBase, job.Target)
+	// nmap is executed directly with an argv slice, targets never pass through a shell
+	cmd := exec.Command(e.nmapPath, args...) //nolint:gosec
+	fmt.Printf("%s\n", cmd.String())
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := runCommand(ctx, cmd); err != nil {
+		return nil, newScanError(ctx, job.Target, err)
 	}
-	nmapPath, err := exec.LookPath("nmap")
+	fmt.Println(out.String())
+	result, err := readXMLOutput(job.Target, outputBase+".xml")
 	if err != nil {
-		log.Fatalf("could not get nmap path: %v", err)
-	}
-	for target, ports := range targets {
-		command := fmt.Sprintf("sudo %s -vvv -Pn --top-ports %d -T4 -sCV -oA %s/nmap/%s-top-ports %s", nmapPath, len(ports), outputDir, target, target)
-		tasks <- exec.Command(bashPath, "-c", command)
+		return nil, err
 	}
-	close(tasks)
-	// wait for the workers to finish
-	wg.Wait()
+	result.Files = e.OutputFiles(job)
+	return result, nil
+}
 
-	// Check for errors
-	if len(errors) > 0 {
-		return fmt.Errorf("encountered %d errors during execution", len(errors))
+// portString formats a port the way the ports of targets are kept, UDP ports are prefixed with U:
+func portString(protocol string, port int) string {
+	if protocol == "udp" {
+		return fmt.Sprintf("U:%d", port)
 	}
-	return nil
+	return strconv.Itoa(port)
 }
 
-type NmapResults struct {
-	Results []NmapRun
+// sortedTargets returns the targets in a stable order so that scans are scheduled deterministically
+func sortedTargets(targets map[string][]string) []string {
+	hosts := make([]string, 0, len(targets))
+	for host := range targets {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
 }
 
-type NmapRun struct {
-	XMLName          xml.Name `xml:"nmaprun"`
-	Text             string   `xml:",chardata"`
-	Scanner          string   `xml:"scanner,attr"`
-	Args             string   `xml:"args,attr"`
-	Start            string   `xml:"start,attr"`
-	Startstr         string   `xml:"startstr,attr"`
-	Version          string   `xml:"version,attr"`
-	Xmloutputversion string   `xml:"xmloutputversion,attr"`
-	Scaninfo         struct {
-		Text        string `xml:",chardata"`
-		Type        string `xml:"type,attr"`
-		Protocol    string `xml:"protocol,attr"`
-		Numservices string `xml:"numservices,attr"`
-		Services    string `xml:"services,attr"`
-	} `xml:"scaninfo"`
-	Verbose struct {
-		Text  string `xml:",chardata"`
-		Level string `xml:"level,attr"`
-	} `xml:"verbose"`
-	Debugging struct {
-		Text  string `xml:",chardata"`
-		Level string `xml:"level,attr"`
-	} `xml:"debugging"`
-	Host struct {
-		Text      string `xml:",chardata"`
-		Starttime string `xml:"starttime,attr"`
-		Endtime   string `xml:"endtime,attr"`
-		Status    struct {
-			Text   string `xml:",chardata"`
-			State  string `xml:"state,attr"`
-			Reason string `xml:"reason,attr"`
-		} `xml:"status"`
-		Address struct {
-			Text     string `xml:",chardata"`
-			Addr     string `xml:"addr,attr"`
-			Addrtype string `xml:"addrtype,attr"`
-		} `xml:"address"`
-		Hostnames struct {
-			Text     string `xml:",chardata"`
-			Hostname []struct {
-				Text string `xml:",chardata"`
-				Name string `xml:"name,attr"`
-				Type string `xml:"type,attr"`
-			} `xml:"hostname"`
-		} `xml:"hostnames"`
-		Ports struct {
-			Text       string `xml:",chardata"`
-			Extraports struct {
-				Text         string `xml:",chardata"`
-				State        string `xml:"state,attr"`
-				Count        string `xml:"count,attr"`
-				Extrareasons struct {
-					Text   string `xml:",chardata"`
-					Reason string `xml:"reason,attr"`
-					Count  string `xml:"count,attr"`
-				} `xml:"extrareasons"`
-			} `xml:"extraports"`
-			Port []struct {
-				Text     string `xml:",chardata"`
-				Protocol string `xml:"protocol,attr"`
-				Portid   string `xml:"portid,attr"`
-				State    struct {
-					Text      string `xml:",chardata"`
-					State     string `xml:"state,attr"`
-					Reason    string `xml:"reason,attr"`
-					ReasonTTL string `xml:"reason_ttl,attr"`
-				} `xml:"state"`
-				Service struct {
-					Text      string   `xml:",chardata"`
-					Name      string   `xml:"name,attr"`
-					Product   string   `xml:"product,attr"`
-					Version   string   `xml:"version,attr"`
-					Extrainfo string   `xml:"extrainfo,attr"`
-					Ostype    string   `xml:"ostype,attr"`
-					Method    string   `xml:"method,attr"`
-					Conf      string   `xml:"conf,attr"`
-					Cpe       []string `xml:"cpe"`
-				} `xml:"service"`
-				Script struct {
-					Text   string `xml:",chardata"`
-					ID     string `xml:"id,attr"`
-					Output string `xml:"output,attr"`
-				} `xml:"script"`
-			} `xml:"port"`
-		} `xml:"ports"`
-		Os struct {
-			Text     string `xml:",chardata"`
-			Portused []struct {
-				Text   string `xml:",chardata"`
-				State  string `xml:"state,attr"`
-				Proto  string `xml:"proto,attr"`
-				Portid string `xml:"portid,attr"`
-			} `xml:"portused"`
-			Osclass struct {
-				Text     string `xml:",chardata"`
-				Type     string `xml:"type,attr"`
-				Vendor   string `xml:"vendor,attr"`
-				Osfamily string `xml:"osfamily,attr"`
-				Osgen    string `xml:"osgen,attr"`
-				Accuracy string `xml:"accuracy,attr"`
-				Cpe      string `xml:"cpe"`
-			} `xml:"osclass"`
-			Osmatch struct {
-				Text     string `xml:",chardata"`
-				Name     string `xml:"name,attr"`
-				Accuracy string `xml:"accuracy,attr"`
-				Line     string `xml:"line,attr"`
-			} `xml:"osmatch"`
-		} `xml:"os"`
-		Uptime struct {
-			Text     string `xml:",chardata"`
-			Seconds  string `xml:"seconds,attr"`
-			Lastboot string `xml:"lastboot,attr"`
-		} `xml:"uptime"`
-		Distance struct {
-			Text  string `xml:",chardata"`
-			Value string `xml:"value,attr"`
-		} `xml:"distance"`
-		Tcpsequence struct {
-			Text       string `xml:",chardata"`
-			Index      string `xml:"index,attr"`
-			Difficulty string `xml:"difficulty,attr"`
-			Values     string `xml:"values,attr"`
-		} `xml:"tcpsequence"`
-		Ipidsequence struct {
-			Text   string `xml:",chardata"`
-			Class  string `xml:"class,attr"`
-			Values string `xml:"values,attr"`
-		} `xml:"ipidsequence"`
-		Tcptssequence struct {
-			Text   string `xml:",chardata"`
-			Class  string `xml:"class,attr"`
-			Values string `xml:"values,attr"`
-		} `xml:"tcptssequence"`
-		Trace struct {
-			Text  string `xml:",chardata"`
-			Port  string `xml:"port,attr"`
-			Proto string `xml:"proto,attr"`
-			Hop   []struct {
-				Text   string `xml:",chardata"`
-				TTL    string `xml:"ttl,attr"`
-				Ipaddr string `xml:"ipaddr,attr"`
-				Rtt    string `xml:"rtt,attr"`
-				Host   string `xml:"host,attr"`
-			} `xml:"hop"`
-		} `xml:"trace"`
-		Times struct {
-			Text   string `xml:",chardata"`
-			Srtt   string `xml:"srtt,attr"`
-			Rttvar string `xml:"rttvar,attr"`
-			To     string `xml:"to,attr"`
-		} `xml:"times"`
-	} `xml:"host"`
-	Runstats struct {
-		Text     string `xml:",chardata"`
-		Finished struct {
-			Text    string `xml:",chardata"`
-			Time    string `xml:"time,attr"`
-			Timestr string `xml:"timestr,attr"`
-			Elapsed string `xml:"elapsed,attr"`
-			Summary string `xml:"summary,attr"`
-			Exit    string `xml:"exit,attr"`
-		} `xml:"finished"`
-		Hosts struct {
-			Text  string `xml:",chardata"`
-			Up    string `xml:"up,attr"`
-			Down  string `xml:"down,attr"`
-			Total string `xml:"total,attr"`
-		} `xml:"hosts"`
-	} `xml:"runstats"`
+// NmapResults holds the hosts of every nmap XML file parsed from an output directory, merged by address
+type NmapResults struct {
+	// Document holds the merged hosts of every parsed run
+	Document *export.Document
+	// Runs is the number of nmap runs parsed
+	Runs int
+	// Partial are files that end early, e.g. the output of a killed scan. Their hosts up to the cut are kept.
+	Partial []string
+	// Corrupt are files that could not be parsed at all, they were skipped
+	Corrupt []string
 }
 
-// parseNmapResults ...
-func parseNmapResults(outputDir string) (*NmapResults, error) {
-	files, err := utils.FilePathWalkDir(outputDir)
-	if err != nil {
-		return nil, err
+// LoadResults parses every nmap XML file of a goforit output directory.
+// The nmap sub directory of a scan output directory is used when it exists, otherwise dir itself is parsed.
+// A directory without nmap XML files, such as the inventory written by goforit import, is loaded from its results.json.
+func LoadResults(dir string) (*NmapResults, error) {
+	nmapDir := filepath.Join(dir, "nmap")
+	if info, err := os.Stat(nmapDir); err == nil && info.IsDir() {
+		return parseNmapResults(nmapDir)
 	}
-	if err = modifyFilePermissions(files); err != nil {
-		return nil, err
+	results, err := parseNmapResults(dir)
+	if err != nil || results.Runs > 0 {
+		return results, err
 	}
-
-	var nmapXMLFiles []string
-	for _, f := range files {
-		if strings.HasSuffix(f, ".xml") {
-			nmapXMLFiles = append(nmapXMLFiles, f)
-		}
+	doc, err := export.ReadResults(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
 	}
-	nmapResults, err := getNmapData(nmapXMLFiles)
 	if err != nil {
 		return nil, err
 	}
-
-	return nmapResults, nil
+	return &NmapResults{Document: doc, Runs: len(doc.Scans)}, nil
 }
 
-// getNmapData ...
-func getNmapData(nmapFiles []string) (*NmapResults, error) {
-	nmapResults := &NmapResults{}
-	for _, nmapFile := range nmapFiles {
-		results, err := parseNmapFile(nmapFile)
+// ImportResults parses nmap XML files and directories that were not necessarily written by goforit.
+// Directories are walked recursively and XML files whose root element is not nmaprun are skipped,
+// every path is only parsed once and the imported files are left untouched.
+func ImportResults(paths []string) (*NmapResults, error) {
+	var nmapXMLFiles []string
+	seen := make(map[string]struct{})
+	addFile := func(path string) {
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			nmapXMLFiles = append(nmapXMLFiles, path)
+		}
+	}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			addFile(path)
+			continue
+		}
+		files, err := utils.FilePathWalkDir(path)
 		if err != nil {
 			return nil, err
 		}
-		nmapResults.Results = append(nmapResults.Results, *results)
+		for _, f := range files {
+			if !strings.EqualFold(filepath.Ext(f), ".xml") {
+				continue
+			}
+			if !isNmapXMLFile(f) {
+				log.Printf("Skipping %s, it is not an nmap XML file\n", f)
+				continue
+			}
+			addFile(f)
+		}
 	}
-
-	return nmapResults, nil
+	if len(nmapXMLFiles) == 0 {
+		return nil, fmt.Errorf("no nmap XML files found in %s", strings.Join(paths, ", "))
+	}
+	return getNmapData(nmapXMLFiles)
 }
 
-// parseNmapFile ...
-func parseNmapFile(nmapFile string) (*NmapRun, error) {
-	results := &NmapRun{}
-	f, err := os.OpenFile(nmapFile, os.O_RDWR, os.ModePerm)
+// isNmapXMLFile reports whether the root element of an XML file is nmaprun
+func isNmapXMLFile(path string) bool {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return false
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "nmaprun"
+		}
+	}
+}
+
+// parseNmapResults ...
+func parseNmapResults(outputDir string) (*NmapResults, error) {
+	files, err := utils.FilePathWalkDir(outputDir)
 	if err != nil {
 		return nil, err
 	}
-	if err = xml.Unmarshal(data, results); err != nil {
+
+	var nmapXMLFiles []string
+	for _, f := range files {
+		if strings.HasSuffix(f, ".xml") {
+			nmapXMLFiles = append(nmapXMLFiles, f)
+		}
+	}
+	nmapResults, err := getNmapData(nmapXMLFiles)
+	if err != nil {
 		return nil, err
 	}
-	return results, nil
+
+	return nmapResults, nil
 }
 
-// modifyFilePermissions ...
-func modifyFilePermissions(filePaths []string) error {
-	// Get the current user
-	currentUser, err := user.Current()
-	if err != nil {
-		return err
-	}
+// parseWorkers is the number of nmap XML files parsed at the same time
+var parseWorkers = runtime.NumCPU()
 
-	// Check if the current user is root
-	if currentUser.Username == "root" {
-		return nil
-	}
+// hostBuffer is the number of parsed hosts a file parsed ahead of the file being merged may hold back
+const hostBuffer = 64
 
-	// Get the user ID and group ID of the current user
-	uid := currentUser.Uid
-	gid := currentUser.Gid
+// parsedFile streams the hosts of a single nmap XML file, run and err are set before hosts is closed
+type parsedFile struct {
+	path  string
+	hosts chan *nmapxml.Host
+	run   *nmapxml.Run
+	err   error
+}
 
-	// Iterate over the file paths
-	for _, path := range filePaths {
-		// Get the file info
-		fileInfo, err := os.Stat(path)
-		if err != nil {
-			return err
+// getNmapData parses nmapFiles in parallel and merges their hosts in the order of nmapFiles, so that later files
+// win for ports found in more than one. Hosts are streamed into the results one at a time, only a few hosts of every
+// file being parsed are held in memory at once. Truncated files are kept up to the cut and corrupt files are skipped,
+// an error is only returned when none of nmapFiles could be parsed.
+func getNmapData(nmapFiles []string) (*NmapResults, error) {
+	files := make([]*parsedFile, len(nmapFiles))
+	for i, path := range nmapFiles {
+		files[i] = &parsedFile{path: path, hosts: make(chan *nmapxml.Host, hostBuffer)}
+	}
+	// files are started in order, so the file being merged always runs while files parsed ahead wait for it
+	workers := make(chan struct{}, parseWorkers)
+	go func() {
+		for _, f := range files {
+			workers <- struct{}{}
+			go func(f *parsedFile) {
+				defer func() { <-workers }()
+				f.run, f.err = nmapxml.StreamFile(f.path, func(host *nmapxml.Host) error {
+					f.hosts <- host
+					return nil
+				})
+				close(f.hosts)
+			}(f)
 		}
+	}()
 
-		// Change the file owner if necessary
-		fileOwner := fileInfo.Sys().(*syscall.Stat_t)
-		if fileOwner.Uid == 0 {
-			cmd := exec.Command("sudo", "chown", fmt.Sprintf("%s:%s", uid, gid), path) //nolint:gosec
-			if err = cmd.Run(); err != nil {
-				return err
-			}
+	results := &NmapResults{}
+	builder := export.NewBuilder()
+	var lastErr error
+	for _, f := range files {
+		hosts := 0
+		for host := range f.hosts {
+			builder.AddHost(host)
+			hosts++
 		}
+		switch {
+		case f.run == nil:
+			log.Printf("Skipping %s, it could not be parsed: %v\n", f.path, f.err)
+			results.Corrupt = append(results.Corrupt, f.path)
+			lastErr = fmt.Errorf("could not parse %s: %w", f.path, f.err)
+			continue
+		case f.err != nil:
+			log.Printf("%s is incomplete, keeping the %d host(s) parsed before: %v\n", f.path, hosts, f.err)
+			results.Partial = append(results.Partial, f.path)
+		}
+		builder.AddScan(f.run, hosts)
+		results.Runs++
 	}
+	if results.Runs == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	results.Document = builder.Document()
+	return results, nil
+}
 
-	return nil
+// parseNmapFile ...
+func parseNmapFile(nmapFile string) (*nmapxml.Run, error) {
+	return nmapxml.ParseFile(nmapFile)
 }
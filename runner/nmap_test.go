@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportResults(t *testing.T) {
+	data, err := os.ReadFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not read test data: %v", err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"bob/nmap/multihost.xml":  data,
+		"bob/nmap/multihost.nmap": []byte("# Nmap 7.94 scan initiated"),
+		"bob/burp-issues.xml":     []byte(`<?xml version="1.0"?><issues></issues>`),
+		"alice.xml":               data,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, content, 0400); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    int
+		wantErr bool
+	}{
+		{"Directory", []string{filepath.Join(dir, "bob")}, 1, false},
+		{"Directory And File", []string{filepath.Join(dir, "bob"), filepath.Join(dir, "alice.xml")}, 2, false},
+		{"Duplicate Paths", []string{filepath.Join(dir, "alice.xml"), dir + "/./alice.xml"}, 1, false},
+		{"Nested Directories", []string{dir}, 2, false},
+		{"Explicit Non Nmap File", []string{filepath.Join(dir, "bob", "burp-issues.xml")}, 0, true},
+		{"Missing Path", []string{filepath.Join(dir, "missing")}, 0, true},
+		{"No Nmap Files", []string{filepath.Join(dir, "empty")}, 0, true},
+	}
+	if err = os.Mkdir(filepath.Join(dir, "empty"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ImportResults(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportResults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Runs != tt.want {
+				t.Errorf("ImportResults() got %d runs, want %d", got.Runs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNmapData(t *testing.T) {
+	data, err := os.ReadFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatalf("could not read test data: %v", err)
+	}
+	firstHost := bytes.Index(data, []byte("</host>")) + len("</host>")
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"complete.xml":  data,
+		"truncated.xml": data[:firstHost],
+		"corrupt.xml":   []byte("Starting Nmap 7.94"),
+	}
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), content, 0400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name        string
+		files       []string
+		wantRuns    int
+		wantHosts   int
+		wantPartial []string
+		wantCorrupt []string
+		wantErr     bool
+	}{
+		{"Complete", []string{path("complete.xml")}, 1, 2, nil, nil, false},
+		{"Truncated", []string{path("truncated.xml")}, 1, 1, []string{path("truncated.xml")}, nil, false},
+		{"Corrupt Skipped", []string{path("corrupt.xml"), path("complete.xml"), path("truncated.xml")}, 2, 2, []string{path("truncated.xml")}, []string{path("corrupt.xml")}, false},
+		{"Only Corrupt", []string{path("corrupt.xml")}, 0, 0, nil, nil, true},
+		{"No Files", nil, 0, 0, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getNmapData(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getNmapData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Runs != tt.wantRuns || len(got.Document.Hosts) != tt.wantHosts {
+				t.Errorf("getNmapData() got %d runs and %d hosts, want %d and %d", got.Runs, len(got.Document.Hosts), tt.wantRuns, tt.wantHosts)
+			}
+			if !reflect.DeepEqual(got.Partial, tt.wantPartial) || !reflect.DeepEqual(got.Corrupt, tt.wantCorrupt) {
+				t.Errorf("getNmapData() got partial %v and corrupt %v, want %v and %v", got.Partial, got.Corrupt, tt.wantPartial, tt.wantCorrupt)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/notify"
+	"github.com/mr-pmillz/goforit/store"
+	"log"
+	"os"
+	"time"
+)
+
+// notifyCloseTimeout is how long a finished scan waits for its last notifications to be delivered
+const notifyCloseTimeout = time.Minute
+
+// scanNotifier sends the notifications of a single scan
+type scanNotifier struct {
+	*notify.Notifier
+	output  string
+	onEvent func(msg *notify.Message)
+	// previous are the open services of the last run of the results database, interesting services not in it are new
+	previous map[string]bool
+}
+
+// newScanNotifier starts the notifier of opts, the last run in the results database is the run new services are compared to
+func newScanNotifier(opts *Options) *scanNotifier {
+	n := &scanNotifier{Notifier: notify.New(opts.Notify), output: opts.Output, onEvent: opts.OnEvent}
+	if opts.OnEvent == nil && (opts.Notify == nil || len(opts.Notify.Webhooks) == 0) {
+		return n
+	}
+	previous, err := previousOpenServices(opts.database())
+	if err != nil {
+		log.Printf("could not read the previous run from %s, every interesting service is reported as new: %v\n", opts.database(), err)
+	}
+	n.previous = previous
+	return n
+}
+
+// previousOpenServices returns the open services of the latest run saved at path, nil when nothing was saved yet
+func previousOpenServices(path string) (map[string]bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil
+	}
+	db, err := store.OpenReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	ctx := context.Background()
+	run, err := db.LatestRun(ctx)
+	if err != nil {
+		// an empty database has no previous run
+		return nil, nil
+	}
+	return db.OpenServices(ctx, run)
+}
+
+// started sends the scan_start notification
+func (n *scanNotifier) started(h *Hosts, opts *Options) {
+	n.send(&notify.Message{Event: notify.EventScanStart, Output: n.output, Targets: len(h.Targets), Profile: opts.scanProfile().Name, Engines: opts.pipeline()})
+}
+
+// hostFinished sends the host_done notification of a finished scan and a service notification for every new
+// interesting service in its XML output
+func (n *scanNotifier) hostFinished(job *ScanJob, result *ScanResult, err error, done, total int) {
+	msg := &notify.Message{Event: notify.EventHostDone, Output: n.output, Host: job.Target, Phase: job.Phase, Done: done, Total: total}
+	if err != nil {
+		msg.Error = err.Error()
+		n.send(msg)
+		return
+	}
+	msg.OpenPorts = result.OpenPorts
+	n.send(msg)
+
+	for _, s := range result.Services {
+		s := s
+		if n.Config().Interesting(&s) && n.isNew(&s) {
+			n.send(&notify.Message{Event: notify.EventService, Output: n.output, Host: job.Target, Phase: job.Phase, Service: &s})
+		}
+	}
+}
+
+// finished sends the summary notification of a scan whose exported results are doc, scanErr is why the scan did not finish
+func (n *scanNotifier) finished(doc *export.Document, started time.Time, run *store.Run, failed []string, scanErr error) {
+	summary := notify.NewSummary(doc, started, n.Config(), n.isNew)
+	summary.RunID = run.ID
+	if failed != nil {
+		summary.Failed = failed
+	}
+	msg := &notify.Message{Event: notify.EventSummary, Output: n.output, Targets: run.Targets, Profile: run.Profile, Engines: run.Engines, Summary: summary}
+	if scanErr != nil {
+		msg.Error = scanErr.Error()
+	}
+	n.send(msg)
+}
+
+// send passes msg to OnEvent and queues it for the webhooks
+func (n *scanNotifier) send(msg *notify.Message) {
+	msg.Time = time.Now().UTC()
+	if n.onEvent != nil {
+		n.onEvent(msg)
+	}
+	n.Send(msg)
+}
+
+// isNew reports whether s was not open in the previous run
+func (n *scanNotifier) isNew(s *export.Service) bool {
+	return !n.previous[s.Key()]
+}
@@ -1,24 +1,117 @@
 package runner
 
 import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/notify"
+	"github.com/mr-pmillz/goforit/ports"
+	"github.com/mr-pmillz/goforit/store"
 	"github.com/mr-pmillz/goforit/utils"
 	"github.com/spf13/cobra"
+	"os"
 	"reflect"
+	"strings"
+	"time"
 )
 
 type Options struct {
-	Target     interface{}
-	Verbose    bool
-	Output     string
-	StreamNmap bool
+	Target      interface{}
+	Exclude     interface{}
+	ExcludeFile string
+	// ExpandTargets scans every address of a CIDR or range on its own instead of the whole range in a single nmap run
+	ExpandTargets bool
+	Verbose       bool
+	Output        string
+	OutputFormat  []string
+	StreamNmap    bool
+	Masscan       bool
+	MasscanRate   int
+	MasscanUDP    bool
+	// Threads is the maximum number of scans running at the same time across every scan phase
+	Threads int
+	// MaxParallelHosts is the number of hosts scanned at the same time by a scan phase without its own limit
+	MaxParallelHosts int
+	// NmapThreads is the number of hosts scanned at the same time by the nmap phase, 0 uses MaxParallelHosts
+	NmapThreads int
+	// UDPThreads is the number of hosts scanned at the same time by the UDP phase, 0 uses MaxParallelHosts
+	UDPThreads int
+	// DiscoveryThreads is the number of hosts scanned at the same time by every discovery phase, 0 uses MaxParallelHosts
+	DiscoveryThreads int
+	// Resume skips the jobs that an earlier scan into the same output directory finished
+	Resume bool
+	// HostTimeout limits every single scan of a target, 0 does not limit it
+	HostTimeout time.Duration
+	// ScanTimeout is the deadline of the whole run, 0 does not limit it
+	ScanTimeout time.Duration
+	// MaxAttempts is how often a failed scan of a target is attempted at most
+	MaxAttempts int
+	// RetryBackoff is the wait before the second attempt, it doubles with every further attempt
+	RetryBackoff time.Duration
+	// RetryOn are the failures that are retried, see RetryPolicy
+	RetryOn []string
+	// Profile is the scan profile selected with --profile
+	Profile *Profile
+	// Ports are the ports given with --ports, nil scans the ports of the profile
+	Ports *ports.Set
+	// UDP runs the UDP phase next to the TCP scan
+	UDP bool
+	// UDPProfile is the scan profile of the UDP phase selected with --udp-profile
+	UDPProfile *Profile
+	// Engines is the pipeline of scan engines selected with --engines, see ScanEngine
+	Engines []string
+	// ConnectConcurrency is the number of ports of a target the connect engine connects to at the same time
+	ConnectConcurrency int
+	// ConnectRate limits the connection attempts per second of the connect engine, 0 does not limit them
+	ConnectRate int
+	// ConnectTimeout is how long the connect engine waits for a connection before the port counts as filtered
+	ConnectTimeout time.Duration
+	// BannerTimeout is how long the connect engine waits for the banner of an open port, 0 disables banner grabbing
+	BannerTimeout time.Duration
+	// Database is the results database the run is saved to, empty saves it to results.db in Output
+	Database string
+	// Notify configures the webhooks notified about the scan, see notify.LoadConfig
+	Notify *notify.Config
+	// OnEvent receives every notification of the scan in process whether or not webhooks are configured, nil ignores them
+	OnEvent func(msg *notify.Message)
+	// MaxTargets is the maximum number of unique targets NewTargets accepts, 0 does not limit them
+	MaxTargets int
 }
 
 // ConfigureCommand ...
 func ConfigureCommand(cmd *cobra.Command) error {
 	cmd.PersistentFlags().StringP("target", "t", "", "target to scan")
+	cmd.PersistentFlags().StringP("exclude", "", "", "comma separated list of out of scope IPs, CIDRs, ranges or hostnames that will never be scanned")
+	cmd.PersistentFlags().StringP("exclude-file", "", "", "file of out of scope IPs, CIDRs, ranges or hostnames, one per line")
+	cmd.PersistentFlags().BoolP("expand-targets", "", false, "scan every address of a CIDR or range with its own nmap run instead of the whole range in a single run")
 	cmd.PersistentFlags().BoolP("verbose", "v", false, "toggle verbosity")
-	cmd.PersistentFlags().BoolP("stream-nmap", "", false, "run nmap and stream results in real time")
+	cmd.PersistentFlags().BoolP("stream-nmap", "", false, "run nmap and stream results in real time, the same as --engines nmap-stream")
+	cmd.PersistentFlags().StringP("engines", "", "", fmt.Sprintf("comma separated pipeline of scan engines, discovery engines first, defaults to nmap. Supported engines: %s", strings.Join(EngineNames(), ", ")))
+	cmd.PersistentFlags().IntP("connect-concurrency", "", DefaultConnectConcurrency, "number of ports of a target the connect engine connects to at the same time")
+	cmd.PersistentFlags().IntP("connect-rate", "", 0, "maximum connection attempts per second of the connect engine across every target, 0 disables the limit")
+	cmd.PersistentFlags().DurationP("connect-timeout", "", 2*time.Second, "how long the connect engine waits for a connection before the port counts as filtered")
+	cmd.PersistentFlags().DurationP("banner-timeout", "", 2*time.Second, "how long the connect engine waits for the banner of an open port, 0 disables banner grabbing")
 	cmd.PersistentFlags().StringP("output", "o", "", "directory to store all generated output")
+	cmd.PersistentFlags().StringP("output-format", "", "", fmt.Sprintf("comma separated list of formats to export parsed results as, defaults to json,jsonl,csv. Supported formats: %s", strings.Join(export.Formats(), ", ")))
+	cmd.PersistentFlags().BoolP("masscan", "", false, "discover the open ports with masscan and only run nmap against the open ports found, the same as adding masscan in front of --engines. masscan discovers every TCP port unless --ports or a host:port target narrows them")
+	cmd.PersistentFlags().IntP("masscan-rate", "", 1000, "masscan packets per second")
+	cmd.PersistentFlags().BoolP("masscan-udp", "", false, "also discover open UDP ports with masscan, on the same ports as TCP unless --ports has UDP ports")
+	cmd.PersistentFlags().IntP("threads", "", 10, "maximum number of scans running at the same time across every scan phase")
+	cmd.PersistentFlags().IntP("max-parallel-hosts", "", 10, "number of hosts each scan phase scans at the same time")
+	cmd.PersistentFlags().IntP("nmap-threads", "", 0, "number of hosts the nmap phase scans at the same time, overrides --max-parallel-hosts")
+	cmd.PersistentFlags().IntP("udp-threads", "", 0, "number of hosts the UDP phase scans at the same time, overrides --max-parallel-hosts")
+	cmd.PersistentFlags().IntP("discovery-threads", "", 0, "number of hosts every discovery engine of --engines scans at the same time, overrides --max-parallel-hosts")
+	cmd.PersistentFlags().DurationP("host-timeout", "", 10*time.Minute, "maximum duration of the scan of a single target, 0 disables the limit")
+	cmd.PersistentFlags().DurationP("scan-timeout", "", 0, "deadline of the whole run, unfinished targets are marked incomplete, 0 disables the deadline")
+	cmd.PersistentFlags().IntP("max-attempts", "", 1, "number of times a failed scan of a target is attempted at most")
+	cmd.PersistentFlags().DurationP("retry-backoff", "", 30*time.Second, "wait before retrying a failed scan, doubled after every further failed attempt")
+	cmd.PersistentFlags().StringP("retry-on", "", "", fmt.Sprintf("comma separated list of failures to retry, defaults to empty-xml. Supported values: %s, %s, %s or nmap exit codes", FailureTimeout, FailureEmptyXML, FailureError))
+	cmd.PersistentFlags().StringP("profile", "", "", "scan profile to run, defaults to default. Built-in profiles: default, quick, full-tcp, udp-top, stealth, web, more can be defined under PROFILES in config.yaml")
+	cmd.PersistentFlags().StringP("ports", "", "", "ports to scan as an nmap style specification such as 22,80,8000-8100, T:443,U:53, top:100 or all, or a file of them. Defaults to the ports of the profile")
+	cmd.PersistentFlags().BoolP("udp", "", false, "also run a UDP scan of every target, its results are merged with the TCP results")
+	cmd.PersistentFlags().StringP("udp-profile", "", "", fmt.Sprintf("scan profile of the UDP phase, defaults to %s. The profile has to include the udp scan type", DefaultUDPProfile))
+	cmd.PersistentFlags().IntP("udp-top-ports", "", 0, "number of most common UDP ports the UDP phase scans, 0 scans the ports of the UDP profile")
+	cmd.PersistentFlags().StringP("webhook", "", "", "comma separated list of webhook URLs notified about the scan, Slack and Teams URLs get their own format. More webhooks can be configured under NOTIFY in config.yaml")
+	cmd.PersistentFlags().BoolP("resume", "", false, "resume an interrupted scan from the journal in the output directory, skipping the jobs that finished with the same ports, profile and exclusions and retrying failed ones")
 	return nil
 }
 
@@ -42,6 +135,38 @@ func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
 		opts.Target = target.(string)
 	}
 
+	exclude, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "exclude",
+		IsFilePath:           false,
+		Opts:                 opts.Exclude,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch reflect.TypeOf(exclude).Kind() {
+	case reflect.Slice:
+		opts.Exclude = exclude.([]string)
+	case reflect.String:
+		opts.Exclude = exclude.(string)
+	}
+
+	excludeFile, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "exclude-file",
+		IsFilePath: true,
+		Opts:       opts.ExcludeFile,
+	})
+	if err != nil {
+		return err
+	}
+	opts.ExcludeFile = excludeFile.(string)
+
+	expandTargets, err := utils.ConfigureBoolFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "expand-targets"})
+	if err != nil {
+		return err
+	}
+	opts.ExpandTargets = expandTargets
+
 	verbose, err := cmd.Flags().GetBool("verbose")
 	if err != nil {
 		return err
@@ -64,5 +189,327 @@ func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
 	}
 	opts.Output = output.(string)
 
+	outputFormat, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "output-format",
+		DefaultFlagVal:       "json,jsonl,csv",
+		Opts:                 opts.OutputFormat,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch outputFormat := outputFormat.(type) {
+	case []string:
+		opts.OutputFormat = outputFormat
+	case string:
+		opts.OutputFormat = strings.Split(outputFormat, ",")
+	}
+	if err = export.ValidateFormats(opts.OutputFormat); err != nil {
+		return err
+	}
+
+	runMasscan, err := utils.ConfigureBoolFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "masscan"})
+	if err != nil {
+		return err
+	}
+	opts.Masscan = runMasscan
+
+	masscanRate, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "masscan-rate"})
+	if err != nil {
+		return err
+	}
+	opts.MasscanRate = masscanRate
+
+	masscanUDP, err := utils.ConfigureBoolFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "masscan-udp"})
+	if err != nil {
+		return err
+	}
+	opts.MasscanUDP = masscanUDP
+
+	threads, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "threads"})
+	if err != nil {
+		return err
+	}
+	if threads < 1 {
+		return fmt.Errorf("threads must be at least 1, got %d", threads)
+	}
+	opts.Threads = threads
+
+	maxParallelHosts, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "max-parallel-hosts"})
+	if err != nil {
+		return err
+	}
+	if maxParallelHosts < 1 {
+		return fmt.Errorf("max-parallel-hosts must be at least 1, got %d", maxParallelHosts)
+	}
+	opts.MaxParallelHosts = maxParallelHosts
+
+	nmapThreads, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "nmap-threads"})
+	if err != nil {
+		return err
+	}
+	if nmapThreads < 0 {
+		return fmt.Errorf("nmap-threads cannot be negative, got %d", nmapThreads)
+	}
+	opts.NmapThreads = nmapThreads
+
+	udpThreads, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "udp-threads"})
+	if err != nil {
+		return err
+	}
+	if udpThreads < 0 {
+		return fmt.Errorf("udp-threads cannot be negative, got %d", udpThreads)
+	}
+	opts.UDPThreads = udpThreads
+
+	discoveryThreads, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "discovery-threads"})
+	if err != nil {
+		return err
+	}
+	if discoveryThreads < 0 {
+		return fmt.Errorf("discovery-threads cannot be negative, got %d", discoveryThreads)
+	}
+	opts.DiscoveryThreads = discoveryThreads
+
+	resume, err := utils.ConfigureBoolFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "resume"})
+	if err != nil {
+		return err
+	}
+	opts.Resume = resume
+
+	hostTimeout, err := utils.ConfigureDurationFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "host-timeout"})
+	if err != nil {
+		return err
+	}
+	opts.HostTimeout = hostTimeout
+
+	scanTimeout, err := utils.ConfigureDurationFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "scan-timeout"})
+	if err != nil {
+		return err
+	}
+	opts.ScanTimeout = scanTimeout
+
+	maxAttempts, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "max-attempts"})
+	if err != nil {
+		return err
+	}
+	if maxAttempts < 1 {
+		return fmt.Errorf("max-attempts must be at least 1, got %d", maxAttempts)
+	}
+	opts.MaxAttempts = maxAttempts
+
+	retryBackoff, err := utils.ConfigureDurationFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "retry-backoff"})
+	if err != nil {
+		return err
+	}
+	opts.RetryBackoff = retryBackoff
+
+	engines, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "engines",
+		DefaultFlagVal:       engineNmap,
+		Opts:                 opts.Engines,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch engines := engines.(type) {
+	case []string:
+		opts.Engines = parseList(strings.Join(engines, ","))
+	case string:
+		opts.Engines = parseList(engines)
+	}
+	// --stream-nmap predates --engines and streams the results of the last engine
+	if last := len(opts.Engines) - 1; opts.StreamNmap && last >= 0 && opts.Engines[last] == engineNmap {
+		opts.Engines[last] = engineNmapStream
+	}
+	if err = ValidateEngines(opts.Engines); err != nil {
+		return err
+	}
+
+	connectConcurrency, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "connect-concurrency"})
+	if err != nil {
+		return err
+	}
+	if connectConcurrency < 1 {
+		return fmt.Errorf("connect-concurrency must be at least 1, got %d", connectConcurrency)
+	}
+	opts.ConnectConcurrency = connectConcurrency
+
+	connectRate, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "connect-rate"})
+	if err != nil {
+		return err
+	}
+	opts.ConnectRate = connectRate
+
+	connectTimeout, err := utils.ConfigureDurationFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "connect-timeout"})
+	if err != nil {
+		return err
+	}
+	opts.ConnectTimeout = connectTimeout
+
+	bannerTimeout, err := utils.ConfigureDurationFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "banner-timeout"})
+	if err != nil {
+		return err
+	}
+	opts.BannerTimeout = bannerTimeout
+
+	retryOn, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "retry-on",
+		DefaultFlagVal:       FailureEmptyXML,
+		Opts:                 opts.RetryOn,
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	switch retryOn := retryOn.(type) {
+	case []string:
+		opts.RetryOn = parseList(strings.Join(retryOn, ","))
+	case string:
+		opts.RetryOn = parseList(retryOn)
+	}
+	if err = ValidateRetryOn(opts.RetryOn); err != nil {
+		return err
+	}
+
+	profileName, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:           "profile",
+		DefaultFlagVal: DefaultProfile,
+		Opts:           "",
+	})
+	if err != nil {
+		return err
+	}
+	profile, err := LoadProfile(profileName.(string))
+	if err != nil {
+		return err
+	}
+	opts.Profile = profile
+
+	portSpec, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:       "ports",
+		IsFilePath: true,
+		Opts:       "",
+	})
+	if err != nil {
+		return err
+	}
+	if portSpec.(string) != "" {
+		if opts.Ports, err = ParsePorts(portSpec.(string)); err != nil {
+			return err
+		}
+	}
+
+	udp, err := utils.ConfigureBoolFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "udp"})
+	if err != nil {
+		return err
+	}
+	opts.UDP = udp
+
+	udpProfileName, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:           "udp-profile",
+		DefaultFlagVal: DefaultUDPProfile,
+		Opts:           "",
+	})
+	if err != nil {
+		return err
+	}
+	udpTopPorts, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "udp-top-ports"})
+	if err != nil {
+		return err
+	}
+	if udpTopPorts < 0 {
+		return fmt.Errorf("udp-top-ports must not be negative, got %d", udpTopPorts)
+	}
+	if opts.UDP {
+		if opts.UDPProfile, err = LoadUDPProfile(udpProfileName.(string), udpTopPorts); err != nil {
+			return err
+		}
+	}
+
+	webhooks, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:                 "webhook",
+		Opts:                 "",
+		CommaInStringToSlice: true,
+	})
+	if err != nil {
+		return err
+	}
+	var webhookURLs []string
+	switch webhooks := webhooks.(type) {
+	case []string:
+		webhookURLs = webhooks
+	case string:
+		// webhook URLs often carry a case sensitive token, they are not lowercased like the other lists
+		webhookURLs = strings.Split(webhooks, ",")
+	}
+	if opts.Notify, err = notify.LoadConfig(webhookURLs); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// ParsePorts parses a port specification or a file of port specifications
+func ParsePorts(spec string) (*ports.Set, error) {
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		return ports.ParseFile(spec)
+	}
+	return ports.Parse(spec)
+}
+
+// defaultPorts returns the ports scanned on targets without ports of their own.
+// These are the --ports, nil when the profile selects its own ports and the top 1000 TCP ports otherwise.
+func (opts *Options) defaultPorts() ([]string, error) {
+	if opts.Ports != nil {
+		return opts.Ports.Strings(), nil
+	}
+	if opts.scanProfile().usesOwnPorts() {
+		return nil, nil
+	}
+	set, err := ports.Parse("top:1000")
+	if err != nil {
+		return nil, err
+	}
+	return set.Strings(), nil
+}
+
+// retryPolicy returns the retry policy configured with --max-attempts, --retry-backoff and --retry-on
+func (opts *Options) retryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: opts.MaxAttempts, Backoff: opts.RetryBackoff, RetryOn: opts.RetryOn}
+}
+
+// pipeline returns the engines selected with --engines, nmap when none were loaded.
+// --masscan predates --engines and runs masscan discovery ahead of the selected engines.
+func (opts *Options) pipeline() []string {
+	pipeline := []string{engineNmap}
+	switch {
+	case len(opts.Engines) > 0:
+		pipeline = opts.Engines
+	case opts.StreamNmap:
+		pipeline = []string{engineNmapStream}
+	}
+	if opts.Masscan && pipeline[0] != engineMasscan {
+		pipeline = append([]string{engineMasscan}, pipeline...)
+	}
+	return pipeline
+}
+
+// database returns the path of the results database the run is saved to
+func (opts *Options) database() string {
+	if opts.Database != "" {
+		return opts.Database
+	}
+	return store.Path(opts.Output)
+}
+
+// scanProfile returns the selected scan profile, the default profile when none was loaded
+func (opts *Options) scanProfile() *Profile {
+	if opts.Profile != nil {
+		return opts.Profile
+	}
+	profile := builtinProfiles[DefaultProfile]
+	profile.Name = DefaultProfile
+	return &profile
+}
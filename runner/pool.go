@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	phaseNmap = "nmap"
+	phaseUDP  = "udp"
+)
+
+// Limiter is a counting semaphore shared by every scan phase,
+// no matter how many phases run at once there are never more than its size scans running.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter that allows size jobs at the same time
+func NewLimiter(size int) *Limiter {
+	if size < 1 {
+		size = 1
+	}
+	return &Limiter{slots: make(chan struct{}, size)}
+}
+
+// Acquire blocks until a slot is free or ctx is cancelled
+func (l *Limiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken with Acquire
+func (l *Limiter) Release() {
+	<-l.slots
+}
+
+// Pool runs the jobs of a single scan phase.
+// At most Workers jobs of the phase run at the same time and every running job holds a slot of the shared Limiter.
+type Pool struct {
+	Phase   string
+	Workers int
+	Limiter *Limiter
+}
+
+// Run calls job once for every index in [0, n) and waits for all of them to return.
+// Once ctx is cancelled no new jobs are started, running jobs are expected to stop on their own.
+func (p *Pool) Run(ctx context.Context, n int, job func(ctx context.Context, i int)) {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if p.Limiter != nil {
+					if err := p.Limiter.Acquire(ctx); err != nil {
+						continue
+					}
+				}
+				if ctx.Err() == nil {
+					job(ctx, i)
+				}
+				if p.Limiter != nil {
+					p.Limiter.Release()
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// newPool returns the Pool of a scan phase, the phase specific thread option takes precedence over --max-parallel-hosts
+func (opts *Options) newPool(phase string, limiter *Limiter) *Pool {
+	workers := opts.MaxParallelHosts
+	if limit := opts.phaseThreads(phase); limit > 0 {
+		workers = limit
+	}
+	return &Pool{Phase: phase, Workers: workers, Limiter: limiter}
+}
+
+// phaseThreads returns the configured worker limit of a scan phase, 0 when it has none
+func (opts *Options) phaseThreads(phase string) int {
+	switch phase {
+	case phaseNmap:
+		return opts.NmapThreads
+	case phaseUDP:
+		return opts.UDPThreads
+	}
+	// every other phase is a discovery phase named after its engine
+	return opts.DiscoveryThreads
+}
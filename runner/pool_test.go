@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// maxTracker records the highest number of jobs that were running at the same time
+type maxTracker struct {
+	running int32
+	max     int32
+}
+
+func (m *maxTracker) job(_ context.Context, _ int) {
+	running := atomic.AddInt32(&m.running, 1)
+	for {
+		peak := atomic.LoadInt32(&m.max)
+		if running <= peak || atomic.CompareAndSwapInt32(&m.max, peak, running) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(&m.running, -1)
+}
+
+func TestPoolRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		workers  int
+		limit    int
+		jobs     int
+		wantPeak int32
+	}{
+		{"Workers Bound", 3, 10, 20, 3},
+		{"Limiter Bound", 8, 2, 20, 2},
+		{"Fewer Jobs Than Workers", 10, 10, 4, 4},
+		{"Zero Workers Runs Serially", 0, 10, 5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &maxTracker{}
+			var calls int32
+			pool := &Pool{Phase: phaseNmap, Workers: tt.workers, Limiter: NewLimiter(tt.limit)}
+			pool.Run(context.Background(), tt.jobs, func(ctx context.Context, i int) {
+				atomic.AddInt32(&calls, 1)
+				tracker.job(ctx, i)
+			})
+			if int(calls) != tt.jobs {
+				t.Errorf("Run() called job %d times, want %d", calls, tt.jobs)
+			}
+			if tracker.max != tt.wantPeak {
+				t.Errorf("Run() peak concurrency = %d, want %d", tracker.max, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestLimiterSharedAcrossPools(t *testing.T) {
+	limiter := NewLimiter(3)
+	tracker := &maxTracker{}
+	var wg sync.WaitGroup
+	for _, phase := range []string{phaseNmap, "other"} {
+		wg.Add(1)
+		go func(phase string) {
+			defer wg.Done()
+			pool := &Pool{Phase: phase, Workers: 3, Limiter: limiter}
+			pool.Run(context.Background(), 12, tracker.job)
+		}(phase)
+	}
+	wg.Wait()
+	if tracker.max > 3 {
+		t.Errorf("two pools sharing a limiter of 3 ran %d jobs at once", tracker.max)
+	}
+}
+
+func TestPoolRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	pool := &Pool{Phase: phaseNmap, Workers: 2, Limiter: NewLimiter(2)}
+	pool.Run(ctx, 100, func(ctx context.Context, i int) {
+		if atomic.AddInt32(&calls, 1) == 4 {
+			cancel()
+		}
+	})
+	// a job that was already running when ctx got cancelled may finish, nothing new is started
+	if calls < 4 || calls > 5 {
+		t.Errorf("Run() started %d jobs after cancellation at the 4th, want 4 or 5", calls)
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	tests := []struct {
+		name  string
+		phase string
+		opts  Options
+		want  int
+	}{
+		{"Default", phaseNmap, Options{MaxParallelHosts: 5}, 5},
+		{"Nmap Threads", phaseNmap, Options{MaxParallelHosts: 5, NmapThreads: 2, UDPThreads: 3, DiscoveryThreads: 4}, 2},
+		{"UDP Default", phaseUDP, Options{MaxParallelHosts: 5, NmapThreads: 2}, 5},
+		{"UDP Threads", phaseUDP, Options{MaxParallelHosts: 5, NmapThreads: 2, UDPThreads: 3, DiscoveryThreads: 4}, 3},
+		{"Discovery Default", engineMasscan, Options{MaxParallelHosts: 5, NmapThreads: 2}, 5},
+		{"Masscan Discovery", engineMasscan, Options{MaxParallelHosts: 5, NmapThreads: 2, UDPThreads: 3, DiscoveryThreads: 4}, 4},
+		{"Connect Discovery", engineConnect, Options{MaxParallelHosts: 5, DiscoveryThreads: 4}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.newPool(tt.phase, nil).Workers; got != tt.want {
+				t.Errorf("newPool(%s) workers = %d, want %d", tt.phase, got, tt.want)
+			}
+		})
+	}
+}
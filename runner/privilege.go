@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Privilege is what goforit is allowed to do when it runs nmap or masscan
+type Privilege string
+
+const (
+	// PrivilegeRoot is running as root, every scan type is available
+	PrivilegeRoot Privilege = "root"
+	// PrivilegeCapabilities is a binary with the cap_net_raw and cap_net_admin file capabilities,
+	// nmap has to be told with --privileged that it may use them
+	PrivilegeCapabilities Privilege = "capabilities"
+	// PrivilegeNone only allows unprivileged scans such as TCP connect scans
+	PrivilegeNone Privilege = "unprivileged"
+)
+
+// rawScanTypes are the scan types that need raw sockets
+var rawScanTypes = map[string]bool{"syn": true, "udp": true, "ack": true, "fin": true, "null": true, "xmas": true, "window": true, "maimon": true}
+
+// DetectPrivilege reports whether binary can open raw sockets when goforit runs it,
+// either because goforit runs as root or because binary has the cap_net_raw and cap_net_admin file capabilities
+func DetectPrivilege(binary string) Privilege {
+	if os.Geteuid() == 0 {
+		return PrivilegeRoot
+	}
+	if hasRawSocketCapabilities(binary) {
+		return PrivilegeCapabilities
+	}
+	return PrivilegeNone
+}
+
+// Raw reports whether scans that need raw sockets, such as SYN and UDP scans or OS detection, can run
+func (p Privilege) Raw() bool {
+	return p == PrivilegeRoot || p == PrivilegeCapabilities
+}
+
+// String describes the privilege for the scan log
+func (p Privilege) String() string {
+	switch p {
+	case PrivilegeRoot:
+		return "as root"
+	case PrivilegeCapabilities:
+		return "with the cap_net_raw and cap_net_admin capabilities"
+	default:
+		return "unprivileged, SYN scans fall back to TCP connect scans"
+	}
+}
+
+// forPrivilege returns a copy of the profile that runs with privilege.
+// With capabilities nmap gets --privileged, without any privilege SYN scans become TCP connect scans and OS detection is skipped.
+// Scan types that need raw sockets and have no unprivileged equivalent, like UDP scans, return an error.
+func (p *Profile) forPrivilege(privilege Privilege) (*Profile, error) {
+	profile := *p
+	switch privilege {
+	case PrivilegeRoot:
+		return &profile, nil
+	case PrivilegeCapabilities:
+		profile.ExtraArgs = append([]string{"--privileged"}, p.ExtraArgs...)
+		return &profile, nil
+	}
+
+	profile.ScanTypes = []string{"connect"}
+	for _, scanType := range p.ScanTypes {
+		scanType = strings.ToLower(scanType)
+		if rawScanTypes[scanType] && scanType != "syn" {
+			return nil, fmt.Errorf("profile %s: the %s scan needs root or nmap with the cap_net_raw and cap_net_admin capabilities, e.g. sudo setcap cap_net_raw,cap_net_admin+eip $(which nmap)", p.Name, scanType)
+		}
+	}
+	if p.OSDetection {
+		log.Printf("profile %s: skipping OS detection, it needs root or nmap with the cap_net_raw and cap_net_admin capabilities\n", p.Name)
+		profile.OSDetection = false
+	}
+	if p.Traceroute {
+		log.Printf("profile %s: skipping traceroute, it needs root or nmap with the cap_net_raw and cap_net_admin capabilities\n", p.Name)
+		profile.Traceroute = false
+	}
+	return &profile, nil
+}
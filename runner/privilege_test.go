@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileForPrivilege(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   string
+		privilege Privilege
+		want      string
+		wantErr   bool
+	}{
+		{"Root", "quick", PrivilegeRoot, "-vvv -Pn --top-ports 100 -T4 -sS -sV", false},
+		{"Capabilities", "quick", PrivilegeCapabilities, "-vvv -Pn --top-ports 100 -T4 -sS -sV --privileged", false},
+		{"Unprivileged SYN Scan", "quick", PrivilegeNone, "-vvv -Pn --top-ports 100 -T4 -sT -sV", false},
+		{"Unprivileged Default", DefaultProfile, PrivilegeNone, "-vvv -Pn -T4 -sT -sV --script default", false},
+		{"Unprivileged UDP Scan", "udp-top", PrivilegeNone, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := LoadProfile(tt.profile)
+			if err != nil {
+				t.Fatalf("LoadProfile() error = %v", err)
+			}
+			got, err := profile.forPrivilege(tt.privilege)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPrivilege() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if args := strings.Join(got.nmapArgs(nil), " "); args != tt.want {
+				t.Errorf("nmapArgs() got = %s, want %s", args, tt.want)
+			}
+			if tt.privilege != PrivilegeRoot && strings.Join(profile.nmapArgs(nil), " ") == tt.want {
+				t.Errorf("forPrivilege() modified the loaded profile")
+			}
+		})
+	}
+}
+
+func TestCheckPrivilege(t *testing.T) {
+	profile, err := LoadProfile(DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := []*scanPhase{{Name: phaseNmap, Profile: profile, Targets: map[string][]string{"10.0.0.1": {"22", "U:161"}}}}
+	if err = checkPrivilege(PrivilegeNone, phases); err == nil {
+		t.Errorf("checkPrivilege() scanned UDP ports without privileges")
+	}
+	if err = checkPrivilege(PrivilegeRoot, phases); err != nil {
+		t.Errorf("checkPrivilege() error = %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killGracePeriod is how long an interrupted process group gets to exit before it is killed
+const killGracePeriod = 5 * time.Second
+
+// runCommand runs cmd in its own process group and waits for it to exit.
+// When ctx is cancelled the whole group is interrupted and killed when it is still running after killGracePeriod.
+// No child processes are left behind.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			pgid := -cmd.Process.Pid
+			_ = syscall.Kill(pgid, syscall.SIGINT)
+			select {
+			case <-done:
+			case <-time.After(killGracePeriod):
+				_ = syscall.Kill(pgid, syscall.SIGKILL)
+			}
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s was interrupted: %w", cmd.Path, ctx.Err())
+	}
+	return err
+}
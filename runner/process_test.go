@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCommandCancelled(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not installed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := runCommand(ctx, exec.Command("sleep", "30"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runCommand() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > killGracePeriod {
+		t.Errorf("runCommand() took %s to stop the process", elapsed)
+	}
+
+	if err = runCommand(ctx, exec.Command("sleep", "30")); !errors.Is(err, context.Canceled) {
+		t.Errorf("runCommand() with a cancelled context error = %v, want context.Canceled", err)
+	}
+	if err = runCommand(context.Background(), exec.Command("true")); err != nil {
+		t.Errorf("runCommand() error = %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package runner
+
+import (
+	"fmt"
+	"github.com/mr-pmillz/goforit/ports"
+	"github.com/spf13/viper"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultProfile is the profile used when --profile is not set, it scans like goforit always did
+const DefaultProfile = "default"
+
+// Profile is a named set of nmap arguments, selected with --profile and defined under PROFILES in config.yaml
+type Profile struct {
+	Name        string `mapstructure:"-"`
+	Description string `mapstructure:"description"`
+	// Ports is a port specification such as 1-65535, T:80,U:53 or top:200, see ports.Parse. Ports of a target
+	// (host:port), found by masscan or given with --ports take precedence. Without Ports and TopPorts the top 1000 TCP ports are scanned.
+	Ports string `mapstructure:"ports"`
+	// TopPorts scans the n most common ports instead of Ports
+	TopPorts int `mapstructure:"top_ports"`
+	// Timing is an nmap timing template, 0-5 or paranoid, sneaky, polite, normal, aggressive or insane
+	Timing string `mapstructure:"timing"`
+	// ScanTypes are syn, connect, udp, ack, fin, null, xmas, window or maimon
+	ScanTypes []string `mapstructure:"scan_types"`
+	// Scripts are NSE scripts or categories, e.g. default or http-title
+	Scripts []string `mapstructure:"scripts"`
+	// ScriptArgs are NSE script arguments, e.g. http.useragent=Mozilla/5.0
+	ScriptArgs []string `mapstructure:"script_args"`
+	// HostDiscovery pings hosts before scanning them, without it every host is treated as up (-Pn)
+	HostDiscovery bool `mapstructure:"host_discovery"`
+	// VersionDetection probes open ports for their service and version (-sV)
+	VersionDetection bool `mapstructure:"version_detection"`
+	// OSDetection fingerprints the operating system (-O)
+	OSDetection bool `mapstructure:"os_detection"`
+	// Traceroute traces the hops to every host (--traceroute)
+	Traceroute bool `mapstructure:"traceroute"`
+	// ExtraArgs are passed to nmap as they are. Options that select the output, the targets, the exclusions or files nmap
+	// reads are not allowed since goforit manages the output files and the scope, see managedArgs. Every argument that is
+	// not an option has to be the value of the option before it, see valueArgs.
+	ExtraArgs []string `mapstructure:"extra_args"`
+}
+
+// builtinProfiles are available without any configuration, PROFILES in config.yaml may override them
+var builtinProfiles = map[string]Profile{
+	DefaultProfile: {
+		Description:      "top 1000 TCP ports with default scripts, version and OS detection and traceroute, like nmap -A",
+		Timing:           "4",
+		Scripts:          []string{"default"},
+		VersionDetection: true,
+		OSDetection:      true,
+		Traceroute:       true,
+	},
+	"quick": {
+		Description:      "top 100 TCP ports with version detection",
+		TopPorts:         100,
+		Timing:           "4",
+		ScanTypes:        []string{"syn"},
+		VersionDetection: true,
+	},
+	"full-tcp": {
+		Description:      "all 65535 TCP ports with default scripts and version detection",
+		Ports:            "1-65535",
+		Timing:           "4",
+		ScanTypes:        []string{"syn"},
+		Scripts:          []string{"default"},
+		VersionDetection: true,
+	},
+	"udp-top": {
+		Description:      "top 100 UDP ports with version detection and SNMP, IKE and NTP scripts",
+		TopPorts:         100,
+		Timing:           "4",
+		ScanTypes:        []string{"udp"},
+		Scripts:          []string{"snmp-info", "snmp-sysdescr", "ike-version", "ntp-info"},
+		VersionDetection: true,
+		// unanswered UDP probes are the norm, fewer retransmissions and a shorter round trip timeout keep the scan fast
+		ExtraArgs: []string{"--version-intensity", "0", "--max-retries", "2", "--max-rtt-timeout", "500ms"},
+	},
+	"stealth": {
+		Description: "slow SYN scan of the top 1000 TCP ports without scripts",
+		Timing:      "2",
+		ScanTypes:   []string{"syn"},
+		ExtraArgs:   []string{"--max-retries", "1", "--randomize-hosts"},
+	},
+	"web": {
+		Description:      "common web ports with HTTP and TLS scripts",
+		Ports:            "80,81,443,591,3000,5000,7001,8000,8008,8080,8081,8443,8888,9000,9090,9443",
+		Timing:           "4",
+		ScanTypes:        []string{"syn"},
+		Scripts:          []string{"http-title", "http-headers", "http-methods", "http-server-header", "ssl-cert"},
+		VersionDetection: true,
+	},
+}
+
+// managedArgs are the nmap options, or prefixes of them, that ExtraArgs may not contain. They write output files, add
+// targets or exclusions goforit does not know about, or read files and scripts from paths of the scanning host.
+var managedArgs = []string{
+	"-o", "--append-output", "--stylesheet", "--resume",
+	"-i", "--exclude",
+	"--datadir", "--servicedb", "--versiondb", "--script-args-file", "--script-updatedb",
+}
+
+// valueArgs are the nmap options ExtraArgs may give a value to as the next argument, e.g. --max-retries 1.
+// Any other argument that is not an option would be a target nmap scans without it being checked against the scope.
+var valueArgs = map[string]bool{
+	"-p": true, "--top-ports": true, "--port-ratio": true, "--exclude-ports": true,
+	"--min-rate": true, "--max-rate": true, "--max-retries": true, "--host-timeout": true, "--scan-delay": true, "--max-scan-delay": true,
+	"--min-rtt-timeout": true, "--max-rtt-timeout": true, "--initial-rtt-timeout": true,
+	"--min-hostgroup": true, "--max-hostgroup": true, "--min-parallelism": true, "--max-parallelism": true,
+	"--version-intensity": true, "--max-os-tries": true, "--script": true, "--script-args": true, "--scanflags": true,
+	"-S": true, "-e": true, "-g": true, "--source-port": true, "-D": true, "--spoof-mac": true, "--proxies": true, "--dns-servers": true,
+	"--data": true, "--data-string": true, "--data-length": true, "--ttl": true, "--mtu": true, "--ip-options": true, "--stats-every": true,
+}
+
+var (
+	timingTemplates = map[string]string{"paranoid": "0", "sneaky": "1", "polite": "2", "normal": "3", "aggressive": "4", "insane": "5"}
+	scanTypeFlags   = map[string]string{"syn": "-sS", "connect": "-sT", "udp": "-sU", "ack": "-sA", "fin": "-sF", "null": "-sN", "xmas": "-sX", "window": "-sW", "maimon": "-sM"}
+)
+
+// Profiles returns the built-in profiles merged with the PROFILES of config.yaml
+func Profiles() (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(builtinProfiles))
+	for name, profile := range builtinProfiles {
+		profiles[name] = profile
+	}
+	configured := make(map[string]Profile)
+	if err := viper.UnmarshalKey("PROFILES", &configured); err != nil {
+		return nil, fmt.Errorf("could not read PROFILES from config.yaml: %w", err)
+	}
+	for name, profile := range configured {
+		profiles[strings.ToLower(name)] = profile
+	}
+	for name, profile := range profiles {
+		profile.Name = name
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// LoadProfile returns the validated profile called name
+func LoadProfile(name string) (*Profile, error) {
+	profiles, err := Profiles()
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q, available profiles: %s", name, strings.Join(names, ", "))
+	}
+	if err = profile.Validate(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Validate returns an error for a timing template, scan type or extra argument nmap would not accept from goforit
+func (p *Profile) Validate() error {
+	if p.Timing != "" {
+		if _, ok := timingTemplates[strings.ToLower(p.Timing)]; !ok {
+			if t, err := strconv.Atoi(p.Timing); err != nil || t < 0 || t > 5 {
+				return fmt.Errorf("profile %s: invalid timing %q, use 0-5 or paranoid, sneaky, polite, normal, aggressive or insane", p.Name, p.Timing)
+			}
+		}
+	}
+	for _, scanType := range p.ScanTypes {
+		if _, ok := scanTypeFlags[strings.ToLower(scanType)]; !ok {
+			return fmt.Errorf("profile %s: unsupported scan type %q", p.Name, scanType)
+		}
+	}
+	if p.Ports != "" && p.TopPorts > 0 {
+		return fmt.Errorf("profile %s: set either ports or top_ports, not both", p.Name)
+	}
+	if p.Ports != "" {
+		if _, err := ports.Parse(p.Ports); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+	for _, script := range p.Scripts {
+		if isScriptPath(script) {
+			return fmt.Errorf("profile %s: script %q is a file, only scripts installed with nmap can be run", p.Name, script)
+		}
+	}
+	for i := 0; i < len(p.ExtraArgs); i++ {
+		arg := p.ExtraArgs[i]
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("profile %s: extra argument %q is not an option or the value of the option before it, targets cannot be given in extra_args", p.Name, arg)
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		for _, managed := range managedArgs {
+			if strings.HasPrefix(name, managed) {
+				return fmt.Errorf("profile %s: extra argument %q is managed by goforit", p.Name, arg)
+			}
+		}
+		if !hasValue && valueArgs[name] && i+1 < len(p.ExtraArgs) {
+			i++
+			value = p.ExtraArgs[i]
+		}
+		if name == "--script" && isScriptPath(value) {
+			return fmt.Errorf("profile %s: script %q is a file, only scripts installed with nmap can be run", p.Name, value)
+		}
+	}
+	return nil
+}
+
+// isScriptPath reports whether an nmap --script expression names a script file instead of an installed script or category
+func isScriptPath(scripts string) bool {
+	return strings.ContainsAny(scripts, `/\`) || strings.Contains(strings.ToLower(scripts), ".nse")
+}
+
+// usesOwnPorts reports whether the profile selects the ports to scan itself
+func (p *Profile) usesOwnPorts() bool {
+	return p.Ports != "" || p.TopPorts > 0
+}
+
+// nmapArgs returns the nmap arguments of the profile for a scan of ports, everything but the output options and the target.
+// Without ports the ports of the profile are scanned.
+func (p *Profile) nmapArgs(targetPorts []string) []string {
+	args := []string{"-vvv"}
+	if !p.HostDiscovery {
+		args = append(args, "-Pn")
+	}
+	if len(targetPorts) == 0 && p.Ports != "" {
+		// Validate already parsed the ports of the profile
+		if set, err := ports.Parse(p.Ports); err == nil {
+			targetPorts = set.Strings()
+		}
+	}
+	switch {
+	case len(targetPorts) > 0:
+		args = append(args, "-p", nmapPortSpec(targetPorts))
+	case p.TopPorts > 0:
+		args = append(args, "--top-ports", strconv.Itoa(p.TopPorts))
+	}
+	if p.Timing != "" {
+		timing := strings.ToLower(p.Timing)
+		if t, ok := timingTemplates[timing]; ok {
+			timing = t
+		}
+		args = append(args, "-T"+timing)
+	}
+	scanTypes := make(map[string]bool)
+	for _, scanType := range p.ScanTypes {
+		flag := scanTypeFlags[strings.ToLower(scanType)]
+		if !scanTypes[flag] {
+			scanTypes[flag] = true
+			args = append(args, flag)
+		}
+	}
+	// UDP ports found by masscan need a UDP scan next to the TCP scan
+	if hasUDPPorts(targetPorts) && !scanTypes["-sU"] {
+		if len(scanTypes) == 0 {
+			args = append(args, "-sS")
+		}
+		args = append(args, "-sU")
+	}
+	if p.VersionDetection {
+		args = append(args, "-sV")
+	}
+	if p.OSDetection {
+		args = append(args, "-O")
+	}
+	if p.Traceroute {
+		args = append(args, "--traceroute")
+	}
+	if len(p.Scripts) > 0 {
+		args = append(args, "--script", strings.Join(p.Scripts, ","))
+	}
+	if len(p.ScriptArgs) > 0 {
+		args = append(args, "--script-args", strings.Join(p.ScriptArgs, ","))
+	}
+	return append(args, p.ExtraArgs...)
+}
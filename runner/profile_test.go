@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"github.com/spf13/viper"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfileNmapArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		ports   []string
+		want    string
+	}{
+		{"Default With Ports", DefaultProfile, []string{"22", "80"}, "-vvv -Pn -p 22,80 -T4 -sV -O --traceroute --script default"},
+		{"Default With Masscan UDP Ports", DefaultProfile, []string{"22", "U:161"}, "-vvv -Pn -p T:22,U:161 -T4 -sS -sU -sV -O --traceroute --script default"},
+		{"Quick", "quick", nil, "-vvv -Pn --top-ports 100 -T4 -sS -sV"},
+		{"Quick With Target Ports", "quick", []string{"8443"}, "-vvv -Pn -p 8443 -T4 -sS -sV"},
+		{"Full TCP", "full-tcp", nil, "-vvv -Pn -p 1-65535 -T4 -sS -sV --script default"},
+		{"UDP Top", "udp-top", nil, "-vvv -Pn --top-ports 100 -T4 -sU -sV --script snmp-info,snmp-sysdescr,ike-version,ntp-info --version-intensity 0 --max-retries 2 --max-rtt-timeout 500ms"},
+		{"Stealth", "stealth", nil, "-vvv -Pn -T2 -sS --max-retries 1 --randomize-hosts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := LoadProfile(tt.profile)
+			if err != nil {
+				t.Fatalf("LoadProfile() error = %v", err)
+			}
+			if got := strings.Join(profile.nmapArgs(tt.ports), " "); got != tt.want {
+				t.Errorf("nmapArgs() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	viper.Set("PROFILES", map[string]interface{}{
+		"internal": map[string]interface{}{
+			"ports":             "T:445,U:137",
+			"timing":            "polite",
+			"scan_types":        []string{"syn", "udp"},
+			"scripts":           []string{"smb-os-discovery"},
+			"script_args":       []string{"smbdomain=ACME"},
+			"host_discovery":    true,
+			"version_detection": true,
+			"os_detection":      true,
+		},
+		"quick":      map[string]interface{}{"top_ports": 20},
+		"bad-timing": map[string]interface{}{"timing": "fast"},
+		"bad-output": map[string]interface{}{"extra_args": []string{"-oN", "/tmp/x"}},
+	})
+	defer viper.Set("PROFILES", nil)
+
+	profile, err := LoadProfile("internal")
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	want := []string{"-vvv", "-p", "T:445,U:137", "-T2", "-sS", "-sU", "-sV", "-O", "--script", "smb-os-discovery", "--script-args", "smbdomain=ACME"}
+	if got := profile.nmapArgs(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("nmapArgs() got = %v, want %v", got, want)
+	}
+	if profile, err = LoadProfile("QUICK"); err != nil || profile.TopPorts != 20 {
+		t.Errorf("LoadProfile() did not override the built-in quick profile: %+v, %v", profile, err)
+	}
+	for _, name := range []string{"bad-timing", "bad-output", "missing"} {
+		if _, err = LoadProfile(name); err == nil {
+			t.Errorf("LoadProfile(%s) error = nil, want an error", name)
+		}
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		wantErr bool
+	}{
+		{"Extra Args", Profile{ExtraArgs: []string{"--max-retries", "1", "--script", "http-title", "--min-rate=100"}}, false},
+		{"Output", Profile{ExtraArgs: []string{"-oN", "/tmp/scan.nmap"}}, true},
+		{"Append Output", Profile{ExtraArgs: []string{"--append-output"}}, true},
+		{"Stylesheet", Profile{ExtraArgs: []string{"--stylesheet", "/tmp/nmap.xsl"}}, true},
+		{"Resume", Profile{ExtraArgs: []string{"--resume", "/tmp/scan.gnmap"}}, true},
+		{"Input List", Profile{ExtraArgs: []string{"-iL", "/tmp/targets.txt"}}, true},
+		{"Random Targets", Profile{ExtraArgs: []string{"-iR", "1000"}}, true},
+		{"Exclude", Profile{ExtraArgs: []string{"--exclude", "10.0.0.1"}}, true},
+		{"Exclude File", Profile{ExtraArgs: []string{"--excludefile=/tmp/exclude.txt"}}, true},
+		{"Data Dir", Profile{ExtraArgs: []string{"--datadir", "/tmp"}}, true},
+		{"Service DB", Profile{ExtraArgs: []string{"--servicedb", "/tmp/services"}}, true},
+		{"Version DB", Profile{ExtraArgs: []string{"--versiondb=/tmp/probes"}}, true},
+		{"Script Args File", Profile{ExtraArgs: []string{"--script-args-file", "/tmp/args.txt"}}, true},
+		{"Script File", Profile{ExtraArgs: []string{"--script", "/tmp/evil.nse"}}, true},
+		{"Script File With Equals", Profile{ExtraArgs: []string{"--script=default,../evil"}}, true},
+		{"Values", Profile{ExtraArgs: []string{"-e", "eth0", "--data-length", "16", "-D", "RND:5", "-p", "1-1024", "--scan-delay=1s"}}, false},
+		{"Bare Target", Profile{ExtraArgs: []string{"--max-retries", "1", "10.0.0.0/8"}}, true},
+		{"Target First", Profile{ExtraArgs: []string{"scanme.nmap.org", "--max-retries", "1"}}, true},
+		{"Target After Flag", Profile{ExtraArgs: []string{"--randomize-hosts", "10.0.0.1"}}, true},
+		{"Target After Value With Equals", Profile{ExtraArgs: []string{"--min-rate=100", "10.0.0.1"}}, true},
+		{"Profile Script File", Profile{Scripts: []string{"evil.nse"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.profile.Name = "test"
+			if err := tt.profile.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
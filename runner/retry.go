@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failure kinds of a single scan, they are also the non numeric values of --retry-on
+const (
+	FailureTimeout  = "timeout"
+	FailureEmptyXML = "empty-xml"
+	FailureExitCode = "exit-code"
+	FailureError    = "error"
+)
+
+// maxBackoff caps the exponential backoff between two attempts
+const maxBackoff = 10 * time.Minute
+
+// ScanError is why the scan of a single target failed
+type ScanError struct {
+	Target string
+	// Kind is one of FailureTimeout, FailureEmptyXML, FailureExitCode or FailureError
+	Kind string
+	// ExitCode is the exit code of nmap when Kind is FailureExitCode
+	ExitCode int
+	Err      error
+}
+
+func (e *ScanError) Error() string {
+	switch e.Kind {
+	case FailureTimeout:
+		return fmt.Sprintf("scan of %s timed out", e.Target)
+	case FailureEmptyXML:
+		return fmt.Sprintf("scan of %s wrote no usable XML: %v", e.Target, e.Err)
+	case FailureExitCode:
+		return fmt.Sprintf("scan of %s exited with status %d", e.Target, e.ExitCode)
+	default:
+		return fmt.Sprintf("scan of %s failed: %v", e.Target, e.Err)
+	}
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// newScanError classifies the error of a finished scan of target.
+// hostCtx is the context of the single scan, a scan that ran into its deadline timed out.
+func newScanError(hostCtx context.Context, target string, err error) *ScanError {
+	if errors.Is(hostCtx.Err(), context.DeadlineExceeded) {
+		return &ScanError{Target: target, Kind: FailureTimeout, Err: hostCtx.Err()}
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ScanError{Target: target, Kind: FailureExitCode, ExitCode: exitErr.ExitCode(), Err: err}
+	}
+	return &ScanError{Target: target, Kind: FailureError, Err: err}
+}
+
+// readXMLOutput reads the XML file a scan of target wrote in a single streaming pass and returns the open ports and
+// open services of its hosts, only hosts with open ports are kept. It returns a FailureEmptyXML ScanError when the scan
+// did not write a usable XML file.
+func readXMLOutput(target, xmlFile string) (*ScanResult, error) {
+	info, err := os.Stat(xmlFile)
+	switch {
+	case err != nil:
+		return nil, &ScanError{Target: target, Kind: FailureEmptyXML, Err: err}
+	case info.Size() == 0:
+		return nil, &ScanError{Target: target, Kind: FailureEmptyXML, Err: fmt.Errorf("%s is empty", xmlFile)}
+	}
+	result := &ScanResult{}
+	builder := export.NewBuilder()
+	_, err = nmapxml.StreamFile(xmlFile, func(host *nmapxml.Host) error {
+		openPorts := host.OpenPorts()
+		if len(openPorts) == 0 {
+			return nil
+		}
+		for _, port := range openPorts {
+			result.OpenPorts = append(result.OpenPorts, portString(port.Protocol, port.PortID))
+		}
+		builder.AddHost(host)
+		return nil
+	})
+	if err != nil {
+		return nil, &ScanError{Target: target, Kind: FailureEmptyXML, Err: err}
+	}
+	result.Services = builder.Document().OpenServices()
+	return result, nil
+}
+
+// RetryPolicy decides which failed scans are attempted again and how long to wait in between
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a target is scanned at most, values below 1 mean a single attempt
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, it doubles with every further attempt
+	Backoff time.Duration
+	// RetryOn are the failure kinds and nmap exit codes worth another attempt, e.g. empty-xml,timeout,1
+	RetryOn []string
+}
+
+// ValidateRetryOn returns an error for an unknown --retry-on value
+func ValidateRetryOn(retryOn []string) error {
+	for _, value := range retryOn {
+		switch value {
+		case FailureTimeout, FailureEmptyXML, FailureError:
+			continue
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("unsupported retry-on value %q, use %s, %s, %s or an nmap exit code", value, FailureTimeout, FailureEmptyXML, FailureError)
+		}
+	}
+	return nil
+}
+
+// retryable reports whether a scan that failed with err should be attempted again
+func (p *RetryPolicy) retryable(err error) bool {
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) {
+		return false
+	}
+	for _, value := range p.RetryOn {
+		if value == scanErr.Kind || scanErr.Kind == FailureExitCode && value == strconv.Itoa(scanErr.ExitCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait after the failed attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// run calls scan until it succeeds, fails with an error that is not retried, MaxAttempts is reached or ctx is cancelled.
+// It returns the error of the last attempt.
+func (p *RetryPolicy) run(ctx context.Context, scan func(ctx context.Context, attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := scan(ctx, attempt)
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+		backoff := p.backoff(attempt)
+		log.Printf("%v, attempt %d of %d, retrying in %s", err, attempt, p.MaxAttempts, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// withHostTimeout returns the context of a single scan, a timeout of 0 does not limit the scan
+func withHostTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// parseList splits a comma separated flag value such as --retry-on into lowercase values
+func parseList(value string) []string {
+	var retryOn []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			retryOn = append(retryOn, v)
+		}
+	}
+	return retryOn
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRun(t *testing.T) {
+	timeout := &ScanError{Target: "10.0.0.1", Kind: FailureTimeout}
+	emptyXML := &ScanError{Target: "10.0.0.1", Kind: FailureEmptyXML, Err: errors.New("empty")}
+	exit1 := &ScanError{Target: "10.0.0.1", Kind: FailureExitCode, ExitCode: 1}
+	exit2 := &ScanError{Target: "10.0.0.1", Kind: FailureExitCode, ExitCode: 2}
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		failures     []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{"Success", RetryPolicy{MaxAttempts: 3, RetryOn: []string{FailureEmptyXML}}, nil, 1, nil},
+		{"Retry Empty XML Until Success", RetryPolicy{MaxAttempts: 3, RetryOn: []string{FailureEmptyXML}}, []error{emptyXML, emptyXML}, 3, nil},
+		{"Give Up After Max Attempts", RetryPolicy{MaxAttempts: 2, RetryOn: []string{FailureEmptyXML}}, []error{emptyXML, emptyXML, emptyXML}, 2, emptyXML},
+		{"Timeout Not Retried", RetryPolicy{MaxAttempts: 3, RetryOn: []string{FailureEmptyXML}}, []error{timeout}, 1, timeout},
+		{"Timeout Retried", RetryPolicy{MaxAttempts: 3, RetryOn: []string{FailureTimeout}}, []error{timeout}, 2, nil},
+		{"Exit Code Retried", RetryPolicy{MaxAttempts: 3, RetryOn: []string{"1"}}, []error{exit1}, 2, nil},
+		{"Other Exit Code Not Retried", RetryPolicy{MaxAttempts: 3, RetryOn: []string{"1"}}, []error{exit2}, 1, exit2},
+		{"Zero Max Attempts", RetryPolicy{RetryOn: []string{FailureEmptyXML}}, []error{emptyXML}, 1, emptyXML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := tt.policy.run(context.Background(), func(ctx context.Context, attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Errorf("run() passed attempt %d, want %d", attempt, attempts)
+				}
+				if attempt <= len(tt.failures) {
+					return tt.failures[attempt-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) && err != tt.wantErr {
+				t.Errorf("run() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("run() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{Backoff: 30 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 10: maxBackoff} {
+		if got := policy.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	// a cancelled context ends the wait for the next attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	policy = &RetryPolicy{MaxAttempts: 5, Backoff: time.Hour, RetryOn: []string{FailureEmptyXML}}
+	attempts := 0
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_ = policy.run(ctx, func(ctx context.Context, attempt int) error {
+		attempts++
+		return &ScanError{Kind: FailureEmptyXML}
+	})
+	if attempts != 1 {
+		t.Errorf("run() attempts after cancellation = %d, want 1", attempts)
+	}
+}
+
+func TestNewScanError(t *testing.T) {
+	hostCtx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-hostCtx.Done()
+	if got := newScanError(hostCtx, "10.0.0.1", errors.New("killed")); got.Kind != FailureTimeout {
+		t.Errorf("newScanError() after the host timeout kind = %q, want %q", got.Kind, FailureTimeout)
+	}
+
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	got := newScanError(context.Background(), "10.0.0.1", exitErr)
+	if got.Kind != FailureExitCode || got.ExitCode != 3 {
+		t.Errorf("newScanError() kind = %q exit code = %d, want %q 3", got.Kind, got.ExitCode, FailureExitCode)
+	}
+}
+
+func TestReadXMLOutput(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.xml")
+	truncated := filepath.Join(dir, "truncated.xml")
+	_ = os.WriteFile(empty, nil, 0600)
+	_ = os.WriteFile(truncated, []byte(`<?xml version="1.0"?><nmaprun scanner="nmap"><host>`), 0600)
+	tests := []struct {
+		name         string
+		file         string
+		wantPorts    []string
+		wantServices int
+		wantErr      bool
+	}{
+		{"Complete", "../nmapxml/testdata/multihost.xml", []string{"22", "80", "445"}, 3, false},
+		{"Missing", filepath.Join(dir, "missing.xml"), nil, 0, true},
+		{"Empty", empty, nil, 0, true},
+		{"Truncated", truncated, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := readXMLOutput("10.0.0.1", tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readXMLOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var scanErr *ScanError
+			if err != nil {
+				if !errors.As(err, &scanErr) || scanErr.Kind != FailureEmptyXML {
+					t.Errorf("readXMLOutput() error = %v, want a %s ScanError", err, FailureEmptyXML)
+				}
+				return
+			}
+			if !reflect.DeepEqual(result.OpenPorts, tt.wantPorts) {
+				t.Errorf("readXMLOutput() open ports got = %v, want %v", result.OpenPorts, tt.wantPorts)
+			}
+			if len(result.Services) != tt.wantServices {
+				t.Errorf("readXMLOutput() services got = %d, want %d", len(result.Services), tt.wantServices)
+			}
+		})
+	}
+}
+
+func TestValidateRetryOn(t *testing.T) {
+	if err := ValidateRetryOn(parseList("empty-xml, Timeout,1,255")); err != nil {
+		t.Errorf("ValidateRetryOn() error = %v", err)
+	}
+	if err := ValidateRetryOn([]string{"sometimes"}); err == nil {
+		t.Errorf("ValidateRetryOn() accepted an unknown value")
+	}
+}
@@ -1,73 +1,331 @@
 package runner
 
 import (
+	"context"
 	"fmt"
 	"github.com/k0kubun/pp/v3"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/store"
+	"github.com/mr-pmillz/goforit/target"
 	"github.com/mr-pmillz/goforit/utils"
-	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Hosts is the normalized, deduplicated and in scope set of targets to scan
 type Hosts struct {
 	Targets []string
+	// Ports holds the ports of targets that were given as host:port
+	Ports map[string][]string
+	// Exclude holds the addresses of CIDR and range targets that are out of scope or scanned by another target, as CIDRs
+	Exclude map[string][]string
+	Counts  target.Counts
 }
 
-// NewTargets ...
+// NewTargets reads the targets from the target flag, config.yaml or a file of targets.
+// CIDRs and ranges are kept as single targets unless --expand-targets is set, duplicates are removed and anything
+// matching the exclude list is dropped.
+// Every target is validated before it gets queued, invalid targets are reported with their line number.
+// Hosts.Counts tells how the targets were normalized.
 func NewTargets(opts *Options) (*Hosts, error) {
-	hosts := new(Hosts)
+	scope, err := newScope(opts)
+	if err != nil {
+		return nil, err
+	}
+	set := target.NewSet(scope)
+	set.Ranges = !opts.ExpandTargets
+	set.Limit = opts.MaxTargets
+
 	targetType := reflect.TypeOf(opts.Target)
 	switch targetType.Kind() {
 	case reflect.String:
 		if opts.Target.(string) != "" {
 			if exists, err := utils.Exists(opts.Target.(string)); exists && err == nil {
-				targets, err := utils.ReadLines(opts.Target.(string))
+				lines, err := utils.ReadLines(opts.Target.(string))
 				if err != nil {
 					return nil, err
 				}
-				hosts.Targets = append(hosts.Targets, targets...)
-			} else {
-				hosts.Targets = append(hosts.Targets, opts.Target.(string))
+				if err = set.Add(opts.Target.(string), lines); err != nil {
+					return nil, err
+				}
+			} else if err = set.Add("", []string{opts.Target.(string)}); err != nil {
+				return nil, err
 			}
 		}
 	case reflect.Slice:
-		// simplified
-		hosts.Targets = append(hosts.Targets, opts.Target.([]string)...)
+		if err = set.Add("", opts.Target.([]string)); err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := &Hosts{
+		Ports:   make(map[string][]string),
+		Exclude: make(map[string][]string),
+		Counts:  set.Counts(),
+	}
+	for _, t := range set.Targets() {
+		hosts.Targets = append(hosts.Targets, t.Host)
+		if len(t.Ports) > 0 {
+			hosts.Ports[t.Host] = t.Ports
+		}
+		if len(t.Exclude) > 0 {
+			hosts.Exclude[t.Host] = t.Exclude
+		}
+	}
+	if scope.Len() > 0 && hosts.Counts.Unique == 0 {
+		return nil, fmt.Errorf("every target is excluded by the %d exclusion(s)", scope.Len())
 	}
 
 	return hosts, nil
 }
 
-func (h *Hosts) Scanner(opts *Options) error {
-	fmt.Printf("Running scan against target(s):\n %+v\n", h.Targets)
+// newScope builds the out of scope exclusions from the exclude flag and exclude file
+func newScope(opts *Options) (*target.Scope, error) {
+	scope := target.NewScope()
+	switch exclude := opts.Exclude.(type) {
+	case string:
+		if err := scope.Add("exclude", []string{exclude}); err != nil {
+			return nil, err
+		}
+	case []string:
+		if err := scope.Add("exclude", exclude); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ExcludeFile == "" {
+		return scope, nil
+	}
+
+	lines, err := utils.ReadLines(opts.ExcludeFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read exclude file: %w", err)
+	}
+	if err = scope.Add(opts.ExcludeFile, lines); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// Scanner runs every scan phase against the targets and exports the parsed results.
+// When ctx is cancelled no new scans are started, running scans are stopped and the results of the finished scans are still exported.
+func (h *Hosts) Scanner(ctx context.Context, opts *Options) (err error) {
+	started := time.Now()
+	fmt.Printf("Running scan against %d target(s)\n", len(h.Targets))
 	fmt.Printf("Using Options:\n %+v\n", opts)
 
-	// TODO: Get All Open TCP/UDP Ports with Masscan...
+	if opts.ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ScanTimeout)
+		defer cancel()
+	}
+	pipeline, err := newPipeline(opts.pipeline(), opts)
+	if err != nil {
+		return err
+	}
+	engine := pipeline[len(pipeline)-1]
+	// nmap runs as the invoking user, the scan types follow from whether it may open raw sockets
+	privilege := PrivilegeRoot
+	if engine.Capabilities().Privileged {
+		nmapPath, err := exec.LookPath("nmap")
+		if err != nil {
+			return fmt.Errorf("could not get nmap path: %w", err)
+		}
+		privilege = DetectPrivilege(nmapPath)
+		fmt.Printf("Running nmap %s\n", privilege)
+	}
+	journal, err := OpenJournal(opts.Output, opts.Resume)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	notifier := newScanNotifier(opts)
+	defer notifier.Close(notifyCloseTimeout)
+	notifier.started(h, opts)
+	// the summary is sent however the scan ends, with what was exported so far and the error that ended it
+	doc := &export.Document{}
+	run := &store.Run{StartedAt: started, Profile: opts.scanProfile().Name, Engines: opts.pipeline(), Targets: len(h.Targets)}
+	result := &phaseResult{}
+	defer func() { notifier.finished(doc, started, run, result.Failed, err) }()
 
-	// Run Nmap Against Top Ports. TODO: Run Nmap against found Open ports from parsed Masscan
-	topPorts := []string{"1", "3", "4", "6", "7", "9", "13", "17", "19", "20", "21", "22", "23", "24", "25", "26", "30", "32", "33", "37", "42", "43", "49", "53", "70", "79", "80", "81", "82", "83", "84", "85", "88", "89", "90", "99", "100", "106", "109", "110", "111", "113", "119", "125", "135", "139", "143", "144", "146", "161", "163", "179", "199", "211", "212", "222", "254", "255", "256", "259", "264", "280", "301", "306", "311", "340", "366", "389", "406", "407", "416", "417", "425", "427", "443", "444", "445", "458", "464", "465", "481", "497", "500", "512", "513", "514", "515", "524", "541", "543", "544", "545", "548", "554", "555", "563", "587", "593", "616", "617", "625", "631", "636", "646", "648", "666", "667", "668", "683", "687", "691", "700", "705", "711", "714", "720", "722", "726", "749", "765", "777", "783", "787", "800", "801", "808", "843", "873", "880", "888", "898", "900", "901", "902", "903", "911", "912", "981", "987", "990", "992", "993", "995", "999", "1000", "1001", "1002", "1007", "1009", "1010", "1011", "1021", "1022", "1023", "1024", "1025", "1026", "1027", "1028", "1029", "1030", "1031", "1032", "1033", "1034", "1035", "1036", "1037", "1038", "1039", "1040", "1041", "1042", "1043", "1044", "1045", "1046", "1047", "1048", "1049", "1050", "1051", "1052", "1053", "1054", "1055", "1056", "1057", "1058", "1059", "1060", "1061", "1062", "1063", "1064", "1065", "1066", "1067", "1068", "1069", "1070", "1071", "1072", "1073", "1074", "1075", "1076", "1077", "1078", "1079", "1080", "1081", "1082", "1083", "1084", "1085", "1086", "1087", "1088", "1089", "1090", "1091", "1092", "1093", "1094", "1095", "1096", "1097", "1098", "1099", "1100", "1102", "1104", "1105", "1106", "1107", "1108", "1110", "1111", "1112", "1113", "1114", "1117", "1119", "1121", "1122", "1123", "1124", "1126", "1130", "1131", "1132", "1137", "1138", "1141", "1145", "1147", "1148", "1149", "1151", "1152", "1154", "1163", "1164", "1165", "1166", "1169", "1174", "1175", "1183", "1185", "1186", "1187", "1192", "1198", "1199", "1201", "1213", "1216", "1217", "1218", "1233", "1234", "1236", "1244", "1247", "1248", "1259", "1271", "1272", "1277", "1287", "1296", "1300", "1301", "1309", "1310", "1311", "1322", "1328", "1334", "1352", "1417", "1433", "1434", "1443", "1455", "1461", "1494", "1500", "1501", "1503", "1521", "1524", "1533", "1556", "1580", "1583", "1594", "1600", "1641", "1658", "1666", "1687", "1688", "1700", "1717", "1718", "1719", "1720", "1721", "1723", "1755", "1761", "1782", "1783", "1801", "1805", "1812", "1839", "1840", "1862", "1863", "1864", "1875", "1900", "1914", "1935", "1947", "1971", "1972", "1974", "1984", "1998", "1999", "2000", "2001", "2002", "2003", "2004", "2005", "2006", "2007", "2008", "2009", "2010", "2013", "2020", "2021", "2022", "2030", "2033", "2034", "2035", "2038", "2040", "2041", "2042", "2043", "2045", "2046", "2047", "2048", "2049", "2065", "2068", "2099", "2100", "2103", "2105", "2106", "2107", "2111", "2119", "2121", "2126", "2135", "2144", "2160", "2161", "2170", "2179", "2190", "2191", "2196", "2200", "2222", "2251", "2260", "2288", "2301", "2323", "2366", "2381", "2382", "2383", "2393", "2394", "2399", "2401", "2492", "2500", "2522", "2525", "2557", "2601", "2602", "2604", "2605", "2607", "2608", "2638", "2701", "2702", "2710", "2717", "2718", "2725", "2800", "2809", "2811", "2869", "2875", "2909", "2910", "2920", "2967", "2968", "2998", "3000", "3001", "3003", "3005", "3006", "3007", "3011", "3013", "3017", "3030", "3031", "3052", "3071", "3077", "3128", "3168", "3211", "3221", "3260", "3261", "3268", "3269", "3283", "3300", "3301", "3306", "3322", "3323", "3324", "3325", "3333", "3351", "3367", "3369", "3370", "3371", "3372", "3389", "3390", "3404", "3476", "3493", "3517", "3527", "3546", "3551", "3580", "3659", "3689", "3690", "3703", "3737", "3766", "3784", "3800", "3801", "3809", "3814", "3826", "3827", "3828", "3851", "3869", "3871", "3878", "3880", "3889", "3905", "3914", "3918", "3920", "3945", "3971", "3986", "3995", "3998", "4000", "4001", "4002", "4003", "4004", "4005", "4006", "4045", "4111", "4125", "4126", "4129", "4224", "4242", "4279", "4321", "4343", "4443", "4444", "4445", "4446", "4449", "4550", "4567", "4662", "4848", "4899", "4900", "4998", "5000", "5001", "5002", "5003", "5004", "5009", "5030", "5033", "5050", "5051", "5054", "5060", "5061", "5080", "5087", "5100", "5101", "5102", "5120", "5190", "5200", "5214", "5221", "5222", "5225", "5226", "5269", "5280", "5298", "5357", "5405", "5414", "5431", "5432", "5440", "5500", "5510", "5544", "5550", "5555", "5560", "5566", "5631", "5633", "5666", "5678", "5679", "5718", "5730", "5800", "5801", "5802", "5810", "5811", "5815", "5822", "5825", "5850", "5859", "5862", "5877", "5900", "5901", "5902", "5903", "5904", "5906", "5907", "5910", "5911", "5915", "5922", "5925", "5950", "5952", "5959", "5960", "5961", "5962", "5963", "5987", "5988", "5989", "5998", "5999", "6000", "6001", "6002", "6003", "6004", "6005", "6006", "6007", "6009", "6025", "6059", "6100", "6101", "6106", "6112", "6123", "6129", "6156", "6346", "6389", "6502", "6510", "6543", "6547", "6565", "6566", "6567", "6580", "6646", "6666", "6667", "6668", "6669", "6689", "6692", "6699", "6779", "6788", "6789", "6792", "6839", "6881", "6901", "6969", "7000", "7001", "7002", "7004", "7007", "7019", "7025", "7070", "7100", "7103", "7106", "7200", "7201", "7402", "7435", "7443", "7496", "7512", "7625", "7627", "7676", "7741", "7777", "7778", "7800", "7911", "7920", "7921", "7937", "7938", "7999", "8000", "8001", "8002", "8007", "8008", "8009", "8010", "8011", "8021", "8022", "8031", "8042", "8045", "8080", "8081", "8082", "8083", "8084", "8085", "8086", "8087", "8088", "8089", "8090", "8093", "8099", "8100", "8180", "8181", "8192", "8193", "8194", "8200", "8222", "8254", "8290", "8291", "8292", "8300", "8333", "8383", "8400", "8402", "8443", "8500", "8600", "8649", "8651", "8652", "8654", "8701", "8800", "8873", "8888", "8899", "8994", "9000", "9001", "9002", "9003", "9009", "9010", "9011", "9040", "9050", "9071", "9080", "9081", "9090", "9091", "9099", "9100", "9101", "9102", "9103", "9110", "9111", "9200", "9207", "9220", "9290", "9415", "9418", "9485", "9500", "9502", "9503", "9535", "9575", "9593", "9594", "9595", "9618", "9666", "9876", "9877", "9878", "9898", "9900", "9917", "9929", "9943", "9944", "9968", "9998", "9999", "10000", "10001", "10002", "10003", "10004", "10009", "10010", "10012", "10024", "10025", "10082", "10180", "10215", "10243", "10566", "10616", "10617", "10621", "10626", "10628", "10629", "10778", "11110", "11111", "11967", "12000", "12174", "12265", "12345", "13456", "13722", "13782", "13783", "14000", "14238", "14441", "14442", "15000", "15002", "15003", "15004", "15660", "15742", "16000", "16001", "16012", "16016", "16018", "16080", "16113", "16992", "16993", "17877", "17988", "18040", "18101", "18988", "19101", "19283", "19315", "19350", "19780", "19801", "19842", "20000", "20005", "20031", "20221", "20222", "20828", "21571", "22939", "23502", "24444", "24800", "25734", "25735", "26214", "27000", "27352", "27353", "27355", "27356", "27715", "28201", "30000", "30718", "30951", "31038", "31337", "32768", "32769", "32770", "32771", "32772", "32773", "32774", "32775", "32776", "32777", "32778", "32779", "32780", "32781", "32782", "32783", "32784", "32785", "33354", "33899", "34571", "34572", "34573", "35500", "38292", "40193", "40911", "41511", "42510", "44176", "44442", "44443", "44501", "45100", "48080", "49152", "49153", "49154", "49155", "49156", "49157", "49158", "49159", "49160", "49161", "49163", "49165", "49167", "49175", "49176", "49400", "49999", "50000", "50001", "50002", "50003", "50006", "50300", "50389", "50500", "50636", "50800", "51103", "51493", "52673", "52822", "52848", "52869", "54045", "54328", "55055", "55056", "55555", "55600", "56737", "56738", "57294", "57797", "58080", "60020", "60443", "61532", "61900", "62078", "63331", "64623", "64680", "65000", "65129", "65389"}
-	targets := make(map[string][]string)
-	for _, target := range h.Targets {
-		targets[target] = topPorts
+	// Run Nmap Against the --ports, the ports of the profile or the top 1000 ports unless a discovery engine finds the open ports first
+	defaultPorts, err := opts.defaultPorts()
+	if err != nil {
+		return err
+	}
+	// discovery engines scan their own default ports unless --ports narrows them, masscan discovers every TCP port
+	if len(pipeline) > 1 && opts.Ports == nil {
+		defaultPorts = nil
+	}
+	targets := make(map[string][]string, len(h.Targets))
+	for _, host := range h.Targets {
+		targets[host] = defaultPorts
+		if ports, ok := h.Ports[host]; ok {
+			targets[host] = ports
+		}
 	}
 
-	switch {
-	case opts.StreamNmap:
-		if err := streamNmap(targets, opts.Output); err != nil {
+	// every scan phase shares one limiter so that --threads bounds the total number of running scans
+	limiter := NewLimiter(opts.Threads)
+	// discovery engines narrow the ports of every target down to the open ports they find
+	for _, discovery := range pipeline[:len(pipeline)-1] {
+		phase := &scanPhase{Name: discovery.Capabilities().Name, Engine: discovery, Profile: opts.scanProfile(), Targets: targets, Exclude: h.Exclude}
+		// engines that cannot scan ranges run against their addresses, the open ports are kept by address
+		if !discovery.Capabilities().Ranges {
+			if err = phase.expandRanges(); err != nil {
+				return err
+			}
+		}
+		scanned := sortedTargets(phase.Targets)
+		discovered, err := runPhases(ctx, []*scanPhase{phase}, opts, limiter, journal)
+		if err != nil {
 			return err
 		}
-	default:
-		if err := runNmapAsync(opts.Output, targets); err != nil {
+		result.merge(discovered)
+		targets = journal.OpenPorts(phase.Name, scanned)
+		fmt.Printf("The %s engine found open ports on %d target(s)\n", phase.Name, len(targets))
+	}
+
+	phases := []*scanPhase{{Name: phaseNmap, Engine: engine, Profile: opts.scanProfile(), Targets: targets, Exclude: h.Exclude}}
+	if opts.UDP {
+		if !engine.Capabilities().UDP {
+			return fmt.Errorf("the %s engine cannot scan UDP ports", engine.Capabilities().Name)
+		}
+		udp := opts.udpPhase(engine, h.Targets)
+		udp.Exclude = h.Exclude
+		phases = append(phases, udp)
+	}
+	if engine.Capabilities().Privileged {
+		if err = checkPrivilege(privilege, phases); err != nil {
 			return err
 		}
 	}
-	parsedNmap, err := parseNmapResults(fmt.Sprintf("%s/nmap", opts.Output))
+	for _, phase := range phases {
+		phase.Finished = notifier.hostFinished
+	}
+	scanned, err := runPhases(ctx, phases, opts, limiter, journal)
 	if err != nil {
-		log.Printf("error parsing nmap files...")
-		return nil
+		return err
+	}
+	result.merge(scanned)
+	if err = writeIncomplete(opts.Output, result.Incomplete); err != nil {
+		return err
+	}
+	// a scan without targets left, e.g. when discovery found no open ports, wrote no XML and exports an empty inventory
+	nmapDir := filepath.Join(opts.Output, "nmap")
+	if err = os.MkdirAll(nmapDir, os.ModePerm); err != nil {
+		return err
+	}
+	parsedNmap, err := parseNmapResults(nmapDir)
+	if err != nil {
+		return fmt.Errorf("could not parse the nmap results: %w", err)
+	}
+	if opts.Verbose {
+		if _, err = pp.Println(parsedNmap); err != nil {
+			return err
+		}
+	}
+	doc = parsedNmap.Document
+	doc.Incomplete, doc.TimedOut = result.Incomplete, result.TimedOut
+	files, err := export.Write(opts.Output, doc, opts.OutputFormat)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Printf("Wrote %s\n", f)
 	}
-	if _, err = pp.Println(parsedNmap); err != nil {
+	run.FinishedAt = time.Now()
+	if err = saveRun(opts.database(), run, doc); err != nil {
 		return err
 	}
+	fmt.Printf("Saved run %d to %s\n", run.ID, opts.database())
+	if len(result.TimedOut) > 0 {
+		fmt.Printf("%d target(s) timed out: %s\n", len(result.TimedOut), strings.Join(result.TimedOut, ", "))
+	}
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("scan interrupted, the results of the finished scans were written: %w", ctx.Err())
+	case len(result.Failed) > 0:
+		err = fmt.Errorf("the scans of %d target(s) failed: %s", len(result.Failed), strings.Join(result.Failed, ", "))
+	}
+	return err
+}
 
+// checkPrivilege adapts the profile of every phase to privilege.
+// Without raw sockets UDP ports given as targets or with --ports cannot be scanned.
+func checkPrivilege(privilege Privilege, phases []*scanPhase) error {
+	for _, phase := range phases {
+		profile, err := phase.Profile.forPrivilege(privilege)
+		if err != nil {
+			return err
+		}
+		phase.Profile = profile
+		if privilege.Raw() {
+			continue
+		}
+		for target, ports := range phase.Targets {
+			if hasUDPPorts(ports) {
+				return fmt.Errorf("%s has UDP ports, UDP scans need root or nmap with the cap_net_raw and cap_net_admin capabilities", target)
+			}
+		}
+	}
+	return nil
+}
+
+// runPhases runs phases at the same time and sets the output of their unfinished, timed out and failed targets aside
+func runPhases(ctx context.Context, phases []*scanPhase, opts *Options, limiter *Limiter, journal *Journal) (*phaseResult, error) {
+	results := make([]*phaseResult, len(phases))
+	errs := make([]error, len(phases))
+	var wg sync.WaitGroup
+	for i, phase := range phases {
+		if !phase.Engine.Capabilities().Ranges {
+			if err := phase.expandRanges(); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Resume {
+			phase.Targets = journal.Pending(phase)
+		}
+		wg.Add(1)
+		go func(i int, phase *scanPhase) {
+			defer wg.Done()
+			results[i], errs[i] = runPhase(ctx, phase, opts, opts.newPool(phase.Name, limiter), journal)
+		}(i, phase)
+	}
+	wg.Wait()
+
+	result := &phaseResult{}
+	for i, phase := range phases {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if ctx.Err() != nil {
+			if err := markIncomplete(opts.Output, phase, results[i].Incomplete); err != nil {
+				return nil, err
+			}
+		}
+		if err := setAsideBrokenOutput(opts.Output, phase, append(results[i].TimedOut, results[i].Failed...)); err != nil {
+			return nil, err
+		}
+		result.merge(results[i])
+	}
+	return result, nil
+}
+
+// saveRun saves the results of a run into the results database at path.
+// The results of an interrupted scan are saved as well, so the save does not use the scan context.
+func saveRun(path string, run *store.Run, doc *export.Document) error {
+	db, err := store.Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err = db.SaveRun(context.Background(), run, doc); err != nil {
+		return fmt.Errorf("could not save the results to %s: %w", path, err)
+	}
 	return nil
 }
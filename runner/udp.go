@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultUDPProfile is the profile of the UDP phase unless --udp-profile selects another one
+const DefaultUDPProfile = "udp-top"
+
+// LoadUDPProfile returns the validated profile of the UDP phase.
+// topPorts above 0 replaces the ports of the profile with the topPorts most common UDP ports.
+func LoadUDPProfile(name string, topPorts int) (*Profile, error) {
+	profile, err := LoadProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if !profile.scansUDP() {
+		return nil, fmt.Errorf("profile %s cannot run the UDP phase, its scan_types do not include udp", profile.Name)
+	}
+	if topPorts > 0 {
+		profile.Ports, profile.TopPorts = "", topPorts
+	}
+	return profile, nil
+}
+
+// scansUDP reports whether the profile runs a UDP scan
+func (p *Profile) scansUDP() bool {
+	for _, scanType := range p.ScanTypes {
+		if strings.EqualFold(scanType, "udp") {
+			return true
+		}
+	}
+	return false
+}
+
+// udpPhase returns the UDP phase of engine against every target on the ports of the UDP profile.
+// It runs next to the TCP phase and its results are merged into the same hosts.
+func (opts *Options) udpPhase(engine ScanEngine, targets []string) *scanPhase {
+	profile := opts.UDPProfile
+	if profile == nil {
+		profile, _ = LoadUDPProfile(DefaultUDPProfile, 0)
+	}
+	phase := &scanPhase{Name: phaseUDP, Engine: engine, Profile: profile, Targets: make(map[string][]string, len(targets))}
+	for _, target := range targets {
+		phase.Targets[target] = nil
+	}
+	return phase
+}
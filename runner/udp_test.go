@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadUDPProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		topPorts int
+		want     string
+		wantErr  bool
+	}{
+		{"Default", DefaultUDPProfile, 0, "-vvv -Pn --top-ports 100 -T4 -sU -sV --script snmp-info,snmp-sysdescr,ike-version,ntp-info --version-intensity 0 --max-retries 2 --max-rtt-timeout 500ms", false},
+		{"Top Ports", DefaultUDPProfile, 20, "-vvv -Pn --top-ports 20 -T4 -sU -sV --script snmp-info,snmp-sysdescr,ike-version,ntp-info --version-intensity 0 --max-retries 2 --max-rtt-timeout 500ms", false},
+		{"TCP Profile", "quick", 0, "", true},
+		{"Unknown Profile", "nope", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := LoadUDPProfile(tt.profile, tt.topPorts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadUDPProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := strings.Join(profile.nmapArgs(nil), " "); got != tt.want {
+				t.Errorf("nmapArgs() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUDPPhase(t *testing.T) {
+	opts := &Options{}
+	phase := opts.udpPhase(&nmapStreamEngine{}, []string{"10.0.0.1", "scanme.nmap.org"})
+	if phase.Name != phaseUDP || phase.Profile.Name != DefaultUDPProfile {
+		t.Errorf("udpPhase() got phase %s with profile %s", phase.Name, phase.Profile.Name)
+	}
+	want := map[string][]string{"10.0.0.1": nil, "scanme.nmap.org": nil}
+	if !reflect.DeepEqual(phase.Targets, want) {
+		t.Errorf("udpPhase() targets got = %v, want %v", phase.Targets, want)
+	}
+	job := &ScanJob{Target: "scanme.nmap.org", OutputDir: "/tmp/out", OutputName: phase.outputName()}
+	if files := phase.Engine.OutputFiles(job); files[0] != "/tmp/out/nmap/scanme.nmap.org_udp_ports.xml" {
+		t.Errorf("OutputFiles() got = %v", files)
+	}
+}
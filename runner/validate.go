@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"github.com/mr-pmillz/goforit/target"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsafeFileNameRegex matches every character that should not end up in an output file name
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// isValidTarget reports whether target is a single IP, CIDR, IP range or DNS name that is safe to hand to nmap.
+func isValidTarget(host string) bool {
+	entry, err := target.ParseEntry(host)
+	return err == nil && len(entry.Ports) == 0
+}
+
+// isRangeTarget reports whether host is a CIDR or range of more than one address
+func isRangeTarget(host string) bool {
+	entry, err := target.ParseEntry(host)
+	return err == nil && entry.IsRange()
+}
+
+// expandTarget returns the addresses of the CIDR or range host that are not in exclude
+func expandTarget(host string, exclude []string) ([]string, error) {
+	scope := target.NewScope()
+	if err := scope.Add("exclude", exclude); err != nil {
+		return nil, err
+	}
+	set := target.NewSet(scope)
+	if err := set.Add("", []string{host}); err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(set.Targets()))
+	for _, t := range set.Targets() {
+		addrs = append(addrs, t.Host)
+	}
+	return addrs, nil
+}
+
+// sanitizeFileName turns a target into a file name that cannot escape its output directory.
+func sanitizeFileName(target string) string {
+	name := unsafeFileNameRegex.ReplaceAllString(target, "_")
+	for strings.Contains(name, "..") {
+		name = strings.ReplaceAll(name, "..", "_")
+	}
+	name = strings.Trim(filepath.Base(name), ".")
+	if name == "" {
+		return "target"
+	}
+	return name
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"testing"
+)
+
+func TestIsValidTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   bool
+	}{
+		{"IPv4", "10.0.0.1", true},
+		{"IPv6", "fe80::1", true},
+		{"CIDR", "10.0.0.0/24", true},
+		{"Octet Range", "10.0.0.5-40", true},
+		{"Octet List", "192.168.1,3.*", true},
+		{"Full Range", "10.0.0.1-10.0.0.20", true},
+		{"DNS Name", "scanme.nmap.org", true},
+		{"Shell Injection", "10.0.0.1;rm -rf ~", false},
+		{"Command Substitution", "$(id).example.com", false},
+		{"Flag Injection", "-iL/etc/shadow", false},
+		{"Octet Out Of Range", "10.0.0.5-300", false},
+		{"Path Traversal", "../../etc/passwd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isValidTarget(tt.target); got != tt.want {
+				t.Errorf("isValidTarget(%q) got = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"IP", "10.0.0.1", "10.0.0.1"},
+		{"CIDR", "10.0.0.0/24", "10.0.0.0_24"},
+		{"Traversal", "../../etc/cron.d/x", "____etc_cron.d_x"},
+		{"Dots Only", "..", "_"},
+		{"Hostname", "scanme.nmap.org", "scanme.nmap.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFileName(tt.target); got != tt.want {
+				t.Errorf("sanitizeFileName(%q) got = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/mr-pmillz/goforit/notify"
+	"github.com/mr-pmillz/goforit/runner"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusFinished  = "finished"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// eventStatus is the event sent whenever the status of a job changes, the other events are notify events
+const eventStatus = "status"
+
+// maxEvents is the number of events a job keeps, older events are dropped and not replayed to clients
+const maxEvents = 10000
+
+// ScanRequest is the body of a POST to /api/v1/scans
+type ScanRequest struct {
+	// Targets are IPs, CIDRs, ranges, hostnames or host:port targets
+	Targets []string `json:"targets"`
+	// Exclude are out of scope IPs, CIDRs, ranges or hostnames, they are excluded on top of the exclusions of the server
+	Exclude []string `json:"exclude,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	// Ports is a port specification such as 22,80,8000-8100 or top:100, see ports.Parse
+	Ports   string   `json:"ports,omitempty"`
+	Engines []string `json:"engines,omitempty"`
+	UDP     bool     `json:"udp,omitempty"`
+	// Output is the output directory relative to the output directory of the server, it defaults to the job ID
+	Output string `json:"output,omitempty"`
+}
+
+// Progress is how many targets of a scan phase are finished
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Event is a single server-sent event of a job
+type Event struct {
+	ID    int         `json:"id"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// Job is a scan submitted through the API
+type Job struct {
+	ID         string               `json:"id"`
+	Status     string               `json:"status"`
+	Request    ScanRequest          `json:"request"`
+	Output     string               `json:"output"`
+	Targets    int                  `json:"targets"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  *time.Time           `json:"started_at,omitempty"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+	Progress   map[string]*Progress `json:"progress"`
+	// Summary is the summary of a finished scan
+	Summary *notify.Summary `json:"summary,omitempty"`
+	Error   string          `json:"error,omitempty"`
+
+	opts   *runner.Options
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	events []Event
+	// lastEvent is the ID of the last event added, events holds the most recent of them
+	lastEvent int
+	// changed is closed and replaced whenever an event is added, see eventsSince
+	changed chan struct{}
+}
+
+func newJob(id string, request ScanRequest, opts *runner.Options) *Job {
+	job := &Job{
+		ID:        id,
+		Status:    StatusQueued,
+		Request:   request,
+		Output:    opts.Output,
+		CreatedAt: time.Now().UTC(),
+		Progress:  make(map[string]*Progress),
+		opts:      opts,
+		changed:   make(chan struct{}),
+	}
+	opts.OnEvent = job.onEvent
+	job.addEvent(eventStatus, job.snapshotLocked())
+	return job
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// run resolves the targets of the job and scans them, ctx cancels the scan
+func (j *Job) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	j.mu.Lock()
+	if j.Status != StatusQueued {
+		// cancelled while it was queued
+		j.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	j.Status, j.StartedAt, j.cancel = StatusRunning, &started, cancel
+	j.addEvent(eventStatus, j.snapshotLocked())
+	j.mu.Unlock()
+
+	err := j.scan(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	finished := time.Now().UTC()
+	j.FinishedAt = &finished
+	switch {
+	case j.Status == StatusCancelled:
+	case err != nil:
+		j.Status, j.Error = StatusFailed, err.Error()
+	default:
+		j.Status = StatusFinished
+	}
+	j.addEvent(eventStatus, j.snapshotLocked())
+	close(j.changed)
+	j.changed = nil
+}
+
+// scan resolves and expands the targets and runs the scan
+func (j *Job) scan(ctx context.Context) error {
+	hosts, err := runner.NewTargets(j.opts)
+	if err != nil {
+		return err
+	}
+	// resolving hostnames may take a while, a job cancelled meanwhile does not start scanning
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if len(hosts.Targets) == 0 {
+		return errors.New("no targets to scan")
+	}
+	j.mu.Lock()
+	j.Targets = len(hosts.Targets)
+	j.mu.Unlock()
+	if err = os.MkdirAll(j.opts.Output, 0750); err != nil {
+		return err
+	}
+	return hosts.Scanner(ctx, j.opts)
+}
+
+// Cancel stops the job, a running scan still exports the results of the finished targets.
+// It reports false when the job already ended.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.Status {
+	case StatusQueued:
+		now := time.Now().UTC()
+		j.Status, j.FinishedAt = StatusCancelled, &now
+		j.addEvent(eventStatus, j.snapshotLocked())
+		close(j.changed)
+		j.changed = nil
+		return true
+	case StatusRunning:
+		j.Status = StatusCancelled
+		j.cancel()
+		return true
+	}
+	return false
+}
+
+// onEvent records a notification of the scan as an event and updates the progress
+func (j *Job) onEvent(msg *notify.Message) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch msg.Event {
+	case notify.EventHostDone:
+		j.Progress[msg.Phase] = &Progress{Done: msg.Done, Total: msg.Total}
+	case notify.EventSummary:
+		j.Summary = msg.Summary
+	}
+	j.addEvent(string(msg.Event), msg)
+}
+
+// addEvent appends an event and wakes up every reader waiting for it, j.mu has to be held
+func (j *Job) addEvent(event string, data interface{}) {
+	if j.changed == nil {
+		return
+	}
+	j.lastEvent++
+	j.events = append(j.events, Event{ID: j.lastEvent, Event: event, Data: data})
+	if len(j.events) > maxEvents {
+		j.events = j.events[1:]
+	}
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// eventsSince returns the events after the event with ID last and a channel closed when the next event is added.
+// Events that were dropped already are skipped. The channel is nil once the job ended and no more events follow.
+func (j *Job) eventsSince(last int) ([]Event, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if last < 0 || last > j.lastEvent {
+		last = 0
+	}
+	// the events before the first kept event were dropped
+	skip := 0
+	if len(j.events) > 0 && last >= j.events[0].ID {
+		skip = last - j.events[0].ID + 1
+	}
+	events := make([]Event, len(j.events)-skip)
+	copy(events, j.events[skip:])
+	if j.changed == nil {
+		return events, nil
+	}
+	return events, j.changed
+}
+
+// ended reports whether the job will not change anymore
+func (j *Job) ended() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.changed == nil
+}
+
+// endedBefore reports whether the job ended before t
+func (j *Job) endedBefore(t time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.changed == nil && j.FinishedAt != nil && j.FinishedAt.Before(t)
+}
+
+// Snapshot returns a copy of the job that is safe to encode while the scan runs
+func (j *Job) Snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snapshotLocked()
+}
+
+func (j *Job) snapshotLocked() *Job {
+	progress := make(map[string]*Progress, len(j.Progress))
+	for phase, p := range j.Progress {
+		progress[phase] = &Progress{Done: p.Done, Total: p.Total}
+	}
+	return &Job{
+		ID:         j.ID,
+		Status:     j.Status,
+		Request:    j.Request,
+		Output:     j.Output,
+		Targets:    j.Targets,
+		CreatedAt:  j.CreatedAt,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		Progress:   progress,
+		Summary:    j.Summary,
+		Error:      j.Error,
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/runner"
+	"github.com/mr-pmillz/goforit/utils"
+	"github.com/spf13/cobra"
+	"log"
+	"net"
+)
+
+// Options are the options of the serve command
+type Options struct {
+	// Scan are the scan options every submitted scan starts from, scans are written below Scan.Output
+	Scan runner.Options
+	// Listen is the address the API listens on
+	Listen string
+	// Token is the bearer token every request has to carry
+	Token string
+	// MaxJobs is the number of scans running at the same time, further scans are queued
+	MaxJobs int
+}
+
+// ConfigureCommand ...
+func ConfigureCommand(cmd *cobra.Command) error {
+	if err := runner.ConfigureCommand(cmd); err != nil {
+		return err
+	}
+	cmd.PersistentFlags().StringP("listen", "", "127.0.0.1:8642", "address the API listens on")
+	cmd.PersistentFlags().StringP("api-token", "", "", "bearer token every API request has to carry, a random token is generated and printed when empty")
+	cmd.PersistentFlags().IntP("max-jobs", "", 1, "number of submitted scans running at the same time, further scans are queued")
+	return nil
+}
+
+// LoadFromCommand ...
+func (opts *Options) LoadFromCommand(cmd *cobra.Command) error {
+	if err := opts.Scan.LoadFromCommand(cmd); err != nil {
+		return err
+	}
+	if opts.Scan.Output == "" {
+		return errors.New("OUTPUT config.yaml value cannot be empty, scans are written below it")
+	}
+
+	listen, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag:           "listen",
+		DefaultFlagVal: "127.0.0.1:8642",
+		Opts:           opts.Listen,
+	})
+	if err != nil {
+		return err
+	}
+	opts.Listen = listen.(string)
+	if _, _, err = net.SplitHostPort(opts.Listen); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", opts.Listen, err)
+	}
+
+	token, err := utils.ConfigureFlagOpts(cmd, &utils.LoadFromCommandOpts{
+		Flag: "api-token",
+		Opts: opts.Token,
+	})
+	if err != nil {
+		return err
+	}
+	opts.Token = token.(string)
+	if opts.Token == "" {
+		if opts.Token, err = newToken(); err != nil {
+			return err
+		}
+		log.Printf("Generated the API token %s, pass it as Authorization: Bearer <token>\n", opts.Token)
+	}
+
+	maxJobs, err := utils.ConfigureIntFlagOpts(cmd, &utils.LoadFromCommandOpts{Flag: "max-jobs"})
+	if err != nil {
+		return err
+	}
+	if maxJobs < 1 {
+		return fmt.Errorf("max-jobs must be at least 1, got %d", maxJobs)
+	}
+	opts.MaxJobs = maxJobs
+
+	return nil
+}
+
+// newToken returns a random API token
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
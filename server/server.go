@@ -0,0 +1,432 @@
+/*
+Package server
+
+Copyright © 2023 MrPMillz
+*/
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mr-pmillz/goforit/ports"
+	"github.com/mr-pmillz/goforit/runner"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// apiPrefix is the path every endpoint is served below
+	apiPrefix = "/api/v1/scans"
+	// keepAlive is how often an idle event stream gets a comment so that proxies keep it open
+	keepAlive = 15 * time.Second
+	// maxRequestSize limits the body of a scan request
+	maxRequestSize = 1 << 20
+	// maxQueued is the number of scans waiting for a worker before new scans are refused
+	maxQueued = 256
+	// maxTargets is the number of unique targets a scan request may expand to
+	maxTargets = 1 << 16
+	// maxEnded is the number of scans that ended the server keeps, older ones are forgotten first
+	maxEnded = 1000
+	// endedTTL is how long the server keeps a scan that ended, its output directory is left in place
+	endedTTL = 24 * time.Hour
+)
+
+// Server runs the scans submitted through the REST API, at most MaxJobs at the same time
+type Server struct {
+	opts  *Options
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []*Job
+	queue chan *Job
+	// closed is set once the server shuts down and queue is closed
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New returns a server for opts, Run starts it
+func New(opts *Options) *Server {
+	return &Server{opts: opts, jobs: make(map[string]*Job), queue: make(chan *Job, maxQueued)}
+}
+
+// Run serves the API on opts.Listen until ctx is cancelled. Running scans are then cancelled and the results of
+// their finished targets are exported before Run returns.
+func Run(ctx context.Context, opts *Options) error {
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return err
+	}
+	return New(opts).Serve(ctx, listener)
+}
+
+// Serve serves the API on listener until ctx is cancelled
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	for i := 0; i < s.opts.MaxJobs; i++ {
+		s.wg.Add(1)
+		go s.worker(jobCtx)
+	}
+
+	httpServer := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+	log.Printf("Serving the goforit API on http://%s%s\n", listener.Addr(), apiPrefix)
+
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+		log.Printf("Shutting down, cancelling running scans\n")
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	// running scans export the results of their finished targets, the workers cancel the queued scans
+	cancelJobs()
+	s.wg.Wait()
+	if serveErr != nil {
+		return serveErr
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) worker(ctx context.Context) {
+	defer s.wg.Done()
+	for job := range s.queue {
+		if ctx.Err() != nil {
+			job.Cancel()
+			continue
+		}
+		job.run(ctx)
+	}
+}
+
+// Handler returns the handler of the API, every request has to carry the token as bearer token
+func (s *Server) Handler() http.Handler {
+	return s.authenticate(http.HandlerFunc(s.route))
+}
+
+// authenticate rejects requests without the bearer token of the server
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goforit"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// route dispatches /api/v1/scans, /api/v1/scans/{id}, /api/v1/scans/{id}/events and /api/v1/scans/{id}/results
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.listJobs(w)
+		case http.MethodPost:
+			s.createJob(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, resource, _ := strings.Cut(path, "/")
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan %q", id))
+		return
+	}
+	switch resource {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, job.Snapshot())
+		case http.MethodDelete:
+			if !job.Cancel() {
+				writeError(w, http.StatusConflict, fmt.Errorf("scan %s already ended", id))
+				return
+			}
+			writeJSON(w, http.StatusAccepted, job.Snapshot())
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case "events":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		streamEvents(w, r, job)
+	case "results":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.results(w, job)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) listJobs(w http.ResponseWriter) {
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.order))
+	for _, job := range s.order {
+		jobs = append(jobs, job.Snapshot())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// createJob validates a scan request and queues it
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	request := ScanRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid scan request: %w", err))
+		return
+	}
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	opts, err := s.scanOptions(id, &request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// the targets are resolved and expanded by the worker running the job, a request that fails there fails the job
+	job := newJob(id, request, opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		writeError(w, http.StatusServiceUnavailable, errors.New("the server is shutting down"))
+		return
+	}
+	s.pruneLocked(time.Now().UTC())
+	for _, other := range s.order {
+		if other.Output == job.Output && !other.ended() {
+			writeError(w, http.StatusConflict, fmt.Errorf("scan %s is already writing to %s", other.ID, job.Output))
+			return
+		}
+	}
+	select {
+	case s.queue <- job:
+	default:
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("%d scans are queued already, try again later", len(s.queue)))
+		return
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", apiPrefix, job.ID))
+	writeJSON(w, http.StatusCreated, job.Snapshot())
+}
+
+// pruneLocked forgets the scans that ended before the endedTTL and the oldest ended scans beyond maxEnded, s.mu has to be held
+func (s *Server) pruneLocked(now time.Time) {
+	ended := 0
+	for _, job := range s.order {
+		if job.ended() {
+			ended++
+		}
+	}
+	kept := s.order[:0]
+	for _, job := range s.order {
+		switch {
+		case job.endedBefore(now.Add(-endedTTL)):
+			ended--
+		case ended > maxEnded && job.ended():
+			ended--
+		default:
+			kept = append(kept, job)
+			continue
+		}
+		delete(s.jobs, job.ID)
+	}
+	for i := len(kept); i < len(s.order); i++ {
+		s.order[i] = nil
+	}
+	s.order = kept
+}
+
+// scanOptions derives the options of the scan request of job id from the options of the server
+func (s *Server) scanOptions(id string, request *ScanRequest) (*runner.Options, error) {
+	if len(request.Targets) == 0 {
+		return nil, errors.New("targets is required")
+	}
+	opts := s.opts.Scan
+	// targets and exclusions are always passed as lists, API clients cannot make the server read files
+	opts.Target = request.Targets
+	opts.Exclude = appendExclude(opts.Exclude, request.Exclude)
+	var err error
+	if request.Profile != "" {
+		if opts.Profile, err = runner.LoadProfile(request.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if request.Ports != "" {
+		if opts.Ports, err = ports.Parse(request.Ports); err != nil {
+			return nil, err
+		}
+	}
+	if len(request.Engines) > 0 {
+		opts.Engines = request.Engines
+		if err = runner.ValidateEngines(opts.Engines); err != nil {
+			return nil, err
+		}
+	}
+	if request.UDP && !opts.UDP {
+		opts.UDP = true
+		if opts.UDPProfile, err = runner.LoadUDPProfile(runner.DefaultUDPProfile, 0); err != nil {
+			return nil, err
+		}
+	}
+	name := request.Output
+	if name == "" {
+		name = id
+	}
+	if opts.Output, err = outputDir(s.opts.Scan.Output, name); err != nil {
+		return nil, err
+	}
+	// results are saved into the results database of the output directory of the scan
+	opts.Database = ""
+	opts.Resume = false
+	opts.MaxTargets = maxTargets
+	return &opts, nil
+}
+
+// appendExclude returns the exclusions of the server, a single entry or a list, followed by the exclusions of a scan request.
+// A request can only narrow the scope of the server, never drop its exclusions.
+func appendExclude(exclude interface{}, extra []string) []string {
+	var list []string
+	switch exclude := exclude.(type) {
+	case string:
+		if exclude != "" {
+			list = append(list, exclude)
+		}
+	case []string:
+		list = append(list, exclude...)
+	}
+	return append(list, extra...)
+}
+
+// outputDir returns the output directory name below root, names leaving root are rejected
+func outputDir(root, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("output %q has to be relative to the output directory of the server", name)
+	}
+	dir := filepath.Join(root, name)
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output %q is not below the output directory of the server", name)
+	}
+	return dir, nil
+}
+
+// results writes the exported results of a job that ended
+func (s *Server) results(w http.ResponseWriter, job *Job) {
+	if !job.ended() {
+		writeError(w, http.StatusConflict, fmt.Errorf("scan %s has not ended yet, follow its events", job.ID))
+		return
+	}
+	results, err := runner.LoadResults(job.Output)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scan %s has no results: %w", job.ID, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, results.Document)
+}
+
+// streamEvents streams the events of job as server-sent events until the job ended or the client went away.
+// A reconnecting client continues after its Last-Event-ID.
+func streamEvents(w http.ResponseWriter, r *http.Request, job *Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	last, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		events, changed := job.eventsSince(last)
+		for _, event := range events {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				log.Printf("could not encode event %d of scan %s: %v\n", event.ID, job.ID, err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, data); err != nil {
+				return
+			}
+			last = event.ID
+		}
+		flusher.Flush()
+		if changed == nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-changed:
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("could not write response: %v\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
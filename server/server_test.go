@@ -0,0 +1,425 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/runner"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+// newTestServer serves a server scanning with the connect engine and returns its URL and a func stopping it
+func newTestServer(t *testing.T) (string, func()) {
+	t.Helper()
+	profile, err := runner.LoadProfile(runner.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(&Options{
+		Scan: runner.Options{
+			Output:             t.TempDir(),
+			OutputFormat:       []string{"json"},
+			Threads:            2,
+			MaxParallelHosts:   2,
+			MaxAttempts:        1,
+			Profile:            profile,
+			Engines:            []string{"connect"},
+			ConnectConcurrency: 4,
+			ConnectTimeout:     time.Second,
+		},
+		Token:   testToken,
+		MaxJobs: 1,
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, listener)
+	}()
+	return "http://" + listener.Addr().String(), func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	}
+}
+
+func request(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCreateJobErrors(t *testing.T) {
+	baseURL, stop := newTestServer(t)
+	defer stop()
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"No Token", "", `{"targets": ["127.0.0.1"]}`, http.StatusUnauthorized},
+		{"Wrong Token", "nope", `{"targets": ["127.0.0.1"]}`, http.StatusUnauthorized},
+		{"No Targets", testToken, `{"profile": "quick"}`, http.StatusBadRequest},
+		{"Unknown Field", testToken, `{"targets": ["127.0.0.1"], "target": "127.0.0.1"}`, http.StatusBadRequest},
+		{"Unknown Profile", testToken, `{"targets": ["127.0.0.1"], "profile": "nope"}`, http.StatusBadRequest},
+		{"Unknown Engine", testToken, `{"targets": ["127.0.0.1"], "engines": ["nope"]}`, http.StatusBadRequest},
+		{"Bad Ports", testToken, `{"targets": ["127.0.0.1"], "ports": "99999"}`, http.StatusBadRequest},
+		{"Absolute Output", testToken, `{"targets": ["127.0.0.1"], "output": "/etc"}`, http.StatusBadRequest},
+		{"Output Outside", testToken, `{"targets": ["127.0.0.1"], "output": "../elsewhere"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := request(t, http.MethodPost, baseURL+apiPrefix, tt.token, tt.body)
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("POST %s got status %d, want %d", apiPrefix, resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	resp := request(t, http.MethodGet, baseURL+apiPrefix+"/nope", testToken, "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of an unknown scan got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+// submit posts a scan request that has to be accepted and returns its job
+func submit(t *testing.T, baseURL, body string) *Job {
+	t.Helper()
+	resp := request(t, http.MethodPost, baseURL+apiPrefix, testToken, body)
+	defer resp.Body.Close()
+	job := &Job{}
+	if err := json.NewDecoder(resp.Body).Decode(job); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s got status %d, error %v", apiPrefix, resp.StatusCode, err)
+	}
+	return job
+}
+
+// waitJob polls the job with id until it ended
+func waitJob(t *testing.T, baseURL, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		resp := request(t, http.MethodGet, baseURL+apiPrefix+"/"+id, testToken, "")
+		job := &Job{}
+		err := json.NewDecoder(resp.Body).Decode(job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("GET scan %s error = %v", id, err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan %s did not end, last status %s", id, job.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// followEvents counts the events of the job with id until it ended and returns the count of every event and the last status
+func followEvents(t *testing.T, baseURL, id string) (map[string]int, *Job) {
+	t.Helper()
+	resp := request(t, http.MethodGet, baseURL+apiPrefix+"/"+id+"/events", testToken, "")
+	defer resp.Body.Close()
+	events := map[string]int{}
+	last := &Job{}
+	scanner := bufio.NewScanner(resp.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+			events[event]++
+		case strings.HasPrefix(line, "data: ") && event == eventStatus:
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), last); err != nil {
+				t.Fatalf("could not decode status event %s: %v", line, err)
+			}
+		}
+	}
+	return events, last
+}
+
+func TestJobTargetErrors(t *testing.T) {
+	baseURL, stop := newTestServer(t)
+	defer stop()
+
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"Everything Excluded", `{"targets": ["127.0.0.1"], "exclude": ["127.0.0.1"]}`, "every target is excluded"},
+		{"Too Many Targets", `{"targets": ["10.0.0.0/15"], "output": "too-many"}`, "more than 65536 unique targets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the targets are resolved by the worker, the request is accepted and the job fails
+			job := waitJob(t, baseURL, submit(t, baseURL, tt.body).ID)
+			if job.Status != StatusFailed || !strings.Contains(job.Error, tt.wantError) {
+				t.Errorf("scan got status %s, error %q, want %s with %q", job.Status, job.Error, StatusFailed, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestScanJob(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	baseURL, stop := newTestServer(t)
+	defer stop()
+
+	resp := request(t, http.MethodPost, baseURL+apiPrefix, testToken, `{"targets": ["127.0.0.1"], "ports": "`+strconv.Itoa(port)+`", "output": "local"}`)
+	job := &Job{}
+	err = json.NewDecoder(resp.Body).Decode(job)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s got status %d, error %v", apiPrefix, resp.StatusCode, err)
+	}
+	if resp.Header.Get("Location") != apiPrefix+"/"+job.ID || !strings.HasSuffix(job.Output, "local") {
+		t.Fatalf("POST %s got job %+v, location %s", apiPrefix, job, resp.Header.Get("Location"))
+	}
+
+	events, last := followEvents(t, baseURL, job.ID)
+	if last.Status != StatusFinished {
+		t.Fatalf("last status event got status %s, error %s, want %s", last.Status, last.Error, StatusFinished)
+	}
+	if events[eventStatus] != 3 || events["scan_start"] != 1 || events["host_done"] != 1 || events["summary"] != 1 {
+		t.Errorf("events got = %v", events)
+	}
+
+	resp = request(t, http.MethodGet, baseURL+apiPrefix+"/"+job.ID, testToken, "")
+	err = json.NewDecoder(resp.Body).Decode(job)
+	resp.Body.Close()
+	if err != nil || job.Status != StatusFinished || job.Targets != 1 || job.Summary == nil || job.Summary.OpenPorts != 1 {
+		t.Fatalf("GET scan got %+v, error %v", job, err)
+	}
+	if progress := job.Progress["nmap"]; progress == nil || progress.Done != 1 || progress.Total != 1 {
+		t.Errorf("GET scan progress got = %v", job.Progress)
+	}
+
+	resp = request(t, http.MethodGet, baseURL+apiPrefix+"/"+job.ID+"/results", testToken, "")
+	doc := export.Document{}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET results got status %d, error %v", resp.StatusCode, err)
+	}
+	if services := doc.OpenServices(); len(services) != 1 || services[0].Port != port {
+		t.Errorf("GET results got services %+v, want port %d", services, port)
+	}
+
+	resp = request(t, http.MethodDelete, baseURL+apiPrefix+"/"+job.ID, testToken, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("DELETE of a finished scan got status %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+
+	resp = request(t, http.MethodGet, baseURL+apiPrefix, testToken, "")
+	jobs := []*Job{}
+	err = json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if err != nil || len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("GET %s got %+v, error %v", apiPrefix, jobs, err)
+	}
+}
+
+func TestScanJobNoOpenPorts(t *testing.T) {
+	// a port that was just closed refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	baseURL, stop := newTestServer(t)
+	defer stop()
+
+	tests := []struct {
+		name    string
+		engines string
+	}{
+		// the connect scan writes an XML file without open ports
+		{"Closed Port", `["connect"]`},
+		// discovery finds no open ports, the last engine has nothing to scan and writes no XML
+		{"Nothing Discovered", `["connect", "connect"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := submit(t, baseURL, `{"targets": ["127.0.0.1"], "ports": "`+port+`", "engines": `+tt.engines+`}`)
+			events, last := followEvents(t, baseURL, job.ID)
+			if last.Status != StatusFinished {
+				t.Fatalf("last status event got status %s, error %s, want %s", last.Status, last.Error, StatusFinished)
+			}
+			if events["summary"] != 1 {
+				t.Errorf("events got = %v, want a summary", events)
+			}
+			if last.Summary == nil || last.Summary.OpenPorts != 0 {
+				t.Errorf("last status event got summary %+v, want no open ports", last.Summary)
+			}
+
+			resp := request(t, http.MethodGet, baseURL+apiPrefix+"/"+job.ID+"/results", testToken, "")
+			doc := export.Document{}
+			err := json.NewDecoder(resp.Body).Decode(&doc)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK || len(doc.OpenServices()) != 0 {
+				t.Errorf("GET results got status %d, services %+v, error %v", resp.StatusCode, doc.OpenServices(), err)
+			}
+		})
+	}
+}
+
+func TestScanOptionsExclude(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverExclude interface{}
+		exclude       []string
+		want          []string
+	}{
+		{"Server Only", "127.0.0.2", nil, []string{"127.0.0.1", "127.0.0.3"}},
+		{"Request Adds", "127.0.0.2", []string{"127.0.0.3"}, []string{"127.0.0.1"}},
+		{"Server List", []string{"127.0.0.2", "127.0.0.3"}, []string{"127.0.0.1"}, nil},
+		{"No Server Exclusions", nil, []string{"127.0.0.1"}, []string{"127.0.0.2", "127.0.0.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&Options{Scan: runner.Options{Output: t.TempDir(), Exclude: tt.serverExclude}})
+			opts, err := s.scanOptions("job", &ScanRequest{Targets: []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}, Exclude: tt.exclude})
+			if err != nil {
+				t.Fatalf("scanOptions() error = %v", err)
+			}
+			hosts, err := runner.NewTargets(opts)
+			if (err != nil) != (tt.want == nil) {
+				t.Fatalf("NewTargets() error = %v, want targets %v", err, tt.want)
+			}
+			if hosts != nil && !reflect.DeepEqual(hosts.Targets, tt.want) {
+				t.Errorf("NewTargets() got targets %v, want %v", hosts.Targets, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobEventsCapped(t *testing.T) {
+	job := newJob("capped", ScanRequest{}, &runner.Options{})
+	job.mu.Lock()
+	// newJob added the queued status event
+	for i := 1; i < maxEvents+10; i++ {
+		job.addEvent("host_done", i)
+	}
+	job.mu.Unlock()
+
+	tests := []struct {
+		name      string
+		last      int
+		wantFirst int
+		wantLen   int
+	}{
+		{"From Start", 0, 11, maxEvents},
+		{"Dropped", 5, 11, maxEvents},
+		{"Kept", 20, 21, maxEvents - 10},
+		{"Up To Date", maxEvents + 10, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, _ := job.eventsSince(tt.last)
+			if len(events) != tt.wantLen || (len(events) > 0 && events[0].ID != tt.wantFirst) {
+				t.Errorf("eventsSince(%d) got %d events, want %d from ID %d", tt.last, len(events), tt.wantLen, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := New(&Options{})
+	now := time.Now().UTC()
+	add := func(id string, end bool) *Job {
+		job := newJob(id, ScanRequest{}, &runner.Options{Output: id})
+		if end {
+			job.Cancel()
+		}
+		s.jobs[id] = job
+		s.order = append(s.order, job)
+		return job
+	}
+	expired := add("expired", true)
+	old := now.Add(-endedTTL - time.Minute)
+	expired.FinishedAt = &old
+	add("queued", false)
+	for i := 0; i < maxEnded+2; i++ {
+		add(strconv.Itoa(i), true)
+	}
+
+	s.pruneLocked(now)
+	if len(s.jobs) != maxEnded+1 || len(s.order) != maxEnded+1 {
+		t.Fatalf("pruneLocked() kept %d jobs, %d in order, want %d", len(s.jobs), len(s.order), maxEnded+1)
+	}
+	for _, id := range []string{"expired", "0", "1"} {
+		if _, ok := s.jobs[id]; ok {
+			t.Errorf("pruneLocked() kept job %s", id)
+		}
+	}
+	if s.order[0].ID != "queued" || s.order[1].ID != "2" {
+		t.Errorf("pruneLocked() got order starting with %s, %s, want queued, 2", s.order[0].ID, s.order[1].ID)
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{"Name", "dmz", "/scans/dmz", false},
+		{"Nested", "client/dmz", "/scans/client/dmz", false},
+		{"Cleaned", "client/../dmz", "/scans/dmz", false},
+		{"Root", ".", "", true},
+		{"Parent", "..", "", true},
+		{"Escape", "../../etc", "", true},
+		{"Absolute", "/etc", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputDir("/scans", tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("outputDir() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
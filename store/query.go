@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Table is the result of a query, every value is formatted as a string
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Runs lists every run with its number of up hosts and open services
+func (s *Store) Runs(ctx context.Context) (*Table, error) {
+	return s.Query(ctx, `SELECT r.id, r.started_at, r.finished_at, r.profile, r.engines, r.targets,
+			(SELECT count(*) FROM hosts h WHERE h.run_id = r.id) AS hosts,
+			(SELECT count(*) FROM services s JOIN hosts h ON h.id = s.host_id WHERE h.run_id = r.id AND s.state = 'open') AS open_ports
+		FROM runs r
+		ORDER BY r.id`)
+}
+
+// LatestRun returns the ID of the last run saved
+func (s *Store) LatestRun(ctx context.Context) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM runs ORDER BY id DESC LIMIT 1`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.New("no runs saved yet")
+	}
+	return id, err
+}
+
+// OpenPort lists the hosts of run with port open, e.g. all hosts with 445/tcp open
+func (s *Store) OpenPort(ctx context.Context, run int64, port int, protocol string) (*Table, error) {
+	return s.Query(ctx, `SELECT h.address,
+			coalesce((SELECT group_concat(n.name, ',') FROM hostnames n WHERE n.host_id = h.id), '') AS hostnames,
+			s.port, s.protocol, s.service, s.product, s.version
+		FROM services s JOIN hosts h ON h.id = s.host_id
+		WHERE h.run_id = ? AND s.port = ? AND s.protocol = ? AND s.state = 'open'
+		ORDER BY h.address`, run, port, protocol)
+}
+
+// Products lists every distinct product and version of the open services of run named service, and how many hosts run it.
+// Service names are matched by prefix, so http also matches https and http-proxy.
+func (s *Store) Products(ctx context.Context, run int64, service string) (*Table, error) {
+	return s.Query(ctx, `SELECT s.product, s.version, count(DISTINCT h.address) AS hosts, group_concat(DISTINCT s.port) AS ports
+		FROM services s JOIN hosts h ON h.id = s.host_id
+		WHERE h.run_id = ? AND s.state = 'open' AND s.service LIKE ? ESCAPE '\' AND s.product != ''
+		GROUP BY s.product, s.version
+		ORDER BY hosts DESC, s.product, s.version`, run, escapeLike(service)+"%")
+}
+
+// HostsNotIn lists the hosts of run that run other did not find, with their open ports
+func (s *Store) HostsNotIn(ctx context.Context, run, other int64) (*Table, error) {
+	return s.Query(ctx, `SELECT h.address,
+			coalesce((SELECT group_concat(n.name, ',') FROM hostnames n WHERE n.host_id = h.id), '') AS hostnames,
+			coalesce((SELECT group_concat(s.port || '/' || s.protocol, ',') FROM services s WHERE s.host_id = h.id AND s.state = 'open'), '') AS open_ports
+		FROM hosts h
+		WHERE h.run_id = ? AND h.address NOT IN (SELECT address FROM hosts WHERE run_id = ?)
+		ORDER BY h.address`, run, other)
+}
+
+// OpenServices returns the keys of the open services of run as host:port/protocol, see export.Service.Key
+func (s *Store) OpenServices(ctx context.Context, run int64) (map[string]bool, error) {
+	table, err := s.Query(ctx, `SELECT h.address || ':' || s.port || '/' || s.protocol
+		FROM services s JOIN hosts h ON h.id = s.host_id
+		WHERE h.run_id = ? AND s.state = 'open'`, run)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(table.Rows))
+	for _, row := range table.Rows {
+		keys[row[0]] = true
+	}
+	return keys, nil
+}
+
+// Query runs an SQL query against the database and returns every row
+func (s *Store) Query(ctx context.Context, query string, args ...interface{}) (*Table, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	table := &Table{Columns: columns}
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	for rows.Next() {
+		if err = rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = formatValue(*(v.(*interface{})))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, rows.Err()
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeLike escapes the LIKE wildcards of value
+func escapeLike(value string) string {
+	escaped := make([]rune, 0, len(value))
+	for _, r := range value {
+		if r == '%' || r == '_' || r == '\\' {
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(escaped)
+}
@@ -0,0 +1,311 @@
+/*
+Package store
+
+Copyright © 2023 MrPMillz
+*/
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mr-pmillz/goforit/export"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// pure Go SQLite driver, goforit builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// FileName is the name of the results database in a scan output directory
+const FileName = "results.db"
+
+// migrations create and upgrade the schema, the schema version of a database is the number of migrations applied to it.
+// Released migrations are never changed, schema changes are appended as a new migration.
+var migrations = []string{
+	`CREATE TABLE runs (
+		id          INTEGER PRIMARY KEY,
+		started_at  TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		profile     TEXT NOT NULL,
+		engines     TEXT NOT NULL,
+		targets     INTEGER NOT NULL,
+		incomplete  TEXT NOT NULL,
+		timed_out   TEXT NOT NULL
+	);
+	CREATE TABLE hosts (
+		id           INTEGER PRIMARY KEY,
+		run_id       INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+		address      TEXT NOT NULL,
+		address_type TEXT NOT NULL,
+		mac          TEXT NOT NULL,
+		vendor       TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		os           TEXT NOT NULL,
+		os_accuracy  INTEGER NOT NULL,
+		UNIQUE (run_id, address)
+	);
+	CREATE INDEX hosts_address ON hosts (address);
+	CREATE TABLE hostnames (
+		host_id INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+		name    TEXT NOT NULL,
+		PRIMARY KEY (host_id, name)
+	);
+	CREATE TABLE os_matches (
+		host_id  INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+		name     TEXT NOT NULL,
+		accuracy INTEGER NOT NULL,
+		PRIMARY KEY (host_id, name)
+	);
+	CREATE TABLE services (
+		id         INTEGER PRIMARY KEY,
+		host_id    INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+		port       INTEGER NOT NULL,
+		protocol   TEXT NOT NULL,
+		state      TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		service    TEXT NOT NULL,
+		product    TEXT NOT NULL,
+		version    TEXT NOT NULL,
+		extra_info TEXT NOT NULL,
+		tunnel     TEXT NOT NULL,
+		cpes       TEXT NOT NULL,
+		UNIQUE (host_id, port, protocol)
+	);
+	CREATE INDEX services_port ON services (port, protocol, state);
+	CREATE INDEX services_service ON services (service, product);
+	CREATE TABLE scripts (
+		id         INTEGER PRIMARY KEY,
+		host_id    INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+		service_id INTEGER REFERENCES services (id) ON DELETE CASCADE,
+		script     TEXT NOT NULL,
+		output     TEXT NOT NULL,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX scripts_script ON scripts (script);`,
+}
+
+// SchemaVersion is the schema version of databases written by this version of goforit
+var SchemaVersion = len(migrations)
+
+// Store is a SQLite database of scan results, every scan is stored as a run
+type Store struct {
+	db *sql.DB
+}
+
+// Run describes a single scan whose results are saved
+type Run struct {
+	// ID identifies the run, it is set by SaveRun
+	ID         int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Profile    string
+	Engines    []string
+	// Targets is the number of targets scanned
+	Targets int
+}
+
+// Path returns the path of the results database of the scan output directory dir, paths ending in .db are returned as is
+func Path(dir string) string {
+	if strings.HasSuffix(dir, ".db") {
+		return dir
+	}
+	return filepath.Join(dir, FileName)
+}
+
+// Open opens the results database at path, creating it and upgrading its schema when needed
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", dsn(path, false))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err = s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not migrate %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// OpenReadOnly opens an existing results database at path for queries only
+func OpenReadOnly(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", dsn(path, true))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	version, err := s.version()
+	switch {
+	case err != nil:
+		_ = db.Close()
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	case version == 0:
+		_ = db.Close()
+		return nil, fmt.Errorf("%s is not a goforit results database", path)
+	case version > SchemaVersion:
+		_ = db.Close()
+		return nil, fmt.Errorf("%s has schema version %d, this goforit only knows version %d", path, version, SchemaVersion)
+	}
+	return s, nil
+}
+
+// dsn returns the data source name of the database at path, foreign keys are enforced on every connection
+func dsn(path string, readOnly bool) string {
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	if readOnly {
+		query.Add("mode", "ro")
+		query.Add("_pragma", "query_only(1)")
+	}
+	return (&url.URL{Scheme: "file", Opaque: path, RawQuery: query.Encode()}).String()
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) version() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies every migration the database is missing in a single transaction
+func (s *Store) migrate() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("schema version %d is newer than version %d of this goforit", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, migration := range migrations[version:] {
+		if _, err = tx.Exec(migration); err != nil {
+			return err
+		}
+	}
+	// PRAGMA does not take bind parameters
+	if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveRun saves run and the hosts of doc in a single transaction and sets run.ID
+func (s *Store) SaveRun(ctx context.Context, run *Run, doc *export.Document) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO runs (started_at, finished_at, profile, engines, targets, incomplete, timed_out)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		formatTime(run.StartedAt), formatTime(run.FinishedAt), run.Profile, strings.Join(run.Engines, ","), run.Targets,
+		strings.Join(doc.Incomplete, ","), strings.Join(doc.TimedOut, ","))
+	if err != nil {
+		return err
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i := range doc.Hosts {
+		if err = saveHost(ctx, tx, runID, &doc.Hosts[i]); err != nil {
+			return fmt.Errorf("could not save %s: %w", doc.Hosts[i].Address, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	run.ID = runID
+	return nil
+}
+
+// saveHost saves a host with its hostnames, OS matches, services and scripts
+func saveHost(ctx context.Context, tx *sql.Tx, runID int64, host *export.Host) error {
+	result, err := tx.ExecContext(ctx, `INSERT INTO hosts (run_id, address, address_type, mac, vendor, status, os, os_accuracy)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, host.Address, host.AddressType, host.MAC, host.Vendor, host.Status, host.OS, host.OSAccuracy)
+	if err != nil {
+		return err
+	}
+	hostID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, hostname := range host.Hostnames {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO hostnames (host_id, name) VALUES (?, ?)`, hostID, hostname); err != nil {
+			return err
+		}
+	}
+	for _, match := range host.OSMatches {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO os_matches (host_id, name, accuracy) VALUES (?, ?, ?)`, hostID, match.Name, match.Accuracy); err != nil {
+			return err
+		}
+	}
+	for i := range host.Scripts {
+		if err = saveScript(ctx, tx, hostID, nil, &host.Scripts[i]); err != nil {
+			return err
+		}
+	}
+	for i := range host.Services {
+		service := &host.Services[i]
+		cpes, err := json.Marshal(nonNil(service.CPEs))
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `INSERT INTO services (host_id, port, protocol, state, reason, service, product, version, extra_info, tunnel, cpes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			hostID, service.Port, service.Protocol, service.State, service.Reason, service.Service, service.Product,
+			service.Version, service.ExtraInfo, service.Tunnel, string(cpes))
+		if err != nil {
+			return err
+		}
+		serviceID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for j := range service.Scripts {
+			if err = saveScript(ctx, tx, hostID, &serviceID, &service.Scripts[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveScript saves a script result, serviceID is nil for host scripts
+func saveScript(ctx context.Context, tx *sql.Tx, hostID int64, serviceID *int64, script *export.Script) error {
+	data, err := json.Marshal(script.Data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO scripts (host_id, service_id, script, output, data) VALUES (?, ?, ?, ?, ?)`,
+		hostID, serviceID, script.ID, script.Output, string(data))
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"github.com/mr-pmillz/goforit/export"
+	"github.com/mr-pmillz/goforit/nmapxml"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestStore saves the multihost test data as run 1 and only its first host as run 2
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	run, err := nmapxml.ParseFile("../nmapxml/testdata/multihost.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), FileName)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ctx := context.Background()
+	started := time.Date(2023, 7, 3, 20, 22, 0, 0, time.UTC)
+	first := &Run{StartedAt: started, FinishedAt: started.Add(time.Minute), Profile: "default", Engines: []string{"nmap"}, Targets: 4}
+	if err = s.SaveRun(ctx, first, export.NewDocument([]nmapxml.Run{*run})); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+	run.Hosts = run.Hosts[:1]
+	second := &Run{StartedAt: started.Add(time.Hour), FinishedAt: started.Add(time.Hour + time.Minute), Profile: "quick", Engines: []string{"connect", "nmap"}, Targets: 4}
+	if err = s.SaveRun(ctx, second, export.NewDocument([]nmapxml.Run{*run})); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Fatalf("SaveRun() got run IDs %d and %d, want 1 and 2", first.ID, second.ID)
+	}
+	return s, path
+}
+
+func TestQueries(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query func() (*Table, error)
+		want  [][]string
+	}{
+		{"Runs", func() (*Table, error) { return s.Runs(ctx) }, [][]string{
+			{"1", "2023-07-03T20:22:00Z", "2023-07-03T20:23:00Z", "default", "nmap", "4", "2", "3"},
+			{"2", "2023-07-03T21:22:00Z", "2023-07-03T21:23:00Z", "quick", "connect,nmap", "4", "1", "2"},
+		}},
+		{"Open Port", func() (*Table, error) { return s.OpenPort(ctx, 1, 22, "tcp") }, [][]string{
+			{"10.0.0.1", "gw.corp.local", "22", "tcp", "ssh", "OpenSSH", "8.9p1 Ubuntu 3ubuntu0.1"},
+		}},
+		{"Open Port Closed Elsewhere", func() (*Table, error) { return s.OpenPort(ctx, 1, 65000, "tcp") }, nil},
+		{"Products", func() (*Table, error) { return s.Products(ctx, 1, "http") }, [][]string{
+			{"nginx", "1.18.0", "1", "80"},
+		}},
+		{"Hosts Not In", func() (*Table, error) { return s.HostsNotIn(ctx, 1, 2) }, [][]string{
+			{"10.0.0.2", "", "445/tcp"},
+		}},
+		{"Hosts Not In Reversed", func() (*Table, error) { return s.HostsNotIn(ctx, 2, 1) }, nil},
+		{"Query", func() (*Table, error) {
+			return s.Query(ctx, "SELECT name, accuracy FROM os_matches WHERE host_id = 1 ORDER BY accuracy DESC")
+		}, [][]string{{"Linux 4.15 - 5.8", "100"}, {"Linux 2.6.32", "95"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query()
+			if err != nil {
+				t.Fatalf("query error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Rows, tt.want) {
+				t.Errorf("query got = %v, want %v", got.Rows, tt.want)
+			}
+		})
+	}
+
+	latest, err := s.LatestRun(ctx)
+	if err != nil || latest != 2 {
+		t.Errorf("LatestRun() got = %d, %v, want 2", latest, err)
+	}
+
+	open, err := s.OpenServices(ctx, 2)
+	if err != nil {
+		t.Fatalf("OpenServices() error = %v", err)
+	}
+	if len(open) != 2 || !open["10.0.0.1:22/tcp"] || open["10.0.0.2:445/tcp"] {
+		t.Errorf("OpenServices() got = %v, want the two open ports of 10.0.0.1", open)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	_, path := newTestStore(t)
+	s, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer s.Close()
+	if _, err = s.Query(context.Background(), "DELETE FROM runs"); err == nil {
+		t.Errorf("Query() deleted from a read only database")
+	}
+	if _, err = OpenReadOnly(filepath.Join(t.TempDir(), FileName)); err == nil {
+		t.Errorf("OpenReadOnly() opened a missing database")
+	}
+}
@@ -0,0 +1,395 @@
+package target
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Error describes a target or exclusion that could not be parsed and where it came from.
+type Error struct {
+	Source string
+	Line   int
+	Target string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s line %d: %v", e.Source, e.Line, e.Err)
+	}
+	return fmt.Sprintf("target %d: %v", e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors is returned when one or more entries fail to parse.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, targetErr := range e {
+		msgs = append(msgs, targetErr.Error())
+	}
+	return fmt.Sprintf("%d invalid target(s):\n%s", len(e), strings.Join(msgs, "\n"))
+}
+
+// Counts summarizes how the target list was normalized
+type Counts struct {
+	Entries    int
+	Expanded   int
+	Duplicates int
+	Excluded   int
+	// Unresolved are the hostnames excluded because they could not be checked against the exclusions, they are part of Excluded
+	Unresolved int
+	// Unique is the number of addresses and hostnames in scope
+	Unique int
+	// Targets is the number of targets scanned, a CIDR or range that is not expanded is a single target
+	Targets int
+}
+
+func (c Counts) String() string {
+	s := fmt.Sprintf("%d entries expanded to %d targets, %d duplicates removed, %d excluded, %d unique targets in scope", c.Entries, c.Expanded, c.Duplicates, c.Excluded, c.Unique)
+	if c.Targets != c.Unique {
+		s += fmt.Sprintf(", scanned as %d target(s)", c.Targets)
+	}
+	if c.Unresolved > 0 {
+		s += fmt.Sprintf(", %d hostname(s) excluded because they could not be resolved", c.Unresolved)
+	}
+	return s
+}
+
+// Resolver resolves a hostname to its addresses
+type Resolver func(host string) ([]string, error)
+
+// Scope holds the out of scope exclusions every target is checked against
+type Scope struct {
+	entries   []*Entry
+	hostnames map[string]struct{}
+	// Resolver is used to check that hostnames don't resolve to excluded addresses. Defaults to net.LookupHost
+	Resolver Resolver
+}
+
+// NewScope creates a Scope without any exclusions
+func NewScope() *Scope {
+	return &Scope{hostnames: make(map[string]struct{}), Resolver: net.LookupHost}
+}
+
+// Add parses the exclusion entries read from source. Exclusions use the same syntax as targets.
+// An excluded hostname also excludes the addresses it resolves to, so that no CIDR or range target covering them scans
+// them. A hostname that cannot be resolved fails Add, its addresses could not be left out of the scope otherwise.
+func (s *Scope) Add(source string, excludes []string) error {
+	entries, err := parseLines(source, excludes)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Hostname == "" {
+			s.entries = append(s.entries, entry)
+			continue
+		}
+		s.hostnames[entry.Hostname] = struct{}{}
+		if s.Resolver == nil {
+			continue
+		}
+		addrs, err := s.Resolver(entry.Hostname)
+		if err != nil {
+			return &Error{Source: source, Line: entry.Line, Target: entry.Raw, Err: fmt.Errorf("could not resolve the excluded hostname %s: %w", entry.Hostname, err)}
+		}
+		for _, addr := range addrs {
+			resolved, err := ParseEntry(addr)
+			if err != nil || resolved.Hostname != "" {
+				continue
+			}
+			resolved.Line = entry.Line
+			s.entries = append(s.entries, resolved)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of exclusion entries
+func (s *Scope) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.entries) + len(s.hostnames)
+}
+
+// Excluded reports whether the target is out of scope.
+// Hostnames are excluded by name or when any address they resolve to is excluded. A hostname that cannot be
+// resolved cannot be checked, it is excluded with the resolver error so that a DNS failure never widens the scope.
+func (s *Scope) Excluded(t Target) (bool, error) {
+	if s.Len() == 0 {
+		return false, nil
+	}
+	if t.Kind == KindHostname {
+		if _, ok := s.hostnames[t.Host]; ok {
+			return true, nil
+		}
+		if len(s.entries) == 0 || s.Resolver == nil {
+			return false, nil
+		}
+		addrs, err := s.Resolver(t.Host)
+		if err != nil {
+			return true, fmt.Errorf("could not resolve %s to check it against the exclusions: %w", t.Host, err)
+		}
+		for _, addr := range addrs {
+			if s.excludedAddr(addr) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return s.excludedAddr(t.Host), nil
+}
+
+func (s *Scope) excludedAddr(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return s.excludes(addr)
+}
+
+// excludes reports whether addr is covered by an exclusion
+func (s *Scope) excludes(addr netip.Addr) bool {
+	if s.Len() == 0 {
+		return false
+	}
+	for _, entry := range s.entries {
+		if entry.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set is a normalized, deduplicated and scope checked set of targets
+type Set struct {
+	// Ranges keeps CIDRs and ranges as single targets instead of expanding them into their addresses.
+	// Every address is still scanned once, the addresses of a range that are out of scope or scanned by
+	// another target are listed in its Exclude.
+	Ranges bool
+	// Limit is the maximum number of unique targets in scope, Add fails once the entries exceed it. 0 does not limit them.
+	Limit   int
+	targets []Target
+	index   map[string]int
+	scope   *Scope
+	counts  Counts
+	ranges  []*rangeTarget
+}
+
+// rangeTarget is a KindRange target of a Set and the addresses it does not scan
+type rangeTarget struct {
+	entry    *Entry
+	index    int
+	excluded []netip.Addr
+	skip     map[netip.Addr]struct{}
+}
+
+// exclude leaves addr out of the range
+func (r *rangeTarget) exclude(addr netip.Addr) {
+	r.excluded = append(r.excluded, addr)
+	r.skip[addr] = struct{}{}
+}
+
+// NewSet creates an empty Set that drops anything excluded by scope. scope may be nil.
+func NewSet(scope *Scope) *Set {
+	return &Set{index: make(map[string]int), scope: scope}
+}
+
+// Add parses, expands and adds the target entries read from source.
+// Every invalid entry is reported with its line number and nothing is added when any entry is invalid.
+func (s *Set) Add(source string, lines []string) error {
+	entries, err := parseLines(source, lines)
+	if err != nil {
+		return err
+	}
+	// every entry is expanded before anything is added, so that nothing is added when an entry is invalid
+	type expandedEntry struct {
+		targets []Target
+		ranges  []*Entry
+	}
+	expanded := make([]expandedEntry, 0, len(entries))
+	for _, entry := range entries {
+		var (
+			e   expandedEntry
+			err error
+		)
+		if s.Ranges && entry.IsRange() {
+			e.ranges, err = entry.Ranges()
+		} else {
+			e.targets, err = entry.Expand()
+		}
+		if err != nil {
+			return &Error{Source: source, Line: entry.Line, Target: entry.Raw, Err: err}
+		}
+		expanded = append(expanded, e)
+	}
+
+	s.counts.Entries += len(entries)
+	for _, e := range expanded {
+		s.counts.Expanded += len(e.targets)
+		for _, t := range e.targets {
+			s.add(t)
+		}
+		for _, block := range e.ranges {
+			s.addRange(block)
+		}
+		if s.Limit > 0 && s.counts.Unique > s.Limit {
+			return fmt.Errorf("the targets expand to more than %d unique targets", s.Limit)
+		}
+	}
+	s.counts.Targets = len(s.targets)
+	return nil
+}
+
+// add adds a single address or hostname
+func (s *Set) add(t Target) {
+	excluded, err := s.scope.Excluded(t)
+	if err != nil {
+		s.counts.Unresolved++
+	}
+	if excluded {
+		s.counts.Excluded++
+		return
+	}
+	if i, ok := s.index[t.Host]; ok {
+		s.counts.Duplicates++
+		s.targets[i].Ports = mergePorts(s.targets[i].Ports, t.Ports)
+		return
+	}
+	if addr, err := netip.ParseAddr(t.Host); err == nil {
+		if r := s.rangeOf(addr); r != nil {
+			ports := mergePorts(s.targets[r.index].Ports, t.Ports)
+			if samePorts(ports, s.targets[r.index].Ports) {
+				s.counts.Duplicates++
+				return
+			}
+			// the address needs other ports than its range, it is scanned on its own
+			r.exclude(addr)
+			s.targets[r.index].Exclude = Collapse(r.excluded)
+			t.Ports = ports
+			s.counts.Unique--
+		}
+	}
+	s.index[t.Host] = len(s.targets)
+	s.targets = append(s.targets, t)
+	s.counts.Unique++
+}
+
+// addRange adds a range entry as a single target, leaving out the addresses that are excluded or already targets
+func (s *Set) addRange(entry *Entry) {
+	s.counts.Expanded += int(entry.Size())
+	if i, ok := s.index[entry.Raw]; ok {
+		s.counts.Duplicates += int(entry.Size())
+		s.targets[i].Ports = mergePorts(s.targets[i].Ports, entry.Ports)
+		return
+	}
+	r := &rangeTarget{entry: entry, index: len(s.targets), skip: make(map[netip.Addr]struct{})}
+	inScope := 0
+	entry.each(func(addr netip.Addr) {
+		i, isTarget := s.index[addr.String()]
+		switch {
+		case s.scope.excludes(addr):
+			s.counts.Excluded++
+		case isTarget:
+			// the address keeps its own target, scanned on the ports of both
+			s.counts.Duplicates++
+			s.targets[i].Ports = mergePorts(s.targets[i].Ports, entry.Ports)
+		case s.rangeOf(addr) != nil:
+			s.counts.Duplicates++
+		default:
+			inScope++
+			return
+		}
+		r.exclude(addr)
+	})
+	if inScope == 0 {
+		return
+	}
+	s.index[entry.Raw] = r.index
+	s.targets = append(s.targets, Target{Host: entry.Raw, Kind: KindRange, Ports: entry.Ports, Exclude: Collapse(r.excluded)})
+	s.ranges = append(s.ranges, r)
+	s.counts.Unique += inScope
+}
+
+// rangeOf returns the range target that scans addr, nil when no range does
+func (s *Set) rangeOf(addr netip.Addr) *rangeTarget {
+	for _, r := range s.ranges {
+		if _, skipped := r.skip[addr]; !skipped && r.entry.Contains(addr) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Targets returns the targets in the order they were added
+func (s *Set) Targets() []Target {
+	return s.targets
+}
+
+// Hosts returns the host of every target in the order they were added
+func (s *Set) Hosts() []string {
+	hosts := make([]string, 0, len(s.targets))
+	for _, t := range s.targets {
+		hosts = append(hosts, t.Host)
+	}
+	return hosts
+}
+
+// Counts returns how many targets were expanded, deduplicated and excluded
+func (s *Set) Counts() Counts {
+	return s.counts
+}
+
+// parseLines parses every non blank, non # comment line into an Entry
+func parseLines(source string, lines []string) ([]*Entry, error) {
+	var (
+		entries []*Entry
+		errs    Errors
+	)
+	for i, line := range lines {
+		spec := strings.TrimSpace(line)
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		entry, err := ParseEntry(spec)
+		if err != nil {
+			errs = append(errs, &Error{Source: source, Line: i + 1, Target: spec, Err: err})
+			continue
+		}
+		entry.Line = i + 1
+		entries = append(entries, entry)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return entries, nil
+}
+
+// samePorts reports whether two port lists are the same
+func samePorts(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// mergePorts merges the ports of duplicate host:port targets. A target without ports means scan the default ports.
+func mergePorts(existing, ports []string) []string {
+	if len(existing) == 0 || len(ports) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(existing))
+	for _, port := range existing {
+		seen[port] = struct{}{}
+	}
+	for _, port := range ports {
+		if _, ok := seen[port]; !ok {
+			existing = append(existing, port)
+		}
+	}
+	return existing
+}
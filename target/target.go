@@ -0,0 +1,417 @@
+/*
+Package target
+
+Copyright © 2023 MrPMillz
+*/
+package target
+
+import (
+	"fmt"
+	valid "github.com/asaskevich/govalidator"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxAddresses is the maximum number of addresses a single target entry may expand to.
+// A typo such as 10.0.0.0/8 instead of 10.0.0.0/24 should fail loudly instead of queueing 16 million hosts.
+const MaxAddresses = 1 << 20
+
+var (
+	// octetRegex matches a single nmap style octet such as 10, *, 1-40 or 1,3,5-7
+	octetRegex = regexp.MustCompile(`^(\*|\d{1,3}(-\d{1,3})?(,\d{1,3}(-\d{1,3})?)*)$`)
+	// numericRegex matches entries that can only be an IP address or range, never a DNS name
+	numericRegex = regexp.MustCompile(`^[\d.,*-]+$`)
+	// portsRegex matches the port list of a host:port entry such as 80 or 80,443,8000-8100
+	portsRegex = regexp.MustCompile(`^\d{1,5}(-\d{1,5})?(,\d{1,5}(-\d{1,5})?)*$`)
+)
+
+// Kind is the type of host a Target points at
+type Kind int
+
+const (
+	// KindIP is a single IPv4 or IPv6 address
+	KindIP Kind = iota
+	// KindHostname is a DNS name that nmap resolves itself
+	KindHostname
+	// KindRange is a CIDR or nmap style range that nmap scans as a single target
+	KindRange
+)
+
+// Target is a single normalized host or range to scan and any ports that were given with it
+type Target struct {
+	Host  string
+	Kind  Kind
+	Ports []string
+	// Exclude are the CIDRs of the addresses of a KindRange target that are out of scope or scanned by another target
+	Exclude []string
+}
+
+// Entry is a parsed target or exclusion entry before it gets expanded
+type Entry struct {
+	Raw      string
+	Line     int
+	Hostname string
+	Prefix   netip.Prefix
+	Start    netip.Addr
+	End      netip.Addr
+	Octets   [][]int
+	Ports    []string
+}
+
+// ParseEntry parses an IP, CIDR, IP range, nmap style octet range, hostname or host:port entry
+func ParseEntry(raw string) (*Entry, error) {
+	entry := &Entry{Raw: raw}
+	spec := strings.TrimSpace(raw)
+	if spec == "" || strings.HasPrefix(spec, "-") {
+		return nil, fmt.Errorf("invalid target %q", raw)
+	}
+
+	host, ports, err := splitHostPorts(spec)
+	if err != nil {
+		return nil, err
+	}
+	entry.Ports = ports
+
+	switch {
+	case strings.Contains(host, "/"):
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", raw, err)
+		}
+		entry.Prefix = prefix.Masked()
+	case isIPRange(host):
+		start, end, _ := strings.Cut(host, "-")
+		entry.Start, entry.End = netip.MustParseAddr(start).Unmap(), netip.MustParseAddr(end).Unmap()
+		if entry.Start.Is4() != entry.End.Is4() || entry.End.Less(entry.Start) {
+			return nil, fmt.Errorf("invalid IP range %q", raw)
+		}
+	default:
+		if addr, err := netip.ParseAddr(host); err == nil {
+			entry.Start, entry.End = addr.Unmap(), addr.Unmap()
+			break
+		}
+		if octets, ok := parseOctets(host); ok {
+			entry.Octets = octets
+			break
+		}
+		if numericRegex.MatchString(host) || !valid.IsDNSName(host) {
+			return nil, fmt.Errorf("invalid target %q", raw)
+		}
+		entry.Hostname = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+
+	return entry, nil
+}
+
+// Size returns the number of addresses the entry expands to
+func (e *Entry) Size() uint64 {
+	switch {
+	case e.Hostname != "":
+		return 1
+	case e.Prefix.IsValid():
+		hostBits := e.Prefix.Addr().BitLen() - e.Prefix.Bits()
+		if hostBits >= 64 {
+			return ^uint64(0)
+		}
+		return 1 << hostBits
+	case e.Octets != nil:
+		size := uint64(1)
+		for _, octet := range e.Octets {
+			size *= uint64(len(octet))
+		}
+		return size
+	default:
+		return rangeSize(e.Start, e.End)
+	}
+}
+
+// IsRange reports whether the entry covers more than a single address
+func (e *Entry) IsRange() bool {
+	return e.Hostname == "" && e.Size() > 1
+}
+
+// Expand returns every target the entry covers
+func (e *Entry) Expand() ([]Target, error) {
+	if size := e.Size(); size > MaxAddresses {
+		return nil, fmt.Errorf("target %q expands to more than %d addresses", e.Raw, MaxAddresses)
+	}
+	var targets []Target
+	if e.Hostname != "" {
+		return append(targets, Target{Host: e.Hostname, Kind: KindHostname, Ports: e.Ports}), nil
+	}
+	e.each(func(addr netip.Addr) {
+		targets = append(targets, Target{Host: addr.String(), Kind: KindIP, Ports: e.Ports})
+	})
+	return targets, nil
+}
+
+// Contains reports whether the entry covers addr
+func (e *Entry) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	switch {
+	case e.Hostname != "":
+		return false
+	case e.Prefix.IsValid():
+		return e.Prefix.Contains(addr)
+	case e.Octets != nil:
+		if !addr.Is4() {
+			return false
+		}
+		for i, b := range addr.As4() {
+			if !containsInt(e.Octets[i], int(b)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return addr.BitLen() == e.Start.BitLen() && !addr.Less(e.Start) && !e.End.Less(addr)
+	}
+}
+
+// Ranges splits a range entry into entries nmap accepts as targets. CIDRs and octet ranges are kept as they are,
+// a range of two full addresses is written as an octet range when it stays within the last octet and split into CIDRs otherwise.
+func (e *Entry) Ranges() ([]*Entry, error) {
+	if size := e.Size(); size > MaxAddresses {
+		return nil, fmt.Errorf("target %q expands to more than %d addresses", e.Raw, MaxAddresses)
+	}
+	var specs []string
+	switch {
+	case e.Prefix.IsValid():
+		specs = []string{e.Prefix.String()}
+	case e.Octets != nil:
+		parts := make([]string, 0, len(e.Octets))
+		for _, octet := range e.Octets {
+			parts = append(parts, octetSpec(octet))
+		}
+		specs = []string{strings.Join(parts, ".")}
+	case e.Start.Is4() && netip.PrefixFrom(e.Start, 24).Masked().Contains(e.End):
+		start, end := e.Start.As4(), e.End.As4()
+		specs = []string{fmt.Sprintf("%d.%d.%d.%d-%d", start[0], start[1], start[2], start[3], end[3])}
+	default:
+		for _, prefix := range RangePrefixes(e.Start, e.End) {
+			specs = append(specs, prefix.String())
+		}
+	}
+	entries := make([]*Entry, 0, len(specs))
+	for _, spec := range specs {
+		entry, err := ParseEntry(spec)
+		if err != nil {
+			return nil, err
+		}
+		entry.Line, entry.Ports = e.Line, e.Ports
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// RangePrefixes returns the fewest CIDRs that cover every address from start to end
+func RangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for start.IsValid() && !end.Less(start) {
+		prefix := netip.PrefixFrom(start, start.BitLen())
+		for bits := start.BitLen() - 1; bits >= 0; bits-- {
+			wider := netip.PrefixFrom(start, bits).Masked()
+			if wider.Addr() != start || end.Less(lastAddr(wider)) {
+				break
+			}
+			prefix = wider
+		}
+		prefixes = append(prefixes, prefix)
+		start = lastAddr(prefix).Next()
+	}
+	return prefixes
+}
+
+// Collapse returns the fewest CIDRs that cover exactly addrs
+func Collapse(addrs []netip.Addr) []string {
+	sorted := make([]netip.Addr, len(addrs))
+	copy(sorted, addrs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Less(sorted[j]) })
+	var cidrs []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && (sorted[j+1] == sorted[j] || sorted[j+1] == sorted[j].Next()) {
+			j++
+		}
+		for _, prefix := range RangePrefixes(sorted[i], sorted[j]) {
+			cidrs = append(cidrs, prefix.String())
+		}
+		i = j + 1
+	}
+	return cidrs
+}
+
+// lastAddr returns the highest address of prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As16()
+	offset := 0
+	if prefix.Addr().Is4() {
+		offset = 96
+	}
+	for bit := prefix.Bits() + offset; bit < 128; bit++ {
+		b[bit/8] |= 1 << (7 - bit%8)
+	}
+	addr := netip.AddrFrom16(b)
+	if prefix.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// octetSpec writes the values of an octet as nmap does, consecutive values are collapsed into ranges
+func octetSpec(values []int) string {
+	var parts []string
+	for i := 0; i < len(values); {
+		j := i
+		for j+1 < len(values) && values[j+1] == values[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(values[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", values[i], values[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// each calls fn for every address of a non hostname entry
+func (e *Entry) each(fn func(addr netip.Addr)) {
+	switch {
+	case e.Prefix.IsValid():
+		for addr := e.Prefix.Addr(); addr.IsValid() && e.Prefix.Contains(addr); addr = addr.Next() {
+			fn(addr)
+		}
+	case e.Octets != nil:
+		for _, a := range e.Octets[0] {
+			for _, b := range e.Octets[1] {
+				for _, c := range e.Octets[2] {
+					for _, d := range e.Octets[3] {
+						fn(netip.AddrFrom4([4]byte{byte(a), byte(b), byte(c), byte(d)}))
+					}
+				}
+			}
+		}
+	default:
+		for addr := e.Start; addr.IsValid() && !e.End.Less(addr); addr = addr.Next() {
+			fn(addr)
+		}
+	}
+}
+
+// splitHostPorts splits a host:port entry. Bare IPv6 addresses are left alone, use [::1]:443 to give them ports.
+func splitHostPorts(spec string) (string, []string, error) {
+	switch {
+	case strings.HasPrefix(spec, "["):
+		host, portList, err := net.SplitHostPort(spec)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid target %q: %w", spec, err)
+		}
+		ports, err := parsePortList(spec, portList)
+		return host, ports, err
+	case strings.Count(spec, ":") == 1:
+		host, portList, _ := strings.Cut(spec, ":")
+		ports, err := parsePortList(spec, portList)
+		return host, ports, err
+	}
+	return spec, nil, nil
+}
+
+// parsePortList validates the ports of a host:port entry
+func parsePortList(spec, portList string) ([]string, error) {
+	if !portsRegex.MatchString(portList) {
+		return nil, fmt.Errorf("invalid ports in target %q", spec)
+	}
+	ports := strings.Split(portList, ",")
+	for _, port := range ports {
+		for _, p := range strings.Split(port, "-") {
+			if n, _ := strconv.Atoi(p); n < 1 || n > 65535 {
+				return nil, fmt.Errorf("invalid port %q in target %q", p, spec)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// parseOctets parses an nmap style IPv4 octet range such as 10.0.0.5-40 or 192.168.1,3.*
+func parseOctets(host string) ([][]int, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) != 4 {
+		return nil, false
+	}
+	octets := make([][]int, 0, 4)
+	for _, part := range parts {
+		if !octetRegex.MatchString(part) {
+			return nil, false
+		}
+		if part == "*" {
+			part = "0-255"
+		}
+		seen := make(map[int]struct{})
+		var values []int
+		for _, item := range strings.Split(part, ",") {
+			lowStr, highStr, isRange := strings.Cut(item, "-")
+			low, _ := strconv.Atoi(lowStr)
+			high := low
+			if isRange {
+				high, _ = strconv.Atoi(highStr)
+			}
+			if low > 255 || high > 255 || high < low {
+				return nil, false
+			}
+			for i := low; i <= high; i++ {
+				if _, ok := seen[i]; !ok {
+					seen[i] = struct{}{}
+					values = append(values, i)
+				}
+			}
+		}
+		octets = append(octets, values)
+	}
+	return octets, true
+}
+
+// isIPRange reports whether host is a 10.0.0.1-10.0.0.20 style range of two full addresses
+func isIPRange(host string) bool {
+	start, end, found := strings.Cut(host, "-")
+	if !found {
+		return false
+	}
+	_, startErr := netip.ParseAddr(start)
+	_, endErr := netip.ParseAddr(end)
+	return startErr == nil && endErr == nil
+}
+
+// rangeSize returns the number of addresses between start and end, capped at the max uint64
+func rangeSize(start, end netip.Addr) uint64 {
+	s, e := start.As16(), end.As16()
+	// anything that differs above the lower 8 bytes is far too big to expand anyway
+	for i := 0; i < 8; i++ {
+		if s[i] != e[i] {
+			return ^uint64(0)
+		}
+	}
+	var low, high uint64
+	for i := 8; i < 16; i++ {
+		low = low<<8 | uint64(s[i])
+		high = high<<8 | uint64(e[i])
+	}
+	if high-low == ^uint64(0) {
+		return high - low
+	}
+	return high - low + 1
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
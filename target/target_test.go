@@ -0,0 +1,283 @@
+package target
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		want    []string
+		wantErr bool
+	}{
+		{"IPv4", "10.0.0.1", []string{"10.0.0.1"}, false},
+		{"IPv4 CIDR", "10.0.0.5/30", []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"}, false},
+		{"IPv6 CIDR", "fe80::/127", []string{"fe80::", "fe80::1"}, false},
+		{"Octet Range", "10.0.0.5-7", []string{"10.0.0.5", "10.0.0.6", "10.0.0.7"}, false},
+		{"Octet List", "10.0.1,3.1", []string{"10.0.1.1", "10.0.3.1"}, false},
+		{"Full Range", "10.0.0.254-10.0.1.1", []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}, false},
+		{"Hostname", "ScanMe.Nmap.org.", []string{"scanme.nmap.org"}, false},
+		{"Host Port", "scanme.nmap.org:8443", []string{"scanme.nmap.org"}, false},
+		{"IPv6 Host Port", "[fe80::1]:443", []string{"fe80::1"}, false},
+		{"Too Big", "10.0.0.0/8", nil, true},
+		{"Shell Injection", "10.0.0.1;rm -rf ~", nil, true},
+		{"Command Substitution", "$(id).example.com", nil, true},
+		{"Flag Injection", "-iL/etc/shadow", nil, true},
+		{"Octet Out Of Range", "10.0.0.5-300", nil, true},
+		{"Backwards Range", "10.0.0.9-10.0.0.1", nil, true},
+		{"Bad Port", "10.0.0.1:70000", nil, true},
+		{"Path Traversal", "../../etc/passwd", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseEntry(tt.entry)
+			var targets []Target
+			if err == nil {
+				targets, err = entry.Expand()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEntry(%q).Expand() error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+				return
+			}
+			var got []string
+			for _, target := range targets {
+				got = append(got, target.Host)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEntry(%q).Expand() got = %v, want %v", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	scope := NewScope()
+	scope.Resolver = func(host string) ([]string, error) {
+		return map[string][]string{"prod.example.com": {"10.0.0.3"}, "dev.example.com": {"10.9.9.9"}}[host], nil
+	}
+	if err := scope.Add("exclude.txt", []string{"# out of scope", "10.0.0.2", "10.0.0.3/32", "vpn.example.com"}); err != nil {
+		t.Fatalf("Scope.Add() error = %v", err)
+	}
+
+	set := NewSet(scope)
+	lines := []string{"10.0.0.0/30", "10.0.0.1", "prod.example.com", "dev.example.com", "VPN.example.com", "10.0.0.1:8443"}
+	if err := set.Add("targets.txt", lines); err != nil {
+		t.Fatalf("Set.Add() error = %v", err)
+	}
+	if got, want := set.Hosts(), []string{"10.0.0.0", "10.0.0.1", "dev.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Set.Hosts() got = %v, want %v", got, want)
+	}
+	if got, want := set.Counts(), (Counts{Entries: 6, Expanded: 9, Duplicates: 2, Excluded: 4, Unique: 3, Targets: 3}); got != want {
+		t.Errorf("Set.Counts() got = %+v, want %+v", got, want)
+	}
+	if got := set.Targets()[1].Ports; got != nil {
+		t.Errorf("Set.Targets() ports for a host given with and without ports got = %v, want nil", got)
+	}
+}
+
+func TestSetInvalidLines(t *testing.T) {
+	set := NewSet(nil)
+	lines := []string{"# scope", "10.0.0.1", "", "10.0.0.2;id", "scanme.nmap.org", "`reboot`"}
+	err := set.Add("targets.txt", lines)
+	var targetErrs Errors
+	if !errors.As(err, &targetErrs) {
+		t.Fatalf("Set.Add() error = %v, want Errors", err)
+	}
+	var gotLines []int
+	for _, targetErr := range targetErrs {
+		gotLines = append(gotLines, targetErr.Line)
+	}
+	if !reflect.DeepEqual(gotLines, []int{4, 6}) {
+		t.Errorf("Set.Add() invalid lines got = %v, want %v", gotLines, []int{4, 6})
+	}
+	if len(set.Targets()) != 0 {
+		t.Errorf("Set.Add() added targets despite invalid lines: %v", set.Hosts())
+	}
+}
+
+func TestSetUnresolvedHostname(t *testing.T) {
+	scope := NewScope()
+	scope.Resolver = func(host string) ([]string, error) {
+		if host == "flaky.example.com" {
+			return nil, errors.New("i/o timeout")
+		}
+		return []string{"10.0.0.9"}, nil
+	}
+	if err := scope.Add("exclude", []string{"10.0.0.2"}); err != nil {
+		t.Fatalf("Scope.Add() error = %v", err)
+	}
+	excluded, err := scope.Excluded(Target{Host: "flaky.example.com", Kind: KindHostname})
+	if !excluded || err == nil {
+		t.Errorf("Scope.Excluded() of an unresolvable hostname got = %v, %v, want excluded with an error", excluded, err)
+	}
+
+	set := NewSet(scope)
+	if err = set.Add("", []string{"flaky.example.com", "ok.example.com"}); err != nil {
+		t.Fatalf("Set.Add() error = %v", err)
+	}
+	if got, want := set.Hosts(), []string{"ok.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Set.Hosts() got = %v, want %v", got, want)
+	}
+	if got := set.Counts(); got.Excluded != 1 || got.Unresolved != 1 {
+		t.Errorf("Set.Counts() got = %+v, want 1 excluded and 1 unresolved", got)
+	}
+}
+
+func TestScopeHostnameExclusion(t *testing.T) {
+	resolver := func(host string) ([]string, error) {
+		if host == "flaky.corp" {
+			return nil, errors.New("i/o timeout")
+		}
+		return map[string][]string{"printer.corp": {"10.0.0.7", "fe80::7"}, "alias.corp": {"10.0.0.7"}}[host], nil
+	}
+	tests := []struct {
+		name        string
+		ranges      bool
+		lines       []string
+		wantHosts   []string
+		wantExclude []string
+	}{
+		{"Address", false, []string{"10.0.0.7", "10.0.0.6", "fe80::7"}, []string{"10.0.0.6"}, nil},
+		{"Expanded CIDR", false, []string{"10.0.0.4/30"}, []string{"10.0.0.4", "10.0.0.5", "10.0.0.6"}, nil},
+		{"Range", true, []string{"10.0.0.0/29"}, []string{"10.0.0.0/29"}, []string{"10.0.0.7/32"}},
+		{"Hostname", false, []string{"printer.corp", "PRINTER.corp:9100", "alias.corp"}, []string{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := NewScope()
+			scope.Resolver = resolver
+			if err := scope.Add("exclude", []string{"printer.corp"}); err != nil {
+				t.Fatalf("Scope.Add() error = %v", err)
+			}
+			set := NewSet(scope)
+			set.Ranges = tt.ranges
+			if err := set.Add("", tt.lines); err != nil {
+				t.Fatalf("Set.Add() error = %v", err)
+			}
+			if got := set.Hosts(); !reflect.DeepEqual(got, tt.wantHosts) {
+				t.Errorf("Set.Hosts() got = %v, want %v", got, tt.wantHosts)
+			}
+			if targets := set.Targets(); len(targets) > 0 && !reflect.DeepEqual(targets[0].Exclude, tt.wantExclude) {
+				t.Errorf("Set.Targets()[0].Exclude got = %v, want %v", targets[0].Exclude, tt.wantExclude)
+			}
+		})
+	}
+
+	// an exclusion that cannot be resolved would leave its addresses in scope
+	scope := NewScope()
+	scope.Resolver = resolver
+	if err := scope.Add("exclude", []string{"10.0.0.1", "flaky.corp"}); err == nil {
+		t.Errorf("Scope.Add() of an unresolvable hostname got no error")
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  []string
+	}{
+		{"CIDR", "10.0.0.5/24", []string{"10.0.0.0/24"}},
+		{"Octet Range", "10.0.0.5-40", []string{"10.0.0.5-40"}},
+		{"Octet List", "10.0.1,3,4,5.1-3", []string{"10.0.1,3-5.1-3"}},
+		{"Range Within Last Octet", "10.0.0.1-10.0.0.20", []string{"10.0.0.1-20"}},
+		{"Range Across Octets", "10.0.0.254-10.0.1.1", []string{"10.0.0.254/31", "10.0.1.0/31"}},
+		{"IPv6 Range", "fe80::1-fe80::4", []string{"fe80::1/128", "fe80::2/127", "fe80::4/128"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseEntry(tt.entry)
+			if err != nil {
+				t.Fatalf("ParseEntry() error = %v", err)
+			}
+			ranges, err := entry.Ranges()
+			if err != nil {
+				t.Fatalf("Ranges() error = %v", err)
+			}
+			var got []string
+			for _, r := range ranges {
+				got = append(got, r.Raw)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ranges() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	var addrs []netip.Addr
+	for _, addr := range []string{"10.0.0.7", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.9", "10.0.0.255", "10.0.1.0"} {
+		addrs = append(addrs, netip.MustParseAddr(addr))
+	}
+	if got, want := Collapse(addrs), []string{"10.0.0.4/30", "10.0.0.9/32", "10.0.0.255/32", "10.0.1.0/32"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Collapse() got = %v, want %v", got, want)
+	}
+}
+
+func TestSetRanges(t *testing.T) {
+	scope := NewScope()
+	if err := scope.Add("exclude", []string{"10.0.0.8/29", "10.0.1.0/24"}); err != nil {
+		t.Fatalf("Scope.Add() error = %v", err)
+	}
+	set := NewSet(scope)
+	set.Ranges = true
+	lines := []string{"10.0.0.1:8443", "10.0.0.0/24", "10.0.0.2", "10.0.1.0/24", "10.0.0.0/24", "10.0.0.0/30", "10.0.2.0/30:80", "10.0.2.1:443"}
+	if err := set.Add("targets.txt", lines); err != nil {
+		t.Fatalf("Set.Add() error = %v", err)
+	}
+	want := []Target{
+		{Host: "10.0.0.1", Kind: KindIP},
+		{Host: "10.0.0.0/24", Kind: KindRange, Exclude: []string{"10.0.0.1/32", "10.0.0.8/29"}},
+		{Host: "10.0.2.0/30", Kind: KindRange, Ports: []string{"80"}, Exclude: []string{"10.0.2.1/32"}},
+		{Host: "10.0.2.1", Kind: KindIP, Ports: []string{"80", "443"}},
+	}
+	got := set.Targets()
+	if len(got) != len(want) {
+		t.Fatalf("Set.Targets() got = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Host != want[i].Host || got[i].Kind != want[i].Kind || !reflect.DeepEqual(got[i].Ports, want[i].Ports) || !reflect.DeepEqual(got[i].Exclude, want[i].Exclude) {
+			t.Errorf("Set.Targets()[%d] got = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	counts := set.Counts()
+	if counts.Unique != 252 || counts.Targets != 4 || counts.Excluded != 264 {
+		t.Errorf("Set.Counts() got = %+v, want 252 unique addresses, 4 targets and 264 excluded", counts)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  bool
+		lines   []string
+		wantErr bool
+	}{
+		{"Within Limit", false, []string{"10.0.0.0/25", "10.0.0.1", "example.com"}, false},
+		{"Expanded Over Limit", false, []string{"10.0.0.0/24"}, true},
+		{"Range Over Limit", true, []string{"10.0.0.0/25", "10.0.2.0/25"}, true},
+		{"Excluded Not Counted", true, []string{"10.0.0.0/25", "10.0.1.0/24"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := NewScope()
+			if err := scope.Add("exclude", []string{"10.0.1.0/24"}); err != nil {
+				t.Fatalf("Scope.Add() error = %v", err)
+			}
+			scope.Resolver = func(host string) ([]string, error) {
+				return []string{"192.0.2.1"}, nil
+			}
+			set := NewSet(scope)
+			set.Ranges = tt.ranges
+			set.Limit = 129
+			if err := set.Add("", tt.lines); (err != nil) != tt.wantErr {
+				t.Errorf("Set.Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
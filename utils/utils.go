@@ -9,6 +9,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // LoadFromCommandOpts ...
@@ -135,6 +136,51 @@ func ConfigureFlagOpts(cmd *cobra.Command, lfcOpts *LoadFromCommandOpts) (interf
 	return lfcOpts.Opts, nil
 }
 
+// ConfigureIntFlagOpts returns the int value of the cobra flag from LoadFromCommandOpts.Flag
+// falling back to the config.yaml value when the flag was not explicitly set
+func ConfigureIntFlagOpts(cmd *cobra.Command, lfcOpts *LoadFromCommandOpts) (int, error) {
+	flagName := fmt.Sprintf("%s%s", lfcOpts.Prefix, lfcOpts.Flag)
+	cmdFlag, err := cmd.Flags().GetInt(flagName)
+	if err != nil {
+		return 0, err
+	}
+	configKey := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if !cmd.Flags().Changed(flagName) && viper.IsSet(configKey) {
+		return viper.GetInt(configKey), nil
+	}
+	return cmdFlag, nil
+}
+
+// ConfigureBoolFlagOpts returns the bool value of the cobra flag from LoadFromCommandOpts.Flag
+// falling back to the config.yaml value when the flag was not explicitly set
+func ConfigureBoolFlagOpts(cmd *cobra.Command, lfcOpts *LoadFromCommandOpts) (bool, error) {
+	flagName := fmt.Sprintf("%s%s", lfcOpts.Prefix, lfcOpts.Flag)
+	cmdFlag, err := cmd.Flags().GetBool(flagName)
+	if err != nil {
+		return false, err
+	}
+	configKey := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if !cmd.Flags().Changed(flagName) && viper.IsSet(configKey) {
+		return viper.GetBool(configKey), nil
+	}
+	return cmdFlag, nil
+}
+
+// ConfigureDurationFlagOpts returns the duration value of the cobra flag from LoadFromCommandOpts.Flag
+// falling back to the config.yaml value when the flag was not explicitly set
+func ConfigureDurationFlagOpts(cmd *cobra.Command, lfcOpts *LoadFromCommandOpts) (time.Duration, error) {
+	flagName := fmt.Sprintf("%s%s", lfcOpts.Prefix, lfcOpts.Flag)
+	cmdFlag, err := cmd.Flags().GetDuration(flagName)
+	if err != nil {
+		return 0, err
+	}
+	configKey := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if !cmd.Flags().Changed(flagName) && viper.IsSet(configKey) {
+		return viper.GetDuration(configKey), nil
+	}
+	return cmdFlag, nil
+}
+
 // ResolveAbsPath ...
 func ResolveAbsPath(path string) (string, error) {
 	usr, err := user.Current()
@@ -205,6 +251,9 @@ func ReadLines(path string) ([]string, error) {
 func FilePathWalkDir(dirPath string) ([]string, error) {
 	var files []string
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			files = append(files, path)
 		}